@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"io"
 	"net/http"
 	"picp/config"
 	"picp/driver"
 	"picp/logger"
 	"picp/utils"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func initApi(group *gin.RouterGroup) {
@@ -22,8 +25,47 @@ func initApi(group *gin.RouterGroup) {
 	group.POST("/wifi/config", setWifiConfig)
 	group.GET("/fan", getFanConfig)
 	group.POST("/fan", setFanConfig)
+	group.GET("/fan/autotune", getFanAutoTune)
+	group.POST("/fan/autotune", startFanAutoTune)
+	group.GET("/fan/status", getFanStatus)
+	group.POST("/fan/override", setFanOverride)
+	group.DELETE("/fan/override", clearFanOverride)
+	group.GET("/fan/profile", getFanProfile)
+	group.POST("/fan/profile", setFanProfile)
+	group.DELETE("/fan/profile", clearFanProfile)
+	group.GET("/fan/profiles", getFanProfilesConfig)
+	group.POST("/fan/profiles", setFanProfilesConfig)
+	group.GET("/fans", getFanList)
+	group.GET("/fans/:name/status", getFanStatus)
+	group.POST("/fans/:name/override", setFanOverride)
+	group.DELETE("/fans/:name/override", clearFanOverride)
+	group.GET("/fans/:name", getFanConfig)
+	group.POST("/fans/:name", setFanConfig)
+	group.GET("/fans/:name/autotune", getFanAutoTune)
+	group.POST("/fans/:name/autotune", startFanAutoTune)
 	group.GET("/display", getDisplayCfg)
 	group.POST("/display", setDisplayCfg)
+	group.GET("/display/status", getDisplayStatus)
+	group.GET("/ups", getUpsStatus)
+	group.GET("/ups/config", getUpsConfig)
+	group.POST("/ups/config", setUpsConfig)
+	group.GET("/rtc", getRtcStatus)
+	group.GET("/protect", getProtectStatus)
+	group.GET("/protect/config", getProtectConfig)
+	group.POST("/protect/config", setProtectConfig)
+	group.GET("/system/throttle", getThrottle)
+	group.POST("/system/power", systemPower)
+	group.GET("/leds", getLedStatus)
+	group.POST("/leds/:name", setLedOverride)
+	group.DELETE("/leds/:name", clearLedOverride)
+	group.GET("/buzzer/config", getBuzzerConfig)
+	group.POST("/buzzer/config", setBuzzerConfig)
+	group.POST("/buzzer/play", playBuzzer)
+	group.GET("/gpio", getGpioStatus)
+	group.POST("/gpio/:pin", setGpio)
+	group.GET("/sensors", getSensors)
+	group.GET("/sensors/w1", getW1Config)
+	group.POST("/sensors/w1", setW1Config)
 	group.GET("/login_setting", getLoginSetting)
 	group.POST("/login_setting", setLoginSetting)
 }
@@ -42,6 +84,10 @@ func replaySuccess(ctx *gin.Context, data interface{}) {
 	})
 }
 
+func health(ctx *gin.Context) {
+	replaySuccess(ctx, nil)
+}
+
 func getDeviceList(ctx *gin.Context) {
 	devices, err := utils.GetDevices()
 	if err != nil {
@@ -190,17 +236,177 @@ func setWifiConfig(ctx *gin.Context) {
 	}
 }
 
+type FanInfo struct {
+	config.FanChanelCfg
+	driver.FanSpeed
+}
+
+// fanName returns the :name path parameter, /api/fan addresses the default channel
+func fanName(ctx *gin.Context) string {
+	if name := ctx.Param("name"); name != "" {
+		return name
+	}
+	return config.DefaultFanName
+}
+
+func getFanInfo(name string) (*FanInfo, error) {
+	cfg, ok := config.GetFanChannelCfg(name)
+	if !ok {
+		return nil, driver.ErrorFanNotFound
+	}
+	speed, err := driver.GetFanSpeed(name)
+	if err != nil {
+		return nil, err
+	}
+	return &FanInfo{FanChanelCfg: cfg, FanSpeed: *speed}, nil
+}
+
+func getFanList(ctx *gin.Context) {
+	names := config.GetFanNames()
+	ret := make([]*FanInfo, 0, len(names))
+	for _, name := range names {
+		info, err := getFanInfo(name)
+		if err != nil {
+			replayError(ctx, err)
+			return
+		}
+		ret = append(ret, info)
+	}
+	replaySuccess(ctx, ret)
+}
+
 func getFanConfig(ctx *gin.Context) {
-	replaySuccess(ctx, config.GetFanCfg())
+	info, err := getFanInfo(fanName(ctx))
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, info)
+	}
 }
 
 func setFanConfig(ctx *gin.Context) {
-	var fanCfg config.FanChanelCfg
+	name := fanName(ctx)
+	// fields missing in the request keep their current value
+	fanCfg, ok := config.GetFanChannelCfg(name)
+	if !ok {
+		fanCfg = config.DefaultFanChannelCfg()
+	}
 	if err := ctx.ShouldBindJSON(&fanCfg); err != nil {
 		replayError(ctx, err)
 		return
 	}
-	err := driver.SetFanConfig(&fanCfg)
+	err := driver.SetFanConfig(name, &fanCfg)
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, nil)
+	}
+}
+
+func getFanStatus(ctx *gin.Context) {
+	status, err := driver.GetFanStatus(fanName(ctx))
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, status)
+	}
+}
+
+type FanOverrideQuery struct {
+	Duty uint32 `json:"duty" validate:"lte=100"`
+	// seconds, 0 keeps the override until it is cleared
+	Duration int `json:"duration" validate:"gte=0"`
+}
+
+func setFanOverride(ctx *gin.Context) {
+	var query FanOverrideQuery
+	if err := ctx.ShouldBindJSON(&query); err != nil {
+		replayError(ctx, err)
+		return
+	}
+	if err := config.Validate(&query); err != nil {
+		replayError(ctx, err)
+		return
+	}
+	err := driver.SetFanOverride(fanName(ctx), query.Duty, time.Second*time.Duration(query.Duration))
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, nil)
+	}
+}
+
+func clearFanOverride(ctx *gin.Context) {
+	err := driver.ClearFanOverride(fanName(ctx))
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, nil)
+	}
+}
+
+func getFanProfile(ctx *gin.Context) {
+	replaySuccess(ctx, driver.GetFanProfileStatus())
+}
+
+type FanProfileQuery struct {
+	Profile string `json:"profile"`
+	// seconds, 0 keeps the profile until the switch is cleared
+	Duration int `json:"duration" validate:"gte=0"`
+}
+
+func setFanProfile(ctx *gin.Context) {
+	var query FanProfileQuery
+	if err := ctx.ShouldBindJSON(&query); err != nil {
+		replayError(ctx, err)
+		return
+	}
+	if err := config.Validate(&query); err != nil {
+		replayError(ctx, err)
+		return
+	}
+	err := driver.SetFanProfile(query.Profile, time.Second*time.Duration(query.Duration))
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, nil)
+	}
+}
+
+func clearFanProfile(ctx *gin.Context) {
+	driver.ClearFanProfile()
+	replaySuccess(ctx, nil)
+}
+
+func getFanProfilesConfig(ctx *gin.Context) {
+	replaySuccess(ctx, config.GetFanProfilesCfg())
+}
+
+func setFanProfilesConfig(ctx *gin.Context) {
+	var profiles config.FanProfiles
+	if err := ctx.ShouldBindJSON(&profiles); err != nil {
+		replayError(ctx, err)
+		return
+	}
+	err := driver.SetFanProfilesConfig(&profiles)
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, nil)
+	}
+}
+
+func getFanAutoTune(ctx *gin.Context) {
+	status, err := driver.GetFanAutoTune(fanName(ctx))
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, status)
+	}
+}
+
+func startFanAutoTune(ctx *gin.Context) {
+	err := driver.StartFanAutoTune(fanName(ctx))
 	if err != nil {
 		replayError(ctx, err)
 	} else {
@@ -212,6 +418,12 @@ func getDisplayCfg(ctx *gin.Context) {
 	replaySuccess(ctx, config.GetSH1106Cfg())
 }
 
+func getDisplayStatus(ctx *gin.Context) {
+	replaySuccess(ctx, gin.H{
+		"health": driver.GetDisplayHealth(),
+	})
+}
+
 func setDisplayCfg(ctx *gin.Context) {
 	var displayCfg config.SH1106Config
 	if err := ctx.ShouldBindJSON(&displayCfg); err != nil {
@@ -225,3 +437,262 @@ func setDisplayCfg(ctx *gin.Context) {
 		replaySuccess(ctx, nil)
 	}
 }
+
+func getUpsStatus(ctx *gin.Context) {
+	replaySuccess(ctx, driver.GetUpsStatus())
+}
+
+func getUpsConfig(ctx *gin.Context) {
+	replaySuccess(ctx, config.GetUpsCfg())
+}
+
+func setUpsConfig(ctx *gin.Context) {
+	var upsCfg config.UPS
+	if err := ctx.ShouldBindJSON(&upsCfg); err != nil {
+		replayError(ctx, err)
+		return
+	}
+	err := driver.SetUpsConfig(&upsCfg)
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, nil)
+	}
+}
+
+func getProtectStatus(ctx *gin.Context) {
+	replaySuccess(ctx, driver.GetProtectStatus())
+}
+
+func getProtectConfig(ctx *gin.Context) {
+	replaySuccess(ctx, config.GetProtectCfg())
+}
+
+func setProtectConfig(ctx *gin.Context) {
+	var protectCfg config.Protect
+	if err := ctx.ShouldBindJSON(&protectCfg); err != nil {
+		replayError(ctx, err)
+		return
+	}
+	err := driver.SetProtectConfig(&protectCfg)
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, nil)
+	}
+}
+
+func getRtcStatus(ctx *gin.Context) {
+	status, err := driver.GetRtcStatus()
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, status)
+	}
+}
+
+func getThrottle(ctx *gin.Context) {
+	status, err := utils.GetThrottled()
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, status)
+	}
+}
+
+type SystemPowerQuery struct {
+	Action string `json:"action" validate:"oneof=reboot shutdown"`
+	// empty asks for a confirmation token, which is sent back to run the action
+	Token string `json:"token"`
+}
+
+func systemPower(ctx *gin.Context) {
+	var query SystemPowerQuery
+	if err := ctx.ShouldBindJSON(&query); err != nil {
+		replayError(ctx, err)
+		return
+	}
+	if err := config.Validate(&query); err != nil {
+		replayError(ctx, err)
+		return
+	}
+	if query.Token == "" {
+		token, err := driver.NewPowerToken(query.Action)
+		if err != nil {
+			replayError(ctx, err)
+		} else {
+			replaySuccess(ctx, token)
+		}
+		return
+	}
+	err := driver.ConfirmPower(query.Action, query.Token)
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, nil)
+	}
+}
+
+func getLedStatus(ctx *gin.Context) {
+	replaySuccess(ctx, driver.GetLedStatus())
+}
+
+type LedOverrideQuery struct {
+	Pattern string `json:"pattern" validate:"required"`
+	// seconds, 0 keeps the override until it is cleared
+	Duration int `json:"duration" validate:"gte=0"`
+}
+
+func setLedOverride(ctx *gin.Context) {
+	var query LedOverrideQuery
+	if err := ctx.ShouldBindJSON(&query); err != nil {
+		replayError(ctx, err)
+		return
+	}
+	if err := config.Validate(&query); err != nil {
+		replayError(ctx, err)
+		return
+	}
+	err := driver.SetLedOverride(ctx.Param("name"), query.Pattern, time.Second*time.Duration(query.Duration))
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, nil)
+	}
+}
+
+func clearLedOverride(ctx *gin.Context) {
+	err := driver.ClearLedOverride(ctx.Param("name"))
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, nil)
+	}
+}
+
+func getBuzzerConfig(ctx *gin.Context) {
+	replaySuccess(ctx, config.GetBuzzerCfg())
+}
+
+func setBuzzerConfig(ctx *gin.Context) {
+	var buzzerCfg config.Buzzer
+	if err := ctx.ShouldBindJSON(&buzzerCfg); err != nil {
+		replayError(ctx, err)
+		return
+	}
+	err := driver.SetBuzzerConfig(&buzzerCfg)
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, nil)
+	}
+}
+
+type BuzzerPlayQuery struct {
+	// RTTTL or the name of a preset
+	Tone string `json:"tone" validate:"required"`
+}
+
+func playBuzzer(ctx *gin.Context) {
+	var query BuzzerPlayQuery
+	if err := ctx.ShouldBindJSON(&query); err != nil {
+		replayError(ctx, err)
+		return
+	}
+	if err := config.Validate(&query); err != nil {
+		replayError(ctx, err)
+		return
+	}
+	err := driver.PlayBuzzer(query.Tone)
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, nil)
+	}
+}
+
+func getSensors(ctx *gin.Context) {
+	sensors, err := driver.GetSensors()
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, sensors)
+	}
+}
+
+func getW1Config(ctx *gin.Context) {
+	replaySuccess(ctx, config.GetW1Cfg())
+}
+
+func setW1Config(ctx *gin.Context) {
+	var w1Cfg config.W1
+	if err := ctx.ShouldBindJSON(&w1Cfg); err != nil {
+		replayError(ctx, err)
+		return
+	}
+	err := config.SetW1Cfg(&w1Cfg)
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, nil)
+	}
+}
+
+func getGpioStatus(ctx *gin.Context) {
+	replaySuccess(ctx, driver.GetGpioStatus())
+}
+
+type GpioSetQuery struct {
+	// level of an output pin
+	Value bool `json:"value"`
+	// duty of a pwm pin
+	Duty uint32 `json:"duty" validate:"lte=100"`
+}
+
+func setGpio(ctx *gin.Context) {
+	pin, err := strconv.Atoi(ctx.Param("pin"))
+	if err != nil {
+		replayError(ctx, fmt.Errorf("invalid pin %q", ctx.Param("pin")))
+		return
+	}
+	var query GpioSetQuery
+	if err = ctx.ShouldBindJSON(&query); err != nil {
+		replayError(ctx, err)
+		return
+	}
+	if err = config.Validate(&query); err != nil {
+		replayError(ctx, err)
+		return
+	}
+	err = driver.SetGpio(pin, query.Value, query.Duty)
+	if err != nil {
+		replayError(ctx, err)
+	} else {
+		replaySuccess(ctx, nil)
+	}
+}
+
+// a comment line this often keeps proxies from dropping an idle stream
+const gpioKeepAlive = 30 * time.Second
+
+// gpioEvents streams the edges of the input pins as server-sent events
+func gpioEvents(ctx *gin.Context) {
+	events, cancel := driver.SubscribeGpio()
+	defer cancel()
+	keepAlive := time.NewTicker(gpioKeepAlive)
+	defer keepAlive.Stop()
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Stream(func(w io.Writer) bool {
+		select {
+		case event := <-events:
+			ctx.SSEvent("edge", event)
+			return true
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keepalive\n\n")
+			return err == nil
+		case <-ctx.Request.Context().Done():
+			return false
+		}
+	})
+}
@@ -28,7 +28,11 @@ func Run(server net.Listener) error {
 	}), gin.Recovery())
 	go checkTokenExpire()
 	initApi(engine.Group("/api", LoginMiddleware, SettingMiddleware))
+	// a stream would hold the setting lock for as long as it is open
+	engine.GET("/api/gpio/events", LoginMiddleware, gpioEvents)
 	engine.POST("/api/login", doLogin)
+	// probed by the watchdog, needs no login
+	engine.GET("/api/health", health)
 	web.Init(engine, isLogin, logout)
 	return engine.RunListener(server)
 }
@@ -0,0 +1,144 @@
+// Package button turns the level of a GPIO push button into debounced
+// click, double click and long press events.
+package button
+
+import (
+	"context"
+	"fmt"
+	"picp/gpio"
+	"time"
+)
+
+type Event int
+
+const (
+	Click Event = iota
+	DoubleClick
+	LongPress
+)
+
+var eventString = []string{"click", "double_click", "long_press"}
+
+func (e Event) String() string {
+	if int(e) >= len(eventString) {
+		return fmt.Sprintf("unknown(%d)", e)
+	}
+	return eventString[e]
+}
+
+// Detector is fed with the raw pressed state and reports events. With a
+// zero DoubleClick window a click is reported right on release, otherwise
+// only once the window passed without a second press. A zero LongPress
+// disables long presses.
+type Detector struct {
+	Debounce    time.Duration
+	LongPress   time.Duration
+	DoubleClick time.Duration
+
+	raw          bool
+	rawSince     time.Time
+	pressed      bool
+	pressAt      time.Time
+	longFired    bool
+	clickPending bool
+	releaseAt    time.Time
+}
+
+// Update takes the raw pressed state sampled at now.
+func (d *Detector) Update(raw bool, now time.Time) []Event {
+	if raw != d.raw {
+		d.raw = raw
+		d.rawSince = now
+	}
+	var events []Event
+	if d.raw != d.pressed && now.Sub(d.rawSince) >= d.Debounce {
+		d.pressed = d.raw
+		if d.pressed {
+			d.pressAt = now
+			d.longFired = false
+		} else if !d.longFired {
+			switch {
+			case d.DoubleClick <= 0:
+				events = append(events, Click)
+			case d.clickPending:
+				d.clickPending = false
+				events = append(events, DoubleClick)
+			default:
+				d.clickPending = true
+				d.releaseAt = now
+			}
+		}
+	}
+	if d.pressed && !d.longFired && d.LongPress > 0 && now.Sub(d.pressAt) >= d.LongPress {
+		d.longFired = true
+		// a click followed by a long press reports both
+		if d.clickPending {
+			d.clickPending = false
+			events = append(events, Click)
+		}
+		events = append(events, LongPress)
+	}
+	if d.clickPending && !d.pressed && now.Sub(d.releaseAt) >= d.DoubleClick {
+		d.clickPending = false
+		events = append(events, Click)
+	}
+	return events
+}
+
+// Next returns how long until Update may report something without an input
+// change, zero when nothing is pending.
+func (d *Detector) Next(now time.Time) time.Duration {
+	var next time.Duration
+	wait := func(at time.Time) {
+		remain := at.Sub(now)
+		if remain <= 0 {
+			remain = time.Millisecond
+		}
+		if next == 0 || remain < next {
+			next = remain
+		}
+	}
+	if d.raw != d.pressed {
+		wait(d.rawSince.Add(d.Debounce))
+	}
+	if d.pressed && !d.longFired && d.LongPress > 0 {
+		wait(d.pressAt.Add(d.LongPress))
+	}
+	if d.clickPending && !d.pressed {
+		wait(d.releaseAt.Add(d.DoubleClick))
+	}
+	return next
+}
+
+// idleWait bounds a single Wait so ctx is checked regularly
+const idleWait = 200 * time.Millisecond
+
+// Input is the part of a gpio.Line the detector needs, the line must have
+// edge detection on both edges
+type Input interface {
+	Get() (bool, error)
+	Wait(timeout time.Duration) (gpio.Event, bool, error)
+}
+
+// Watch feeds d from in and calls fn with every event until ctx is done or
+// in fails.
+func Watch(ctx context.Context, in Input, d *Detector, fn func(Event)) error {
+	for ctx.Err() == nil {
+		pressed, err := in.Get()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, event := range d.Update(pressed, now) {
+			fn(event)
+		}
+		timeout := d.Next(now)
+		if timeout == 0 || timeout > idleWait {
+			timeout = idleWait
+		}
+		if _, _, err = in.Wait(timeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package button
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type sample struct {
+	at      int
+	pressed bool
+}
+
+func TestDetector(t *testing.T) {
+	tests := []struct {
+		name        string
+		doubleClick int
+		samples     []sample
+		want        []Event
+	}{
+		{
+			name:    "bounce ignored",
+			samples: []sample{{0, true}, {5, false}, {10, true}, {15, false}, {100, false}},
+		},
+		{
+			name:    "click on release",
+			samples: []sample{{0, true}, {40, true}, {200, false}, {240, false}},
+			want:    []Event{Click},
+		},
+		{
+			name:        "click after window",
+			doubleClick: 300,
+			samples:     []sample{{0, true}, {40, true}, {200, false}, {240, false}, {500, false}, {560, false}},
+			want:        []Event{Click},
+		},
+		{
+			name:        "double click",
+			doubleClick: 300,
+			samples:     []sample{{0, true}, {40, true}, {100, false}, {140, false}, {300, true}, {340, true}, {400, false}, {440, false}, {1000, false}},
+			want:        []Event{DoubleClick},
+		},
+		{
+			name:        "two clicks",
+			doubleClick: 300,
+			samples:     []sample{{0, true}, {40, true}, {100, false}, {140, false}, {500, false}, {600, true}, {640, true}, {700, false}, {740, false}, {1100, false}},
+			want:        []Event{Click, Click},
+		},
+		{
+			name:        "long press",
+			doubleClick: 300,
+			samples:     []sample{{0, true}, {40, true}, {1000, true}, {1040, true}, {3000, false}, {3040, false}, {4000, false}},
+			want:        []Event{LongPress},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Detector{
+				Debounce:    30 * time.Millisecond,
+				LongPress:   time.Second,
+				DoubleClick: time.Duration(tt.doubleClick) * time.Millisecond,
+			}
+			start := time.Now()
+			var got []Event
+			for _, s := range tt.samples {
+				got = append(got, d.Update(s.pressed, start.Add(time.Duration(s.at)*time.Millisecond))...)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package button
+
+import (
+	"context"
+	"fmt"
+	"picp/gpio"
+	"time"
+)
+
+// quarterStep is indexed by the previous and the new AB state, a change of
+// both lines at once was missed in between and counts nothing
+var quarterStep = [16]int{
+	0, 1, -1, 0,
+	-1, 0, 0, 1,
+	1, 0, 0, -1,
+	0, -1, 1, 0,
+}
+
+// Encoder decodes the A and B lines of a quadrature rotary encoder into
+// detent steps, positive clockwise. Detents closer together than FastTurn
+// count up to Acceleration steps, growing the faster the knob is turned.
+type Encoder struct {
+	// quarter steps between two detents, 4 for most encoders
+	StepsPerDetent int
+	FastTurn       time.Duration
+	Acceleration   int
+
+	started    bool
+	state      int
+	count      int
+	lastDetent time.Time
+}
+
+func encoderState(a, b bool) int {
+	state := 0
+	if a {
+		state |= 2
+	}
+	if b {
+		state |= 1
+	}
+	return state
+}
+
+// Update takes the levels of both lines sampled at now and returns the steps
+// turned since the previous call.
+func (e *Encoder) Update(a, b bool, now time.Time) int {
+	state := encoderState(a, b)
+	if !e.started {
+		e.started = true
+		e.state = state
+		return 0
+	}
+	e.count += quarterStep[e.state<<2|state]
+	e.state = state
+	perDetent := max(e.StepsPerDetent, 1)
+	if e.count > -perDetent && e.count < perDetent {
+		return 0
+	}
+	direction := 1
+	if e.count < 0 {
+		direction = -1
+	}
+	e.count = 0
+	steps := e.accelerate(now)
+	e.lastDetent = now
+	return direction * steps
+}
+
+func (e *Encoder) accelerate(now time.Time) int {
+	if e.Acceleration <= 1 || e.FastTurn <= 0 || e.lastDetent.IsZero() {
+		return 1
+	}
+	interval := now.Sub(e.lastDetent)
+	if interval >= e.FastTurn {
+		return 1
+	}
+	return 1 + int(time.Duration(e.Acceleration-1)*(e.FastTurn-interval)/e.FastTurn)
+}
+
+// Lines is the part of a gpio.Group the encoder needs, A and B requested
+// together with edge detection on both edges so their edges keep their order
+type Lines interface {
+	Values() ([]bool, error)
+	Wait(timeout time.Duration) (event gpio.Event, index int, ok bool, err error)
+}
+
+// WatchEncoder feeds e from lines, A first and B second, and calls fn with
+// every turn until ctx is done or the lines fail.
+func WatchEncoder(ctx context.Context, lines Lines, e *Encoder, fn func(steps int)) error {
+	levels, err := lines.Values()
+	if err != nil {
+		return err
+	}
+	if len(levels) != 2 {
+		return fmt.Errorf("encoder needs 2 lines, got %d", len(levels))
+	}
+	e.Update(levels[0], levels[1], time.Now())
+	for ctx.Err() == nil {
+		event, index, ok, err := lines.Wait(idleWait)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		levels[index] = event.Rising
+		if steps := e.Update(levels[0], levels[1], event.Time); steps != 0 {
+			fn(steps)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package button
+
+import (
+	"context"
+	"picp/gpio"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// one detent clockwise and counterclockwise as AB states
+var (
+	clockwise        = []int{0b01, 0b11, 0b10, 0b00}
+	counterclockwise = []int{0b10, 0b11, 0b01, 0b00}
+)
+
+func TestEncoder(t *testing.T) {
+	tests := []struct {
+		name         string
+		acceleration int
+		// AB states, each interval ms after the previous one, detents 4ms
+		// apart count 1 + 3*46/50 steps with acceleration 4
+		states   []int
+		interval int
+		want     int
+	}{
+		{name: "clockwise", states: clockwise, interval: 100, want: 1},
+		{name: "counterclockwise", states: counterclockwise, interval: 100, want: -1},
+		{name: "half detent", states: clockwise[:2], interval: 100},
+		{name: "back and forth", states: []int{0b01, 0b00, 0b01, 0b00}, interval: 100},
+		{name: "missed state", states: []int{0b11, 0b00}, interval: 100},
+		{name: "two detents", states: append(append([]int{}, clockwise...), clockwise...), interval: 100, want: 2},
+		{name: "slow without acceleration", acceleration: 4, states: append(append([]int{}, clockwise...), clockwise...), interval: 100, want: 2},
+		{name: "fast with acceleration", acceleration: 4, states: append(append([]int{}, clockwise...), clockwise...), interval: 1, want: 1 + 3},
+		{name: "fast counterclockwise", acceleration: 4, states: append(append([]int{}, counterclockwise...), counterclockwise...), interval: 1, want: -1 - 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Encoder{StepsPerDetent: 4, FastTurn: 50 * time.Millisecond, Acceleration: tt.acceleration}
+			now := time.Unix(0, 0)
+			e.Update(false, false, now)
+			var got int
+			for _, state := range tt.states {
+				now = now.Add(time.Duration(tt.interval) * time.Millisecond)
+				got += e.Update(state&2 != 0, state&1 != 0, now)
+			}
+			if got != tt.want {
+				t.Errorf("steps = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeLines replays edges of A (index 0) and B (index 1), then ends ctx
+type fakeLines struct {
+	levels []bool
+	edges  []fakeEdge
+	cancel context.CancelFunc
+}
+
+type fakeEdge struct {
+	index  int
+	rising bool
+	at     time.Time
+}
+
+func (f *fakeLines) Values() ([]bool, error) {
+	return append([]bool(nil), f.levels...), nil
+}
+
+func (f *fakeLines) Wait(time.Duration) (gpio.Event, int, bool, error) {
+	if len(f.edges) == 0 {
+		f.cancel()
+		return gpio.Event{}, 0, false, nil
+	}
+	edge := f.edges[0]
+	f.edges = f.edges[1:]
+	return gpio.Event{Rising: edge.rising, Time: edge.at}, edge.index, true, nil
+}
+
+// edgesOf turns AB states starting from 00 into the edge of the line that
+// changed, interval apart
+func edgesOf(states []int, interval time.Duration) []fakeEdge {
+	var edges []fakeEdge
+	at := time.Unix(0, 0)
+	previous := 0
+	for _, state := range states {
+		at = at.Add(interval)
+		switch changed := previous ^ state; changed {
+		case 0b10:
+			edges = append(edges, fakeEdge{index: 0, rising: state&0b10 != 0, at: at})
+		case 0b01:
+			edges = append(edges, fakeEdge{index: 1, rising: state&0b01 != 0, at: at})
+		}
+		previous = state
+	}
+	return edges
+}
+
+func TestWatchEncoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		states   []int
+		interval time.Duration
+		want     []int
+	}{
+		{name: "clockwise", states: clockwise, interval: 100 * time.Millisecond, want: []int{1}},
+		{name: "counterclockwise", states: counterclockwise, interval: 100 * time.Millisecond, want: []int{-1}},
+		// edges 250µs apart keep their order, the detents 1ms apart by their own
+		// timestamps count 1 + 3*49/50 steps
+		{name: "fast turn", states: append(append([]int{}, clockwise...), clockwise...), interval: 250 * time.Microsecond, want: []int{1, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			lines := &fakeLines{levels: []bool{false, false}, edges: edgesOf(tt.states, tt.interval), cancel: cancel}
+			e := &Encoder{StepsPerDetent: 4, FastTurn: 50 * time.Millisecond, Acceleration: 4}
+			var got []int
+			err := WatchEncoder(ctx, lines, e, func(steps int) {
+				got = append(got, steps)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("turns = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
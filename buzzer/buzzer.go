@@ -0,0 +1,96 @@
+package buzzer
+
+import (
+	"context"
+	"errors"
+	"math"
+	"picp/pwm"
+	"time"
+)
+
+// silence between two notes so repeated notes can be told apart
+const noteGap = 10 * time.Millisecond
+
+// Player plays one melody after the other on a PWM output, the duty sets the
+// volume and 50 is the loudest a piezo gets.
+type Player struct {
+	out    pwm.Tuner
+	volume uint32
+	queue  chan Melody
+}
+
+// queueSize melodies wait while one is playing, more are dropped
+const queueSize = 2
+
+func NewPlayer(out pwm.Tuner, volume uint32) *Player {
+	return &Player{out: out, volume: min(volume, pwm.MaxDuty/2), queue: make(chan Melody, queueSize)}
+}
+
+// Play queues melody and returns false when the queue is full.
+func (p *Player) Play(melody Melody) bool {
+	select {
+	case p.queue <- melody:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run plays the queued melodies until ctx is done, the buzzer is silent
+// whenever nothing is playing.
+func (p *Player) Run(ctx context.Context) error {
+	if err := p.out.SetDuty(0); err != nil {
+		return err
+	}
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		var melody Melody
+		select {
+		case melody = <-p.queue:
+		case <-ctx.Done():
+			return nil
+		}
+		for _, note := range melody {
+			if err := p.note(ctx, timer, note); err != nil || ctx.Err() != nil {
+				return errors.Join(err, p.out.SetDuty(0))
+			}
+		}
+	}
+}
+
+// note plays a single note or rest, the output is silent afterwards
+func (p *Player) note(ctx context.Context, timer *time.Timer, note Note) error {
+	if note.Frequency == 0 {
+		wait(ctx, timer, note.Duration)
+		return nil
+	}
+	gap := min(noteGap, note.Duration/4)
+	err := p.out.SetFrequency(int(math.Round(note.Frequency)))
+	if err == nil {
+		err = p.out.SetDuty(p.volume)
+	}
+	if err != nil {
+		return err
+	}
+	wait(ctx, timer, note.Duration-gap)
+	if err = p.out.SetDuty(0); err != nil {
+		return err
+	}
+	wait(ctx, timer, gap)
+	return nil
+}
+
+// wait sleeps for d or until ctx is done
+func wait(ctx context.Context, timer *time.Timer, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	timer.Reset(d)
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		timer.Stop()
+	}
+}
@@ -0,0 +1,111 @@
+package buzzer
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	// b=60 makes a quarter note last a second
+	tests := []struct {
+		name    string
+		value   string
+		want    Melody
+		wantErr bool
+	}{
+		{name: "defaults", value: "x:d=4,o=4,b=60:a", want: Melody{{440, time.Second}}},
+		{name: "duration and octave", value: "x:d=4,o=4,b=60:8a5", want: Melody{{880, time.Second / 2}}},
+		{name: "sharp", value: "x:d=4,o=4,b=60:c#", want: Melody{{277.18, time.Second}}},
+		{name: "dotted", value: "x:d=4,o=4,b=60:a.", want: Melody{{440, 3 * time.Second / 2}}},
+		{name: "dot after octave", value: "x:d=4,o=4,b=60:a5.", want: Melody{{880, 3 * time.Second / 2}}},
+		{name: "rest", value: "x:d=4,o=4,b=60:2p", want: Melody{{0, 2 * time.Second}}},
+		{name: "no defaults", value: "x::a", want: Melody{{1760, time.Minute / 63}}},
+		{name: "several notes", value: "x:d=4,o=4,b=60: a , p ,a", want: Melody{{440, time.Second}, {0, time.Second}, {440, time.Second}}},
+		{name: "preset", value: "beep", want: Melody{{1760, time.Second / 8}}},
+		{name: "not a tone", value: "solid", wantErr: true},
+		{name: "no notes", value: "x:d=4:", wantErr: true},
+		{name: "bad note", value: "x::h", wantErr: true},
+		{name: "bad duration", value: "x::3a", wantErr: true},
+		{name: "bad octave", value: "x:o=9:a", wantErr: true},
+		{name: "unknown default", value: "x:v=1:a", wantErr: true},
+		{name: "trailing garbage", value: "x::a4x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Parse(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+			for i := range got {
+				if math.Abs(got[i].Frequency-tt.want[i].Frequency) > 0.01 || got[i].Duration != tt.want[i].Duration {
+					t.Errorf("Parse(%q)[%d] = %v, want %v", tt.value, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+	for name, preset := range Presets {
+		if err := Check(preset); err != nil {
+			t.Errorf("preset %s: %v", name, err)
+		}
+	}
+}
+
+type fakeTuner struct {
+	lock      sync.Mutex
+	frequency int
+	tones     []int
+}
+
+func (f *fakeTuner) SetDuty(duty uint32) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if duty > 0 {
+		f.tones = append(f.tones, f.frequency)
+	}
+	return nil
+}
+
+func (f *fakeTuner) SetFrequency(frequency int) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.frequency = frequency
+	return nil
+}
+
+func (f *fakeTuner) Close() error {
+	return nil
+}
+
+func TestPlayer(t *testing.T) {
+	out := &fakeTuner{}
+	player := NewPlayer(out, 30)
+	melody, err := Parse("x:d=32,o=4,b=900:a,p,a5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !player.Play(melody) {
+		t.Fatal("Play refused the first melody")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- player.Run(ctx)
+	}()
+	time.Sleep(melody.Duration() + 100*time.Millisecond)
+	cancel()
+	if err = <-done; err != nil {
+		t.Fatal("Run", err)
+	}
+	out.lock.Lock()
+	defer out.lock.Unlock()
+	if len(out.tones) != 2 || out.tones[0] != 440 || out.tones[1] != 880 {
+		t.Errorf("tones = %v, want [440 880]", out.tones)
+	}
+}
@@ -0,0 +1,175 @@
+// Package buzzer plays short tone sequences on a piezo buzzer driven by a
+// PWM output. Tones are written in RTTTL, the ringtone format of old phones:
+//
+//	name:d=4,o=5,b=120:8c6,8e6,4g6,p,2c7
+//
+// The defaults d (duration), o (octave) and b (beats per minute) are followed
+// by notes of [duration]note[#][.][octave], p is a rest.
+package buzzer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Note is a tone of Frequency Hz, a zero Frequency is a rest
+type Note struct {
+	Frequency float64
+	Duration  time.Duration
+}
+
+type Melody []Note
+
+// Presets can be used instead of writing RTTTL
+var Presets = map[string]string{
+	"beep":   "beep:d=16,o=6,b=120:a",
+	"click":  "click:d=32,o=7,b=240:c",
+	"alarm":  "alarm:d=8,o=6,b=180:a,p,a,p,a,p,a",
+	"warn":   "warn:d=8,o=5,b=140:e6,c6,e6,c6",
+	"low":    "low:d=4,o=5,b=100:g,e,c",
+	"lost":   "lost:d=8,o=6,b=160:c,g5,4c5",
+	"up":     "up:d=16,o=6,b=160:c,e,g,8c7",
+	"siren":  "siren:d=16,o=6,b=200:c,e,g,c7,g,e,c,e,g,c7,g,e",
+	"stall":  "stall:d=8,o=5,b=120:4c,p,4c,p,4c",
+	"notice": "notice:d=8,o=6,b=140:e,g",
+}
+
+// semitones above c of the note letters
+var noteSemitone = map[byte]int{'c': 0, 'd': 2, 'e': 4, 'f': 5, 'g': 7, 'a': 9, 'b': 11}
+
+var validDuration = map[int]bool{1: true, 2: true, 4: true, 8: true, 16: true, 32: true, 64: true}
+
+// frequency of the note semitone above c in octave, a4 is 440 Hz
+func frequency(semitone, octave int) float64 {
+	return 440 * math.Pow(2, float64((octave-4)*12+semitone-9)/12)
+}
+
+// Parse reads RTTTL or the name of a preset.
+func Parse(value string) (Melody, error) {
+	if preset, ok := Presets[value]; ok {
+		value = preset
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return nil, errors.New("tone must be name:defaults:notes or a preset")
+	}
+	duration, octave, bpm := 4, 6, 63
+	for _, item := range strings.Split(parts[1], ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, v, ok := strings.Cut(item, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid tone default %q", item)
+		}
+		switch strings.TrimSpace(key) {
+		case "d":
+			if !validDuration[n] {
+				return nil, fmt.Errorf("invalid tone duration %d", n)
+			}
+			duration = n
+		case "o":
+			if n < 4 || n > 7 {
+				return nil, fmt.Errorf("tone octave %d out of range 4-7", n)
+			}
+			octave = n
+		case "b":
+			if n <= 0 || n > 900 {
+				return nil, fmt.Errorf("tone bpm %d out of range 1-900", n)
+			}
+			bpm = n
+		default:
+			return nil, fmt.Errorf("unknown tone default %q", item)
+		}
+	}
+	whole := 4 * time.Minute / time.Duration(bpm)
+	var melody Melody
+	for _, item := range strings.Split(parts[2], ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		note, err := parseNote(item, duration, octave, whole)
+		if err != nil {
+			return nil, err
+		}
+		melody = append(melody, note)
+	}
+	if len(melody) == 0 {
+		return nil, errors.New("tone has no notes")
+	}
+	return melody, nil
+}
+
+func parseNote(item string, duration, octave int, whole time.Duration) (Note, error) {
+	invalid := fmt.Errorf("invalid tone note %q", item)
+	i := 0
+	for i < len(item) && item[i] >= '0' && item[i] <= '9' {
+		i++
+	}
+	if i > 0 {
+		duration, _ = strconv.Atoi(item[:i])
+		if !validDuration[duration] {
+			return Note{}, invalid
+		}
+	}
+	if i == len(item) {
+		return Note{}, invalid
+	}
+	letter := item[i]
+	i++
+	semitone, ok := noteSemitone[letter]
+	if !ok && letter != 'p' {
+		return Note{}, invalid
+	}
+	if i < len(item) && item[i] == '#' {
+		semitone++
+		i++
+	}
+	dotted := false
+	if i < len(item) && item[i] == '.' {
+		dotted = true
+		i++
+	}
+	if i < len(item) && item[i] >= '4' && item[i] <= '7' {
+		octave = int(item[i] - '0')
+		i++
+	}
+	// some writers put the dot after the octave
+	if i < len(item) && item[i] == '.' {
+		dotted = true
+		i++
+	}
+	if i != len(item) {
+		return Note{}, invalid
+	}
+	note := Note{Duration: whole / time.Duration(duration)}
+	if dotted {
+		note.Duration += note.Duration / 2
+	}
+	if letter != 'p' {
+		note.Frequency = frequency(semitone, octave)
+	}
+	return note, nil
+}
+
+// Check reports whether value is a tone Parse accepts
+func Check(value string) error {
+	_, err := Parse(value)
+	return err
+}
+
+// Duration is how long the melody plays
+func (m Melody) Duration() time.Duration {
+	var total time.Duration
+	for _, note := range m {
+		total += note.Duration
+	}
+	return total
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"picp/logger"
+	"sort"
+	"strings"
+)
+
+const (
+	ButtonActionWifi       = "wifi"
+	ButtonActionNextPage   = "next_page"
+	ButtonActionQr         = "qr"
+	ButtonActionReboot     = "reboot"
+	ButtonActionShutdown   = "shutdown"
+	ButtonActionMenuUp     = "menu_up"
+	ButtonActionMenuDown   = "menu_down"
+	ButtonActionMenuSelect = "menu_select"
+	ButtonActionMenuBack   = "menu_back"
+	// ButtonActionScript is followed by the path of the script to run
+	ButtonActionScript = "script:"
+)
+
+var buttons []Button
+
+// Button is a [button.<name>] section, the timings are in milliseconds
+type Button struct {
+	Name   string `json:"name" ini:"-"`
+	Enable bool   `json:"enable" ini:"enable"`
+	Pin    int    `json:"pin" ini:"pin" validate:"gte=0,lt=255"`
+	// as_is keeps the pull set by the firmware or the device tree
+	Pull   string `json:"pull" ini:"pull" validate:"oneof=none up down as_is"`
+	Active string `json:"active" ini:"active" validate:"oneof=high low"`
+	// level changes shorter than this are ignored
+	Debounce  int `json:"debounce" ini:"debounce" validate:"gte=0"`
+	LongPress int `json:"long_press" ini:"long_press" validate:"gte=0"`
+	// window for the second press of a double click, 0 disables double
+	// clicks so a click is reported right on release
+	DoubleClick   int    `json:"double_click" ini:"double_click" validate:"gte=0"`
+	OnClick       string `json:"on_click" ini:"on_click" validate:"omitempty,button_action"`
+	OnDoubleClick string `json:"on_double_click" ini:"on_double_click" validate:"omitempty,button_action"`
+	OnLongPress   string `json:"on_long_press" ini:"on_long_press" validate:"omitempty,button_action"`
+}
+
+func DefaultButton(name string) Button {
+	return Button{
+		Name:        name,
+		Enable:      true,
+		Pull:        "up",
+		Active:      "low",
+		Debounce:    30,
+		LongPress:   1000,
+		DoubleClick: 300,
+	}
+}
+
+func (c *Button) NeedValidate() bool {
+	return c.Enable
+}
+
+// IsButtonAction reports whether action is one a button can be bound to
+func IsButtonAction(action string) bool {
+	switch action {
+	case ButtonActionWifi, ButtonActionNextPage, ButtonActionQr, ButtonActionReboot, ButtonActionShutdown,
+		ButtonActionMenuUp, ButtonActionMenuDown, ButtonActionMenuSelect, ButtonActionMenuBack:
+		return true
+	}
+	path, ok := strings.CutPrefix(action, ButtonActionScript)
+	return ok && path != ""
+}
+
+func initButton() {
+	pins := map[int]string{}
+	for _, section := range rootCfg.SectionStrings() {
+		name, ok := strings.CutPrefix(section, "button.")
+		if !ok {
+			continue
+		}
+		if !fanNamePattern.MatchString(name) {
+			logger.Fatalf("invalid button name %q", name)
+		}
+		button := DefaultButton(name)
+		if err := StrictMapTo(rootCfg.Section(section), &button); err != nil {
+			logger.Fatalf("button config error: %s", err)
+		}
+		if !button.Enable {
+			continue
+		}
+		if other, ok := pins[button.Pin]; ok {
+			logger.Fatalf("button %s and %s use the same pin %d", other, name, button.Pin)
+		}
+		pins[button.Pin] = name
+		buttons = append(buttons, button)
+	}
+	sort.Slice(buttons, func(i, j int) bool {
+		return buttons[i].Name < buttons[j].Name
+	})
+}
+
+// GetButtons returns the enabled buttons
+func GetButtons() []Button {
+	cfgLock.RLock()
+	defer cfgLock.RUnlock()
+	return append([]Button(nil), buttons...)
+}
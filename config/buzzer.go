@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"github.com/go-ini/ini"
+	"picp/logger"
+	"picp/pwm"
+	"strings"
+	"time"
+)
+
+var buzzerCfg = Buzzer{
+	Backend:      pwm.BackendSysfs,
+	Pin:          16,
+	PwmChannel:   1,
+	Volume:       50,
+	Repeat:       300,
+	Overheat:     true,
+	OverheatTone: "alarm",
+	FanStall:     true,
+	FanStallTone: "stall",
+	WifiLost:     true,
+	WifiLostTone: "lost",
+	UpsLow:       true,
+	UpsLowTone:   "low",
+	ButtonTone:   "click",
+}
+
+// Buzzer is the [buzzer] section, every event has an enable flag and a tone,
+// either RTTTL or a preset name
+type Buzzer struct {
+	cfg        *ini.Section `ini:"-"`
+	Enable     bool         `json:"enable" ini:"enable"`
+	Backend    string       `json:"backend" ini:"backend" validate:"oneof=rpio sysfs software"`
+	Pin        int          `json:"pin" ini:"pin" validate:"gte=0,lt=255"`
+	PwmChip    int          `json:"pwm_chip" ini:"pwm_chip" validate:"gte=0"`
+	PwmChannel int          `json:"pwm_channel" ini:"pwm_channel" validate:"gte=0"`
+	// pwm duty while a tone plays, 50 is the loudest
+	Volume int `json:"volume" ini:"volume" validate:"gte=1,lte=50"`
+	// "22:00-07:00" keeps the buzzer silent overnight, empty never
+	QuietHours string `json:"quiet_hours" ini:"quiet_hours" validate:"omitempty,quiet_hours"`
+	// seconds between repeats while an alert lasts, 0 plays it once
+	Repeat       int    `json:"repeat" ini:"repeat" validate:"gte=0"`
+	Overheat     bool   `json:"overheat" ini:"overheat"`
+	OverheatTone string `json:"overheat_tone" ini:"overheat_tone" validate:"tone"`
+	FanStall     bool   `json:"fan_stall" ini:"fan_stall"`
+	FanStallTone string `json:"fan_stall_tone" ini:"fan_stall_tone" validate:"tone"`
+	WifiLost     bool   `json:"wifi_lost" ini:"wifi_lost"`
+	WifiLostTone string `json:"wifi_lost_tone" ini:"wifi_lost_tone" validate:"tone"`
+	UpsLow       bool   `json:"ups_low" ini:"ups_low"`
+	UpsLowTone   string `json:"ups_low_tone" ini:"ups_low_tone" validate:"tone"`
+	Button       bool   `json:"button" ini:"button"`
+	ButtonTone   string `json:"button_tone" ini:"button_tone" validate:"tone"`
+}
+
+func (c *Buzzer) NeedValidate() bool {
+	return c.Enable
+}
+
+// ParseQuietHours reads "hh:mm-hh:mm" into minutes after midnight, the end
+// may be before the start to span midnight
+func ParseQuietHours(value string) (start, end int, err error) {
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("quiet hours %q are not hh:mm-hh:mm", value)
+	}
+	start, err = parseClock(from)
+	if err == nil {
+		end, err = parseClock(to)
+	}
+	return start, end, err
+}
+
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// IsQuiet reports whether now falls into the quiet hours
+func (c *Buzzer) IsQuiet(now time.Time) bool {
+	if c.QuietHours == "" {
+		return false
+	}
+	start, end, err := ParseQuietHours(c.QuietHours)
+	if err != nil || start == end {
+		return false
+	}
+	minute := now.Hour()*60 + now.Minute()
+	if start < end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// checkBackend must be called with cfgLock held
+func (c *Buzzer) checkBackend() error {
+	if !c.Enable || c.Backend != pwm.BackendRpio {
+		return nil
+	}
+	if err := checkRpioPwm("buzzer", c.Pin); err != nil {
+		return err
+	}
+	if name, ok := rpioChannelUser(c.Pin, ""); ok {
+		return fmt.Errorf("buzzer pin %d shares hardware pwm channel %d with fan %s", c.Pin, pwm.HardwareChannel(c.Pin), name)
+	}
+	return nil
+}
+
+// checkPin keeps the buzzer off the pins in reserved, a "buzzer" entry is the
+// buzzer being replaced
+func (c *Buzzer) checkPin(reserved map[int]string) error {
+	if !c.Enable || c.Backend == pwm.BackendSysfs {
+		return nil
+	}
+	if owner, ok := reserved[c.Pin]; ok && owner != "buzzer" {
+		return fmt.Errorf("buzzer pin %d is used by %s", c.Pin, owner)
+	}
+	return nil
+}
+
+func initBuzzer() {
+	// the buzzer is still disabled here and left out
+	reserved := reservedPins()
+	var ok bool
+	buzzerCfg.cfg, ok = Get("buzzer")
+	if ok {
+		if err := StrictMapTo(buzzerCfg.cfg, &buzzerCfg); err != nil {
+			logger.Fatalf("buzzer config error: %s", err)
+		}
+	}
+	if err := buzzerCfg.checkBackend(); err != nil {
+		logger.Fatalf("buzzer config error: %s", err)
+	}
+	if err := buzzerCfg.checkPin(reserved); err != nil {
+		logger.Fatalf("buzzer config error: %s", err)
+	}
+}
+
+func GetBuzzerCfg() Buzzer {
+	cfgLock.RLock()
+	defer cfgLock.RUnlock()
+	return buzzerCfg
+}
+
+func SetBuzzerCfg(cfg *Buzzer) (err error) {
+	err = Validate(cfg)
+	if err != nil {
+		return
+	}
+	cfgLock.Lock()
+	defer cfgLock.Unlock()
+	if err = cfg.checkBackend(); err != nil {
+		return
+	}
+	if err = cfg.checkPin(reservedPins()); err != nil {
+		return
+	}
+	if cfg.Enable && cfg.Backend != pwm.BackendSysfs {
+		if err = checkUserGpioPins("buzzer", cfg.Pin); err != nil {
+			return
+		}
+	}
+	old := buzzerCfg
+	defer func() {
+		if err != nil {
+			buzzerCfg = old
+		}
+	}()
+	// the section stays, everything else comes from cfg
+	section := buzzerCfg.cfg
+	buzzerCfg = *cfg
+	buzzerCfg.cfg = section
+	err = buzzerCfg.cfg.ReflectFrom(&buzzerCfg)
+	if err == nil {
+		return SaveCfg()
+	}
+	return
+}
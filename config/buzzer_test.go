@@ -0,0 +1,62 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuzzerIsQuiet(t *testing.T) {
+	tests := []struct {
+		name  string
+		hours string
+		time  string
+		want  bool
+	}{
+		{name: "none", hours: "", time: "03:00", want: false},
+		{name: "overnight late", hours: "22:00-07:00", time: "23:15", want: true},
+		{name: "overnight early", hours: "22:00-07:00", time: "06:59", want: true},
+		{name: "overnight end", hours: "22:00-07:00", time: "07:00", want: false},
+		{name: "overnight day", hours: "22:00-07:00", time: "12:00", want: false},
+		{name: "same day", hours: "12:30-14:00", time: "13:00", want: true},
+		{name: "same day before", hours: "12:30-14:00", time: "12:29", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, err := time.Parse("15:04", tt.time)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := Buzzer{QuietHours: tt.hours}
+			if got := cfg.IsQuiet(now); got != tt.want {
+				t.Errorf("IsQuiet(%s) = %v, want %v", tt.time, got, tt.want)
+			}
+		})
+	}
+	for _, hours := range []string{"22:00", "25:00-07:00", "22:00-7"} {
+		if _, _, err := ParseQuietHours(hours); err == nil {
+			t.Errorf("ParseQuietHours(%q) accepted", hours)
+		}
+	}
+}
+
+func TestBuzzerCheckPin(t *testing.T) {
+	reserved := map[int]string{16: "led status", 19: "buzzer"}
+	tests := []struct {
+		name    string
+		cfg     Buzzer
+		wantErr bool
+	}{
+		{name: "free", cfg: Buzzer{Enable: true, Backend: "software", Pin: 20}},
+		{name: "led pin", cfg: Buzzer{Enable: true, Backend: "software", Pin: 16}, wantErr: true},
+		{name: "current buzzer", cfg: Buzzer{Enable: true, Backend: "rpio", Pin: 19}},
+		{name: "sysfs", cfg: Buzzer{Enable: true, Backend: "sysfs", Pin: 16}},
+		{name: "disabled", cfg: Buzzer{Backend: "software", Pin: 16}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.checkPin(reserved); (err != nil) != tt.wantErr {
+				t.Errorf("checkPin() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -4,13 +4,17 @@ import (
 	"github.com/go-ini/ini"
 	"go.uber.org/zap"
 	"picp/logger"
+	"picp/thermal"
 	"sync"
+	"time"
 )
 
 var Common = common{
 	LogLevel:     "info",
 	BindAddr:     ":8888",
 	CookieMaxAge: 168,
+	GpioBackend:  "auto",
+	CmdCache:     5,
 }
 var cfgLock sync.RWMutex
 
@@ -22,6 +26,12 @@ type common struct {
 	User         string       `ini:"user"`
 	Password     string       `ini:"password"`
 	CookieMaxAge int          `ini:"cookie_max_age" validate:"gt=0"`
+	// auto tries the gpio character device first and falls back to rpio
+	GpioBackend string `ini:"gpio_backend" validate:"oneof=auto cdev rpio"`
+	// gpiochip device or label of the cdev backend, empty finds the Raspberry Pi header chip
+	GpioChip string `ini:"gpio_chip"`
+	// seconds a cmd: temperature source is reused before it runs again
+	CmdCache int `ini:"cmd_cache" validate:"gte=0"`
 }
 
 func (c *common) GetCookieMaxAge() int {
@@ -37,7 +47,9 @@ func initCommon() {
 			logger.Fatal("map common config failed", zap.Error(err))
 		}
 	}
+	thermal.SetCommandCache(time.Duration(Common.CmdCache) * time.Second)
 }
+
 func SaveCfg() error {
 	return rootCfg.SaveTo(*cfgPath)
 }
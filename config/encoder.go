@@ -0,0 +1,111 @@
+package config
+
+import (
+	"picp/logger"
+	"sort"
+	"strings"
+)
+
+var encoders []Encoder
+
+// Encoder is an [encoder.<name>] section, a quadrature rotary encoder with an
+// optional push switch. Turning it pages the status display or, while the
+// menu is open, moves the cursor and adjusts values.
+type Encoder struct {
+	Name   string `json:"name" ini:"-"`
+	Enable bool   `json:"enable" ini:"enable"`
+	PinA   int    `json:"pin_a" ini:"pin_a" validate:"gte=0,lt=255"`
+	PinB   int    `json:"pin_b" ini:"pin_b" validate:"gte=0,lt=255,nefield=PinA"`
+	Pull   string `json:"pull" ini:"pull" validate:"oneof=none up down"`
+	// quarter steps between two detents
+	StepsPerDetent int  `json:"steps_per_detent" ini:"steps_per_detent" validate:"oneof=1 2 4"`
+	Reverse        bool `json:"reverse" ini:"reverse"`
+	// detents closer than fast_turn milliseconds count up to acceleration
+	// steps, 1 disables acceleration
+	FastTurn     int `json:"fast_turn" ini:"fast_turn" validate:"gte=0"`
+	Acceleration int `json:"acceleration" ini:"acceleration" validate:"gte=1,lte=100"`
+	// the push switch is active low with the same pull, -1 if not wired
+	SwitchPin     int    `json:"switch_pin" ini:"switch_pin" validate:"gte=-1,lt=255"`
+	OnClick       string `json:"on_click" ini:"on_click" validate:"omitempty,button_action"`
+	OnDoubleClick string `json:"on_double_click" ini:"on_double_click" validate:"omitempty,button_action"`
+	OnLongPress   string `json:"on_long_press" ini:"on_long_press" validate:"omitempty,button_action"`
+}
+
+func DefaultEncoder(name string) Encoder {
+	return Encoder{
+		Name:           name,
+		Enable:         true,
+		Pull:           "up",
+		StepsPerDetent: 4,
+		FastTurn:       60,
+		Acceleration:   5,
+		SwitchPin:      -1,
+		OnClick:        ButtonActionMenuSelect,
+		OnLongPress:    ButtonActionMenuBack,
+	}
+}
+
+func (c *Encoder) NeedValidate() bool {
+	return c.Enable
+}
+
+// SwitchButton is the push switch as a button, false when it is not wired
+func (c *Encoder) SwitchButton() (Button, bool) {
+	if c.SwitchPin < 0 {
+		return Button{}, false
+	}
+	b := DefaultButton(c.Name)
+	b.Pin = c.SwitchPin
+	b.Pull = c.Pull
+	b.OnClick = c.OnClick
+	b.OnDoubleClick = c.OnDoubleClick
+	b.OnLongPress = c.OnLongPress
+	if b.OnDoubleClick == "" {
+		b.DoubleClick = 0
+	}
+	return b, true
+}
+
+func initEncoder() {
+	pins := map[int]string{}
+	for _, button := range buttons {
+		pins[button.Pin] = "button." + button.Name
+	}
+	for _, section := range rootCfg.SectionStrings() {
+		name, ok := strings.CutPrefix(section, "encoder.")
+		if !ok {
+			continue
+		}
+		if !fanNamePattern.MatchString(name) {
+			logger.Fatalf("invalid encoder name %q", name)
+		}
+		encoder := DefaultEncoder(name)
+		if err := StrictMapTo(rootCfg.Section(section), &encoder); err != nil {
+			logger.Fatalf("encoder config error: %s", err)
+		}
+		if !encoder.Enable {
+			continue
+		}
+		used := []int{encoder.PinA, encoder.PinB}
+		if encoder.SwitchPin >= 0 {
+			used = append(used, encoder.SwitchPin)
+		}
+		for _, pin := range used {
+			if other, ok := pins[pin]; ok {
+				logger.Fatalf("%s and encoder.%s use the same pin %d", other, name, pin)
+			}
+			pins[pin] = "encoder." + name
+		}
+		encoders = append(encoders, encoder)
+	}
+	sort.Slice(encoders, func(i, j int) bool {
+		return encoders[i].Name < encoders[j].Name
+	})
+}
+
+// GetEncoders returns the enabled encoders
+func GetEncoders() []Encoder {
+	cfgLock.RLock()
+	defer cfgLock.RUnlock()
+	return append([]Encoder(nil), encoders...)
+}
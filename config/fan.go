@@ -1,68 +1,390 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"github.com/go-ini/ini"
+	"picp/gpio"
 	"picp/logger"
+	"picp/pwm"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 )
 
-var fan = FanChanelCfg{
+const (
+	FanModeHysteresis = "hysteresis"
+	FanModeCurve      = "curve"
+	FanModePid        = "pid"
+)
+
+const DefaultFanName = "default"
+
+var fanNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var defaultFan = FanChanelCfg{
 	Enable:  false,
 	Pin:     12,
+	Backend: pwm.BackendRpio,
+	Mode:    FanModeHysteresis,
 	Speed:   60,
 	MaxTemp: 50,
 	MinTemp: 45,
+	Source:  "cpu",
+	Curve: FanCurve{
+		{Temp: 45, Duty: 0},
+		{Temp: 50, Duty: 40},
+		{Temp: 60, Duty: 70},
+		{Temp: 70, Duty: 100},
+	},
+	CurveStr:     "45:0,50:40,60:70,70:100",
+	MinDuty:      30,
+	KickDuty:     100,
+	KickTime:     500,
+	RampRate:     5,
+	MaxDuty:      100,
+	Target:       50,
+	Kp:           8,
+	Ki:           0.2,
+	Kd:           4,
+	Interval:     3,
+	TachPin:      -1,
+	PulsesPerRev: 2,
+	StallTimeout: 10,
+	// curve mode only
+	StopHysteresis: 3,
 }
 
+type FanCurvePoint struct {
+	Temp float32 `json:"temp"`
+	Duty int     `json:"duty"`
+}
+
+// FanCurve is a list of points sorted by temperature, stored in ini as
+// "temp:duty,temp:duty"
+type FanCurve []FanCurvePoint
+
+func ParseFanCurve(value string) (FanCurve, error) {
+	var curve FanCurve
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		temp, duty, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid fan curve point %q", item)
+		}
+		t, err := strconv.ParseFloat(strings.TrimSpace(temp), 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fan curve temperature %q: %w", temp, err)
+		}
+		d, err := strconv.Atoi(strings.TrimSpace(duty))
+		if err != nil {
+			return nil, fmt.Errorf("invalid fan curve duty %q: %w", duty, err)
+		}
+		curve = append(curve, FanCurvePoint{Temp: float32(t), Duty: d})
+	}
+	return curve, curve.Check()
+}
+
+func (c FanCurve) Check() error {
+	if len(c) < 2 {
+		return errors.New("fan curve needs at least 2 points")
+	}
+	for i, point := range c {
+		if point.Duty < 0 || point.Duty > 100 {
+			return fmt.Errorf("fan curve duty %d out of range 0-100", point.Duty)
+		}
+		if i > 0 && point.Temp <= c[i-1].Temp {
+			return errors.New("fan curve temperatures must be increasing")
+		}
+	}
+	return nil
+}
+
+func (c FanCurve) String() string {
+	items := make([]string, 0, len(c))
+	for _, point := range c {
+		items = append(items, strconv.FormatFloat(float64(point.Temp), 'f', -1, 32)+":"+strconv.Itoa(point.Duty))
+	}
+	return strings.Join(items, ",")
+}
+
+var fans = map[string]*FanChanelCfg{}
+
 type FanChanelCfg struct {
-	cfg     *ini.Section `ini:"-"`
-	Enable  bool         `json:"enable" ini:"enable,omitempty"`
-	Pin     int          `json:"pin" ini:"pin,omitempty" validate:"oneof=12 13 40 41 45 18 19"`
-	Speed   int          `json:"speed" ini:"speed,omitempty" validate:"gt=0,lte=100"`
-	MinTemp float32      `json:"min_temp" ini:"min_temp,omitempty" validate:"gte=0,ltfield=MaxTemp"`
-	MaxTemp float32      `json:"max_temp" ini:"max_temp,omitempty" validate:"gte=0"`
+	cfg          *ini.Section `ini:"-"`
+	Name         string       `json:"name" ini:"-"`
+	Enable       bool         `json:"enable" ini:"enable,omitempty"`
+	Pin          int          `json:"pin" ini:"pin,omitempty" validate:"gte=0,lt=255"`
+	Backend      string       `json:"backend" ini:"backend,omitempty" validate:"omitempty,oneof=rpio sysfs software"`
+	PwmChip      int          `json:"pwm_chip" ini:"pwm_chip" validate:"gte=0"`
+	PwmChannel   int          `json:"pwm_channel" ini:"pwm_channel" validate:"gte=0"`
+	Frequency    int          `json:"frequency" ini:"frequency" validate:"gte=0"`
+	Mode         string       `json:"mode" ini:"mode,omitempty" validate:"omitempty,oneof=hysteresis curve pid"`
+	Speed        int          `json:"speed" ini:"speed,omitempty" validate:"gt=0,lte=100"`
+	MinTemp      float32      `json:"min_temp" ini:"min_temp,omitempty" validate:"gte=0,ltfield=MaxTemp"`
+	MaxTemp      float32      `json:"max_temp" ini:"max_temp,omitempty" validate:"gte=0"`
+	Source       string       `json:"source" ini:"source,omitempty" validate:"temp_source"`
+	Curve        FanCurve     `json:"curve" ini:"-"`
+	CurveStr     string       `json:"-" ini:"curve,omitempty"`
+	MinDuty      int          `json:"min_duty" ini:"min_duty" validate:"gte=0,lte=100"`
+	KickDuty     int          `json:"kick_duty" ini:"kick_duty" validate:"gte=0,lte=100"`
+	KickTime     int          `json:"kick_time" ini:"kick_time" validate:"gte=0"`
+	RampRate     float32      `json:"ramp_rate" ini:"ramp_rate" validate:"gte=0"`
+	MaxDuty      int          `json:"max_duty" ini:"max_duty,omitempty" validate:"gtefield=MinDuty,lte=100"`
+	Target       float32      `json:"target" ini:"target,omitempty" validate:"gt=0"`
+	Kp           float32      `json:"kp" ini:"kp" validate:"gte=0"`
+	Ki           float32      `json:"ki" ini:"ki" validate:"gte=0"`
+	Kd           float32      `json:"kd" ini:"kd" validate:"gte=0"`
+	Interval     int          `json:"interval" ini:"interval,omitempty" validate:"gt=0"`
+	TachPin      int          `json:"tach_pin" ini:"tach_pin" validate:"gte=-1,lt=255"`
+	PulsesPerRev int          `json:"pulses_per_rev" ini:"pulses_per_rev,omitempty" validate:"gt=0"`
+	StallTimeout int          `json:"stall_timeout" ini:"stall_timeout,omitempty" validate:"gt=0"`
+	// degrees below the first curve point a running fan waits before stopping
+	StopHysteresis float32 `json:"stop_hysteresis" ini:"stop_hysteresis" validate:"gte=0"`
 }
 
 func (c *FanChanelCfg) NeedValidate() bool {
 	return c.Enable
 }
 
+func (c *FanChanelCfg) checkCurve() error {
+	if c.Enable && c.Mode == FanModeCurve {
+		return c.Curve.Check()
+	}
+	return nil
+}
+
+func (c *FanChanelCfg) checkBackend() error {
+	if !c.Enable {
+		return nil
+	}
+	switch c.Backend {
+	case "", pwm.BackendRpio:
+		if c.Frequency > 0 {
+			if err := pwm.CheckRpioFrequency(c.Frequency); err != nil {
+				return fmt.Errorf("fan %s: %w", c.Name, err)
+			}
+		}
+		return checkRpioPwm("fan "+c.Name, c.Pin)
+	case pwm.BackendSoftware:
+		if c.Frequency > pwm.MaxSoftwareFrequency {
+			return fmt.Errorf("fan %s software pwm frequency must not exceed %d", c.Name, pwm.MaxSoftwareFrequency)
+		}
+	}
+	return nil
+}
+
+// checkRpioPwm reports a pin without hardware pwm, and once the driver opened
+// gpio a board without the registers rpio drives
+func checkRpioPwm(owner string, pin int) error {
+	if !pwm.IsHardwarePin(pin) {
+		return fmt.Errorf("%s pin %d has no hardware pwm, use one of %v or another backend", owner, pin, pwm.HardwarePins)
+	}
+	if gpio.Backend() != "" && !gpio.RpioMapped() {
+		return fmt.Errorf("%s: rpio pwm needs the registers of a Pi 1-4, use the sysfs or software backend on this board", owner)
+	}
+	return nil
+}
+
+func (c *FanChanelCfg) usesRpio() bool {
+	return c.Backend == "" || c.Backend == pwm.BackendRpio
+}
+
+// rpioChannelUser returns the enabled fan other than except driving the
+// hardware pwm channel of pin, it must be called with cfgLock held
+func rpioChannelUser(pin int, except string) (string, bool) {
+	channel := pwm.HardwareChannel(pin)
+	for name, fan := range fans {
+		if name != except && fan.Enable && fan.usesRpio() && pwm.HardwareChannel(fan.Pin) == channel {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// usedPins returns the gpios the channel drives, sysfs pwm does not use Pin
+func (c *FanChanelCfg) usedPins() []int {
+	var pins []int
+	if c.Backend != pwm.BackendSysfs {
+		pins = append(pins, c.Pin)
+	}
+	if c.TachPin >= 0 {
+		pins = append(pins, c.TachPin)
+	}
+	return pins
+}
+
+func (c *FanChanelCfg) clone() FanChanelCfg {
+	ret := *c
+	ret.Curve = append(FanCurve(nil), c.Curve...)
+	return ret
+}
+
+// fanSectionName maps the default channel to [fan] and others to [fan.<name>],
+// keys missing in a [fan.<name>] section take the defaults, not [fan]
+func fanSectionName(name string) string {
+	if name == DefaultFanName {
+		return "fan"
+	}
+	return "fan." + name
+}
+
 func initFan() {
-	var ok bool
-	fan.cfg, ok = Get("fan")
-	if ok {
-		if err := StrictMapTo(fan.cfg, &fan); err != nil {
+	names := []string{DefaultFanName}
+	for _, section := range rootCfg.SectionStrings() {
+		if name, ok := strings.CutPrefix(section, "fan."); ok {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if !fanNamePattern.MatchString(name) {
+			logger.Fatalf("fan config error: invalid channel name %q", name)
+		}
+		channel := defaultFan.clone()
+		channel.Name = name
+		var ok bool
+		channel.cfg, ok = Get(fanSectionName(name))
+		if ok {
+			if err := StrictMapTo(ownSection(channel.cfg), &channel); err != nil {
+				logger.Fatalf("fan config error: %s", err)
+			}
+			curve, err := ParseFanCurve(channel.CurveStr)
+			if err != nil && channel.Enable && channel.Mode == FanModeCurve {
+				logger.Fatalf("fan %s config error: %s", name, err)
+			}
+			channel.Curve = curve
+		}
+		if err := channel.checkBackend(); err != nil {
 			logger.Fatalf("fan config error: %s", err)
 		}
+		fans[name] = &channel
 	}
 }
 
-func GetFanCfg() FanChanelCfg {
+// checkFans runs once every section with pins is loaded
+func checkFans() {
+	for _, channel := range fans {
+		if err := checkFanPins(channel); err != nil {
+			logger.Fatalf("fan config error: %s", err)
+		}
+	}
+}
+
+// checkFanPins must be called with cfgLock held
+func checkFanPins(cfg *FanChanelCfg) error {
+	if !cfg.Enable {
+		return nil
+	}
+	if cfg.usesRpio() {
+		if name, ok := rpioChannelUser(cfg.Pin, cfg.Name); ok {
+			return fmt.Errorf("fan %s pin %d shares hardware pwm channel %d with fan %s", cfg.Name, cfg.Pin, pwm.HardwareChannel(cfg.Pin), name)
+		}
+	}
+	for name, other := range fans {
+		if name == cfg.Name || !other.Enable {
+			continue
+		}
+		for _, pin := range other.usedPins() {
+			for _, used := range cfg.usedPins() {
+				if pin == used {
+					return fmt.Errorf("fan %s pin %d is already used by fan %s", cfg.Name, pin, name)
+				}
+			}
+		}
+	}
+	reserved := reservedPins()
+	for _, pin := range cfg.usedPins() {
+		if owner, ok := reserved[pin]; ok && owner != "fan "+cfg.Name {
+			return fmt.Errorf("fan %s pin %d is already used by %s", cfg.Name, pin, owner)
+		}
+	}
+	return checkUserGpioPins("fan "+cfg.Name, cfg.usedPins()...)
+}
+
+// DefaultFanChannelCfg returns the settings a new channel starts from
+func DefaultFanChannelCfg() FanChanelCfg {
+	return defaultFan.clone()
+}
+
+func GetFanNames() []string {
 	cfgLock.RLock()
 	defer cfgLock.RUnlock()
-	return fan
+	names := make([]string, 0, len(fans))
+	for name := range fans {
+		if name != DefaultFanName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{DefaultFanName}, names...)
 }
 
-func SetFanCfg(cfg *FanChanelCfg) (err error) {
+func GetFanChannelCfg(name string) (FanChanelCfg, bool) {
+	cfgLock.RLock()
+	defer cfgLock.RUnlock()
+	channel, ok := fans[name]
+	if !ok {
+		return FanChanelCfg{}, false
+	}
+	return channel.clone(), true
+}
+
+func GetFanCfg() FanChanelCfg {
+	cfg, _ := GetFanChannelCfg(DefaultFanName)
+	return cfg
+}
+
+func SetFanChannelCfg(name string, cfg *FanChanelCfg) (err error) {
+	if !fanNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid fan name %q", name)
+	}
 	err = Validate(cfg)
 	if err != nil {
 		return
 	}
+	err = cfg.checkCurve()
+	if err != nil {
+		return
+	}
 	cfgLock.Lock()
 	defer cfgLock.Unlock()
-	old := fan
-	defer func() {
-		if err != nil {
-			fan = old
-		}
-	}()
-	fan.Enable = cfg.Enable
-	fan.Pin = cfg.Pin
-	fan.Speed = cfg.Speed
-	fan.MinTemp = cfg.MinTemp
-	fan.MaxTemp = cfg.MaxTemp
-	err = fan.cfg.ReflectFrom(&fan)
-	if err == nil {
-		return SaveCfg()
+	updated := cfg.clone()
+	updated.Name = name
+	updated.CurveStr = updated.Curve.String()
+	err = updated.checkBackend()
+	if err != nil {
+		return
+	}
+	err = checkFanPins(&updated)
+	if err != nil {
+		return
+	}
+	old, ok := fans[name]
+	if ok {
+		updated.cfg = old.cfg
+	} else {
+		updated.cfg = rootCfg.Section(fanSectionName(name))
+	}
+	err = updated.cfg.ReflectFrom(&updated)
+	if err != nil {
+		return
+	}
+	fans[name] = &updated
+	err = SaveCfg()
+	if err != nil {
+		if ok {
+			fans[name] = old
+		} else {
+			delete(fans, name)
+		}
 	}
 	return
 }
+
+func SetFanCfg(cfg *FanChanelCfg) error {
+	return SetFanChannelCfg(DefaultFanName, cfg)
+}
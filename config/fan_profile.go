@@ -0,0 +1,337 @@
+package config
+
+import (
+	"fmt"
+	"github.com/go-ini/ini"
+	"picp/logger"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fanProfileKeys are the channel settings a profile may change, everything
+// else needs the channel to be restarted
+var fanProfileKeys = []string{"mode", "source", "speed", "min_temp", "max_temp", "curve",
+	"min_duty", "max_duty", "ramp_rate", "target", "kp", "ki", "kd"}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+var fanProfiles = map[string]*FanProfile{}
+
+var fanSchedule = FanSchedule{}
+
+// FanProfile is a [fan_profile.<name>] section overriding the control
+// settings of the channels it applies to
+type FanProfile struct {
+	Name string `json:"name"`
+	// empty applies to all channels
+	Channels []string          `json:"channels"`
+	Settings map[string]string `json:"settings"`
+}
+
+func (p *FanProfile) AppliesTo(channel string) bool {
+	if len(p.Channels) == 0 {
+		return true
+	}
+	for _, name := range p.Channels {
+		if name == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply overrides the settings of cfg and validates the result
+func (p *FanProfile) Apply(cfg *FanChanelCfg) error {
+	section, err := ini.Empty().NewSection("fan_profile." + p.Name)
+	if err != nil {
+		return err
+	}
+	for key, value := range p.Settings {
+		if _, err = section.NewKey(key, value); err != nil {
+			return err
+		}
+	}
+	if err = section.StrictMapTo(cfg); err != nil {
+		return fmt.Errorf("fan profile %s: %w", p.Name, err)
+	}
+	if value, ok := p.Settings["curve"]; ok {
+		if cfg.Curve, err = ParseFanCurve(value); err != nil {
+			return fmt.Errorf("fan profile %s: %w", p.Name, err)
+		}
+	}
+	if err = Validate(cfg); err != nil {
+		return fmt.Errorf("fan profile %s: %w", p.Name, err)
+	}
+	return cfg.checkCurve()
+}
+
+func (p *FanProfile) check() error {
+	if !fanNamePattern.MatchString(p.Name) {
+		return fmt.Errorf("invalid fan profile name %q", p.Name)
+	}
+	for key := range p.Settings {
+		if !containsString(fanProfileKeys, key) {
+			return fmt.Errorf("fan profile %s can not change %s", p.Name, key)
+		}
+	}
+	cfg := DefaultFanChannelCfg()
+	cfg.Enable = true
+	return p.Apply(&cfg)
+}
+
+func (p *FanProfile) clone() FanProfile {
+	ret := *p
+	ret.Channels = append([]string(nil), p.Channels...)
+	ret.Settings = make(map[string]string, len(p.Settings))
+	for key, value := range p.Settings {
+		ret.Settings[key] = value
+	}
+	return ret
+}
+
+// FanScheduleRule switches to Profile every selected weekday at Hour:Minute
+type FanScheduleRule struct {
+	Days    [7]bool
+	Hour    int
+	Minute  int
+	Profile string
+}
+
+// ParseFanScheduleRule parses "<days> <hh:mm> <profile>", days is a comma
+// free list like mon-fri, sat+sun, daily or a single day
+func ParseFanScheduleRule(value string) (rule FanScheduleRule, err error) {
+	fields := strings.Fields(value)
+	if len(fields) != 3 {
+		return rule, fmt.Errorf("invalid fan schedule rule %q, want \"<days> <hh:mm> <profile>\"", value)
+	}
+	if err = parseWeekdays(fields[0], &rule.Days); err != nil {
+		return
+	}
+	at, err := time.Parse("15:04", fields[1])
+	if err != nil {
+		return rule, fmt.Errorf("invalid fan schedule time %q", fields[1])
+	}
+	rule.Hour, rule.Minute = at.Hour(), at.Minute()
+	rule.Profile = fields[2]
+	return
+}
+
+func parseWeekdays(value string, days *[7]bool) error {
+	if value == "daily" {
+		for i := range days {
+			days[i] = true
+		}
+		return nil
+	}
+	for _, item := range strings.Split(value, "+") {
+		from, to, isRange := strings.Cut(item, "-")
+		start := indexOfString(weekdays, from)
+		end := start
+		if isRange {
+			end = indexOfString(weekdays, to)
+		}
+		if start < 0 || end < 0 {
+			return fmt.Errorf("invalid fan schedule days %q", value)
+		}
+		for day := start; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == end {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// last returns the latest time at or before now the rule switched
+func (r *FanScheduleRule) last(now time.Time) time.Time {
+	for back := 0; back <= 7; back++ {
+		day := now.AddDate(0, 0, -back)
+		at := time.Date(day.Year(), day.Month(), day.Day(), r.Hour, r.Minute, 0, 0, now.Location())
+		if r.Days[at.Weekday()] && !at.After(now) {
+			return at
+		}
+	}
+	return time.Time{}
+}
+
+type FanSchedule struct {
+	cfg    *ini.Section `ini:"-"`
+	Enable bool         `json:"enable" ini:"enable"`
+	// profile used before the first rule matches, empty for the channel settings
+	Default string            `json:"default" ini:"default"`
+	Rules   []string          `json:"rules" ini:"rules"`
+	rules   []FanScheduleRule `ini:"-"`
+}
+
+// ProfileAt returns the profile the schedule selects at now
+func (s *FanSchedule) ProfileAt(now time.Time) string {
+	profile := s.Default
+	var latest time.Time
+	for i := range s.rules {
+		if at := s.rules[i].last(now); at.After(latest) {
+			latest = at
+			profile = s.rules[i].Profile
+		}
+	}
+	return profile
+}
+
+func (s *FanSchedule) parse(profiles map[string]*FanProfile) error {
+	s.rules = nil
+	if s.Default != "" && profiles[s.Default] == nil {
+		return fmt.Errorf("fan schedule default profile %s not found", s.Default)
+	}
+	for _, value := range s.Rules {
+		rule, err := ParseFanScheduleRule(value)
+		if err != nil {
+			return err
+		}
+		if profiles[rule.Profile] == nil {
+			return fmt.Errorf("fan schedule profile %s not found", rule.Profile)
+		}
+		s.rules = append(s.rules, rule)
+	}
+	return nil
+}
+
+func (s *FanSchedule) clone() FanSchedule {
+	ret := *s
+	ret.Rules = append([]string(nil), s.Rules...)
+	ret.rules = append([]FanScheduleRule(nil), s.rules...)
+	return ret
+}
+
+type FanProfiles struct {
+	Profiles []FanProfile `json:"profiles"`
+	Schedule FanSchedule  `json:"schedule"`
+}
+
+func initFanProfile() {
+	for _, name := range rootCfg.SectionStrings() {
+		name, ok := strings.CutPrefix(name, "fan_profile.")
+		if !ok {
+			continue
+		}
+		section := rootCfg.Section("fan_profile." + name)
+		profile := &FanProfile{Name: name, Settings: section.KeysHash()}
+		if _, ok := profile.Settings["channels"]; ok {
+			profile.Channels = section.Key("channels").Strings(",")
+			delete(profile.Settings, "channels")
+		}
+		if err := profile.check(); err != nil {
+			logger.Fatalf("fan profile config error: %s", err)
+		}
+		fanProfiles[name] = profile
+	}
+	var ok bool
+	fanSchedule.cfg, ok = Get("fan_schedule")
+	if ok {
+		if err := StrictMapTo(fanSchedule.cfg, &fanSchedule); err != nil {
+			logger.Fatalf("fan schedule config error: %s", err)
+		}
+	}
+	if err := fanSchedule.parse(fanProfiles); err != nil {
+		logger.Fatalf("fan schedule config error: %s", err)
+	}
+}
+
+func GetFanProfile(name string) (FanProfile, bool) {
+	cfgLock.RLock()
+	defer cfgLock.RUnlock()
+	profile, ok := fanProfiles[name]
+	if !ok {
+		return FanProfile{}, false
+	}
+	return profile.clone(), true
+}
+
+func GetFanSchedule() FanSchedule {
+	cfgLock.RLock()
+	defer cfgLock.RUnlock()
+	return fanSchedule.clone()
+}
+
+func GetFanProfilesCfg() FanProfiles {
+	cfgLock.RLock()
+	defer cfgLock.RUnlock()
+	ret := FanProfiles{Schedule: fanSchedule.clone()}
+	names := make([]string, 0, len(fanProfiles))
+	for name := range fanProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ret.Profiles = append(ret.Profiles, fanProfiles[name].clone())
+	}
+	return ret
+}
+
+func SetFanProfilesCfg(cfg *FanProfiles) (err error) {
+	profiles := make(map[string]*FanProfile, len(cfg.Profiles))
+	for i := range cfg.Profiles {
+		profile := cfg.Profiles[i].clone()
+		if err = profile.check(); err != nil {
+			return
+		}
+		if profiles[profile.Name] != nil {
+			return fmt.Errorf("duplicate fan profile %s", profile.Name)
+		}
+		profiles[profile.Name] = &profile
+	}
+	schedule := cfg.Schedule.clone()
+	if err = schedule.parse(profiles); err != nil {
+		return
+	}
+	cfgLock.Lock()
+	defer cfgLock.Unlock()
+	oldProfiles, oldSchedule := fanProfiles, fanSchedule
+	defer func() {
+		if err != nil {
+			fanProfiles, fanSchedule = oldProfiles, oldSchedule
+		}
+	}()
+	for name := range fanProfiles {
+		rootCfg.DeleteSection("fan_profile." + name)
+	}
+	for name, profile := range profiles {
+		var section *ini.Section
+		section, err = rootCfg.NewSection("fan_profile." + name)
+		if err != nil {
+			return
+		}
+		if len(profile.Channels) > 0 {
+			if _, err = section.NewKey("channels", strings.Join(profile.Channels, ",")); err != nil {
+				return
+			}
+		}
+		for _, key := range fanProfileKeys {
+			if value, ok := profile.Settings[key]; ok {
+				if _, err = section.NewKey(key, value); err != nil {
+					return
+				}
+			}
+		}
+	}
+	schedule.cfg = rootCfg.Section("fan_schedule")
+	fanProfiles, fanSchedule = profiles, schedule
+	err = fanSchedule.cfg.ReflectFrom(&fanSchedule)
+	if err == nil {
+		return SaveCfg()
+	}
+	return
+}
+
+func containsString(values []string, value string) bool {
+	return indexOfString(values, value) >= 0
+}
+
+func indexOfString(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
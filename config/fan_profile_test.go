@@ -0,0 +1,77 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFanScheduleProfileAt(t *testing.T) {
+	schedule := FanSchedule{
+		Default: "normal",
+		Rules:   []string{"mon-fri 07:30 normal", "mon-fri 22:00 silent", "sat+sun 10:00 performance", "sun 23:00 silent"},
+	}
+	profiles := map[string]*FanProfile{"normal": {}, "silent": {}, "performance": {}}
+	if err := schedule.parse(profiles); err != nil {
+		t.Fatal("parse", err)
+	}
+	tests := []struct {
+		name string
+		time string
+		want string
+	}{
+		{name: "monday morning", time: "2024-01-01 07:30", want: "normal"},
+		{name: "monday before work", time: "2024-01-01 07:29", want: "silent"},
+		{name: "friday night", time: "2024-01-05 23:00", want: "silent"},
+		{name: "saturday early", time: "2024-01-06 09:00", want: "silent"},
+		{name: "saturday", time: "2024-01-06 12:00", want: "performance"},
+		{name: "sunday night", time: "2024-01-07 23:30", want: "silent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, err := time.ParseInLocation("2006-01-02 15:04", tt.time, time.Local)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := schedule.ProfileAt(now); got != tt.want {
+				t.Errorf("ProfileAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFanScheduleRule(t *testing.T) {
+	tests := []struct {
+		value   string
+		days    string
+		wantErr bool
+	}{
+		{value: "daily 08:00 normal", days: "1111111"},
+		{value: "fri-mon 08:00 normal", days: "1100011"},
+		{value: "tue+thu 8:05 normal", days: "0010100"},
+		{value: "mon 25:00 normal", wantErr: true},
+		{value: "monday 08:00 normal", wantErr: true},
+		{value: "mon 08:00", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			rule, err := ParseFanScheduleRule(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFanScheduleRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			days := ""
+			for _, day := range rule.Days {
+				if day {
+					days += "1"
+				} else {
+					days += "0"
+				}
+			}
+			if days != tt.days {
+				t.Errorf("ParseFanScheduleRule() days = %s, want %s", days, tt.days)
+			}
+		})
+	}
+}
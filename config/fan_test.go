@@ -0,0 +1,69 @@
+package config
+
+import (
+	"github.com/go-ini/ini"
+	"picp/pwm"
+	"testing"
+)
+
+func TestOwnSection(t *testing.T) {
+	f, err := ini.Load([]byte("[fan]\nenable=true\npin=12\ntach_pin=6\nmode=curve\n\n[fan.b]\nbackend=software\npin=5\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Section("fan.b").HasKey("tach_pin") {
+		t.Fatal("go-ini no longer looks keys up in the parent section")
+	}
+	channel := defaultFan.clone()
+	if err = ownSection(f.Section("fan.b")).StrictMapTo(&channel); err != nil {
+		t.Fatal(err)
+	}
+	if channel.Enable || channel.Pin != 5 || channel.TachPin != -1 || channel.Mode != FanModeHysteresis {
+		t.Errorf("fan.b inherited from fan: enable %v, pin %d, tach_pin %d, mode %s", channel.Enable, channel.Pin, channel.TachPin, channel.Mode)
+	}
+}
+
+func TestCheckFanPinsPwmChannel(t *testing.T) {
+	fans = map[string]*FanChanelCfg{DefaultFanName: {Name: DefaultFanName, Enable: true, Pin: 12, Backend: pwm.BackendRpio, TachPin: -1}}
+	defer func() {
+		fans = map[string]*FanChanelCfg{}
+	}()
+	tests := []struct {
+		name    string
+		cfg     FanChanelCfg
+		wantErr bool
+	}{
+		{name: "other channel", cfg: FanChanelCfg{Name: "b", Enable: true, Pin: 13, Backend: pwm.BackendRpio, TachPin: -1}},
+		{name: "same channel", cfg: FanChanelCfg{Name: "b", Enable: true, Pin: 18, Backend: pwm.BackendRpio, TachPin: -1}, wantErr: true},
+		{name: "default backend", cfg: FanChanelCfg{Name: "b", Enable: true, Pin: 18, TachPin: -1}, wantErr: true},
+		{name: "software", cfg: FanChanelCfg{Name: "b", Enable: true, Pin: 18, Backend: pwm.BackendSoftware, TachPin: -1}},
+		{name: "replaces itself", cfg: FanChanelCfg{Name: DefaultFanName, Enable: true, Pin: 18, Backend: pwm.BackendRpio, TachPin: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkFanPins(&tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("checkFanPins() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckBackendRpioFrequency(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency int
+		wantErr   bool
+	}{
+		{name: "default", frequency: 0},
+		{name: "lowest", frequency: pwm.MinRpioFrequency},
+		{name: "too low", frequency: pwm.MinRpioFrequency - 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := FanChanelCfg{Name: "a", Enable: true, Pin: 12, Backend: pwm.BackendRpio, Frequency: tt.frequency}
+			if err := c.checkBackend(); (err != nil) != tt.wantErr {
+				t.Errorf("checkBackend() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"fmt"
+	"picp/logger"
+	"picp/pwm"
+	"sort"
+	"strings"
+)
+
+const (
+	GpioModeInput  = "input"
+	GpioModeOutput = "output"
+	GpioModePwm    = "pwm"
+)
+
+var userGpios []UserGpio
+
+// UserGpio is a [gpio.<name>] section, the pins the api may read and drive.
+// Nothing else is reachable over the api, and pins used by the rest of the
+// config can not be listed.
+type UserGpio struct {
+	Name   string `json:"name" ini:"-"`
+	Enable bool   `json:"enable" ini:"enable"`
+	Pin    int    `json:"pin" ini:"pin" validate:"gte=0,lt=255"`
+	Mode   string `json:"mode" ini:"mode" validate:"oneof=input output pwm"`
+	Active string `json:"active" ini:"active" validate:"oneof=high low"`
+	// inputs only
+	Pull string `json:"pull" ini:"pull" validate:"oneof=none up down"`
+	// level of an output and duty of a pwm pin after start
+	Initial     bool `json:"initial" ini:"initial"`
+	InitialDuty int  `json:"initial_duty" ini:"initial_duty" validate:"gte=0,lte=100"`
+	// software pwm frequency in Hz
+	Frequency int `json:"frequency" ini:"frequency" validate:"gt=0,lte=1000"`
+}
+
+func DefaultUserGpio(name string) UserGpio {
+	return UserGpio{
+		Name:      name,
+		Enable:    true,
+		Mode:      GpioModeInput,
+		Active:    "high",
+		Pull:      "none",
+		Frequency: 100,
+	}
+}
+
+func (c *UserGpio) NeedValidate() bool {
+	return c.Enable
+}
+
+// i2cBusPins returns SDA and SCL of an i2c bus on the header
+func i2cBusPins(bus int) []int {
+	switch bus {
+	case 0:
+		return []int{0, 1}
+	case 1:
+		return []int{2, 3}
+	}
+	return nil
+}
+
+// spiBusPins returns MISO, MOSI, SCLK and the chip select of a spi bus, the
+// overlay takes all of them even when a device only needs MOSI
+func spiBusPins(bus, cs int) []int {
+	var pins, selects []int
+	switch bus {
+	case 0:
+		pins, selects = []int{9, 10, 11}, []int{8, 7}
+	case 1:
+		pins, selects = []int{19, 20, 21}, []int{18, 17, 16}
+	default:
+		return nil
+	}
+	if cs >= 0 && cs < len(selects) {
+		pins = append(pins, selects[cs])
+	}
+	return pins
+}
+
+// reservedPins maps the gpios the rest of the config uses to their owner
+func reservedPins() map[int]string {
+	pins := map[int]string{}
+	reserve := func(owner string, used ...int) {
+		for _, pin := range used {
+			if pin >= 0 {
+				pins[pin] = owner
+			}
+		}
+	}
+	for name, fan := range fans {
+		if fan.Enable {
+			reserve("fan "+name, fan.usedPins()...)
+		}
+	}
+	if SH1106.Enable {
+		reserve("display", SH1106.usedPins()...)
+	}
+	if rtcCfg.Enable {
+		reserve("rtc", rtcCfg.usedPins()...)
+	}
+	if w1Cfg.Enable {
+		reserve("1-wire", w1Cfg.Pin)
+	}
+	if wifiCfg.Enable {
+		reserve("wifi", wifiCfg.Pin)
+	}
+	for _, button := range buttons {
+		reserve("button "+button.Name, button.Pin)
+	}
+	for _, encoder := range encoders {
+		reserve("encoder "+encoder.Name, encoder.PinA, encoder.PinB, encoder.SwitchPin)
+	}
+	for _, led := range leds {
+		if led.Sysfs == "" {
+			reserve("led "+led.Name, led.Pin)
+		}
+	}
+	if buzzerCfg.Enable && buzzerCfg.Backend != pwm.BackendSysfs {
+		reserve("buzzer", buzzerCfg.Pin)
+	}
+	if upsCfg.Enable {
+		reserve("ups", upsCfg.usedPins()...)
+	}
+	if ws2812Cfg.Enable {
+		reserve("ws2812", ws2812Cfg.usedPins()...)
+	}
+	return pins
+}
+
+// userGpioOwner returns the [gpio.<name>] section listing pin, if any. The
+// user pins only change during Init.
+func userGpioOwner(pin int) (string, bool) {
+	for _, g := range userGpios {
+		if g.Pin == pin {
+			return g.Name, true
+		}
+	}
+	return "", false
+}
+
+func initGpio() {
+	reserved := reservedPins()
+	for _, section := range rootCfg.SectionStrings() {
+		name, ok := strings.CutPrefix(section, "gpio.")
+		if !ok {
+			continue
+		}
+		if !fanNamePattern.MatchString(name) {
+			logger.Fatalf("invalid gpio name %q", name)
+		}
+		g := DefaultUserGpio(name)
+		if err := StrictMapTo(rootCfg.Section(section), &g); err != nil {
+			logger.Fatalf("gpio config error: %s", err)
+		}
+		if !g.Enable {
+			continue
+		}
+		if owner, ok := reserved[g.Pin]; ok {
+			logger.Fatalf("gpio.%s pin %d is used by %s", name, g.Pin, owner)
+		}
+		reserved[g.Pin] = "gpio." + name
+		userGpios = append(userGpios, g)
+	}
+	sort.Slice(userGpios, func(i, j int) bool {
+		return userGpios[i].Pin < userGpios[j].Pin
+	})
+}
+
+// GetUserGpios returns the enabled user pins sorted by pin
+func GetUserGpios() []UserGpio {
+	cfgLock.RLock()
+	defer cfgLock.RUnlock()
+	return append([]UserGpio(nil), userGpios...)
+}
+
+func checkUserGpioPins(owner string, pins ...int) error {
+	for _, pin := range pins {
+		if name, ok := userGpioOwner(pin); ok {
+			return fmt.Errorf("%s pin %d is reserved by gpio.%s", owner, pin, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package config
+
+import "testing"
+
+func TestCheckFanPinsUserGpio(t *testing.T) {
+	userGpios = []UserGpio{{Name: "relay", Pin: 26}}
+	defer func() {
+		userGpios = nil
+	}()
+	tests := []struct {
+		name    string
+		cfg     FanChanelCfg
+		wantErr bool
+	}{
+		{name: "free", cfg: FanChanelCfg{Name: "a", Enable: true, Pin: 12, TachPin: -1}},
+		{name: "pwm pin", cfg: FanChanelCfg{Name: "a", Enable: true, Pin: 26, TachPin: -1}, wantErr: true},
+		{name: "tach pin", cfg: FanChanelCfg{Name: "a", Enable: true, Pin: 12, TachPin: 26}, wantErr: true},
+		{name: "disabled", cfg: FanChanelCfg{Name: "a", Pin: 26, TachPin: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkFanPins(&tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("checkFanPins() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReservedPins(t *testing.T) {
+	display, rtc, ups, w1, strip, wifi, buzzer := SH1106, rtcCfg, upsCfg, w1Cfg, ws2812Cfg, wifiCfg, buzzerCfg
+	defer func() {
+		SH1106, rtcCfg, upsCfg, w1Cfg, ws2812Cfg, wifiCfg, buzzerCfg = display, rtc, ups, w1, strip, wifi, buzzer
+	}()
+	tests := []struct {
+		name  string
+		setup func()
+		want  map[int]string
+	}{
+		{name: "nothing enabled", setup: func() {}, want: map[int]string{}},
+		{
+			name:  "i2c display",
+			setup: func() { SH1106.Enable = true },
+			want:  map[int]string{2: "display", 3: "display"},
+		},
+		{
+			name: "spi1 display",
+			setup: func() {
+				SH1106.Enable = true
+				SH1106.Interface = "spi"
+				SH1106.SpiBus = 1
+				SH1106.SpiCs = 2
+			},
+			want: map[int]string{24: "display", 25: "display", 19: "display", 20: "display", 21: "display", 16: "display"},
+		},
+		{
+			name:  "rtc on bus 0",
+			setup: func() { rtcCfg.Enable = true; rtcCfg.Bus = 0 },
+			want:  map[int]string{0: "rtc", 1: "rtc"},
+		},
+		{
+			name:  "ups",
+			setup: func() { upsCfg.Enable = true; upsCfg.PowerPin = 6 },
+			want:  map[int]string{2: "ups", 3: "ups", 6: "ups"},
+		},
+		{
+			name:  "1-wire",
+			setup: func() { w1Cfg.Enable = true },
+			want:  map[int]string{4: "1-wire"},
+		},
+		{
+			name:  "1-wire off the header",
+			setup: func() { w1Cfg.Enable = true; w1Cfg.Pin = -1 },
+			want:  map[int]string{},
+		},
+		{
+			name:  "ws2812 on spi1",
+			setup: func() { ws2812Cfg.Enable = true; ws2812Cfg.SpiBus = 1 },
+			want:  map[int]string{19: "ws2812", 20: "ws2812", 21: "ws2812", 18: "ws2812"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SH1106, rtcCfg, upsCfg, w1Cfg, ws2812Cfg, wifiCfg, buzzerCfg = display, rtc, ups, w1, strip, wifi, buzzer
+			SH1106.Enable, rtcCfg.Enable, upsCfg.Enable, w1Cfg.Enable = false, false, false, false
+			ws2812Cfg.Enable, wifiCfg.Enable, buzzerCfg.Enable = false, false, false
+			tt.setup()
+			got := reservedPins()
+			if len(got) != len(tt.want) {
+				t.Errorf("reservedPins() = %v, want %v", got, tt.want)
+			}
+			for pin, owner := range tt.want {
+				if got[pin] != owner {
+					t.Errorf("pin %d owner = %q, want %q", pin, got[pin], owner)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckFanPinsReserved(t *testing.T) {
+	wifi := wifiCfg
+	buttons = []Button{{Name: "power", Pin: 17}}
+	defer func() {
+		wifiCfg, buttons = wifi, nil
+	}()
+	wifiCfg.Enable, wifiCfg.Pin = true, 5
+	tests := []struct {
+		name    string
+		cfg     FanChanelCfg
+		wantErr bool
+	}{
+		{name: "free", cfg: FanChanelCfg{Name: "a", Enable: true, Pin: 12, TachPin: 6}},
+		{name: "button pin", cfg: FanChanelCfg{Name: "a", Enable: true, Pin: 17, TachPin: -1}, wantErr: true},
+		{name: "wifi tach pin", cfg: FanChanelCfg{Name: "a", Enable: true, Pin: 12, TachPin: 5}, wantErr: true},
+		{name: "disabled", cfg: FanChanelCfg{Name: "a", Pin: 17, TachPin: 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkFanPins(&tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("checkFanPins() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
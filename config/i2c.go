@@ -3,19 +3,27 @@ package config
 import (
 	"errors"
 	"picp/go-i2c"
+	"time"
 )
 
 type IICConfig struct {
-	Enable bool `json:"enable" ini:"enable"`
-	Bus    int  `json:"bus" ini:"bus,omitempty" validate:"required,gte=0,lte=1"`
-	Addr   int  `json:"addr" ini:"addr,omitempty" validate:"required,gte=0,lte=254"`
+	Enable       bool `json:"enable" ini:"enable"`
+	Bus          int  `json:"bus" ini:"bus,omitempty" validate:"required,gte=0,lte=1"`
+	Addr         int  `json:"addr" ini:"addr,omitempty" validate:"required,gte=0,lte=254"`
+	Retries      int  `json:"retries" ini:"retries" validate:"gte=0,lte=10"`
+	RetryBackoff int  `json:"retry_backoff" ini:"retry_backoff" validate:"gte=0"`
 }
 
 var ErrorSensorDisabled = errors.New("sensor is disabled")
 
 func (i *IICConfig) Create() (*i2c.I2C, error) {
 	if i.Enable {
-		return i2c.NewI2C(uint8(i.Addr), i.Bus)
+		bus, err := i2c.NewI2C(uint8(i.Addr), i.Bus)
+		if err != nil {
+			return nil, err
+		}
+		bus.SetRetry(i.Retries, time.Millisecond*time.Duration(i.RetryBackoff))
+		return bus, nil
 	}
 	return nil, ErrorSensorDisabled
 }
@@ -8,9 +8,13 @@ import (
 	"github.com/go-playground/validator/v10"
 	"go.uber.org/zap"
 	"os"
+	"picp/buzzer"
+	"picp/led"
 	"picp/logger"
+	"picp/thermal"
 	"reflect"
 	"strings"
+	"syscall"
 )
 
 var vid *validator.Validate
@@ -31,7 +35,33 @@ func Init() {
 			return field.Name
 		}
 	})
-	var err error
+	err := vid.RegisterValidation("temp_source", func(fl validator.FieldLevel) bool {
+		return thermal.Check(fl.Field().String(), "w1") == nil
+	})
+	if err == nil {
+		err = vid.RegisterValidation("button_action", func(fl validator.FieldLevel) bool {
+			return IsButtonAction(fl.Field().String())
+		})
+	}
+	if err == nil {
+		err = vid.RegisterValidation("led_pattern", func(fl validator.FieldLevel) bool {
+			return led.Check(fl.Field().String()) == nil
+		})
+	}
+	if err == nil {
+		err = vid.RegisterValidation("tone", func(fl validator.FieldLevel) bool {
+			return buzzer.Check(fl.Field().String()) == nil
+		})
+	}
+	if err == nil {
+		err = vid.RegisterValidation("quiet_hours", func(fl validator.FieldLevel) bool {
+			_, _, err := ParseQuietHours(fl.Field().String())
+			return err == nil
+		})
+	}
+	if err != nil {
+		logger.Fatal("register validation failed", zap.Error(err))
+	}
 	rootCfg, err = ini.Load(*cfgPath)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -43,8 +73,22 @@ func Init() {
 	initLogger()
 	initCommon()
 	initSH1106()
+	initW1()
 	initFan()
+	initFanProfile()
 	initWifi()
+	initButton()
+	initEncoder()
+	initLed()
+	initBuzzer()
+	initWS2812()
+	initUps()
+	initRtc()
+	initProtect()
+	checkFans()
+	// last, user pins must not collide with anything above
+	initGpio()
+	initWatchdog()
 }
 
 func Save() error {
@@ -55,10 +99,41 @@ func Save() error {
 	return nil
 }
 
+// Flush waits for a save in progress and forces the config file and every
+// other pending write to disk, called before the system goes down
+func Flush() error {
+	cfgLock.Lock()
+	defer cfgLock.Unlock()
+	sh1106Lock.Lock()
+	defer sh1106Lock.Unlock()
+	f, err := os.Open(*cfgPath)
+	if err == nil {
+		err = f.Sync()
+		_ = f.Close()
+	} else if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	syscall.Sync()
+	if err != nil {
+		return fmt.Errorf("flush config failed: %w", err)
+	}
+	return nil
+}
+
 func Get(section string) (*ini.Section, bool) {
 	return rootCfg.Section(section), rootCfg.HasSection(section)
 }
 
+// ownSection copies the keys set in section itself, go-ini looks keys
+// missing in [a.b] up in [a]
+func ownSection(section *ini.Section) *ini.Section {
+	own := ini.Empty().Section(section.Name())
+	for _, key := range section.Keys() {
+		_, _ = own.NewKey(key.Name(), key.Value())
+	}
+	return own
+}
+
 func StrictMapTo(cfg *ini.Section, obj interface{}) error {
 	err := cfg.StrictMapTo(obj)
 	if err != nil {
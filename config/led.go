@@ -0,0 +1,86 @@
+package config
+
+import (
+	"picp/logger"
+	"sort"
+	"strings"
+)
+
+var leds []Led
+
+// Led is a [led.<name>] section, each state key holds the pattern shown
+// while that state is the most important one
+type Led struct {
+	Name   string `json:"name" ini:"-"`
+	Enable bool   `json:"enable" ini:"enable"`
+	// -1 when the LED is driven through sysfs
+	Pin    int    `json:"pin" ini:"pin" validate:"gte=-1,lt=255"`
+	Active string `json:"active" ini:"active" validate:"oneof=high low"`
+	// name under /sys/class/leds, like ACT for the on-board LED, replaces pin
+	Sysfs          string `json:"sysfs" ini:"sysfs"`
+	Idle           string `json:"idle" ini:"idle" validate:"led_pattern"`
+	WifiConnecting string `json:"wifi_connecting" ini:"wifi_connecting" validate:"led_pattern"`
+	WifiConnected  string `json:"wifi_connected" ini:"wifi_connected" validate:"led_pattern"`
+	ApActive       string `json:"ap_active" ini:"ap_active" validate:"led_pattern"`
+	Overheat       string `json:"overheat" ini:"overheat" validate:"led_pattern"`
+	Error          string `json:"error" ini:"error" validate:"led_pattern"`
+}
+
+func DefaultLed(name string) Led {
+	return Led{
+		Name:           name,
+		Enable:         true,
+		Pin:            -1,
+		Active:         "high",
+		Idle:           "off",
+		WifiConnecting: "slow_blink",
+		WifiConnected:  "solid",
+		ApActive:       "heartbeat",
+		Overheat:       "fast_blink",
+		Error:          "morse:SOS",
+	}
+}
+
+func (c *Led) NeedValidate() bool {
+	return c.Enable
+}
+
+func initLed() {
+	pins := reservedPins()
+	for _, section := range rootCfg.SectionStrings() {
+		name, ok := strings.CutPrefix(section, "led.")
+		if !ok {
+			continue
+		}
+		if !fanNamePattern.MatchString(name) {
+			logger.Fatalf("invalid led name %q", name)
+		}
+		led := DefaultLed(name)
+		if err := StrictMapTo(rootCfg.Section(section), &led); err != nil {
+			logger.Fatalf("led config error: %s", err)
+		}
+		if !led.Enable {
+			continue
+		}
+		if led.Pin < 0 && led.Sysfs == "" {
+			logger.Fatalf("led config error: led %s needs a pin or a sysfs name", name)
+		}
+		if led.Sysfs == "" {
+			if other, ok := pins[led.Pin]; ok {
+				logger.Fatalf("%s and led %s use the same pin %d", other, name, led.Pin)
+			}
+			pins[led.Pin] = "led " + name
+		}
+		leds = append(leds, led)
+	}
+	sort.Slice(leds, func(i, j int) bool {
+		return leds[i].Name < leds[j].Name
+	})
+}
+
+// GetLeds returns the enabled LEDs
+func GetLeds() []Led {
+	cfgLock.RLock()
+	defer cfgLock.RUnlock()
+	return append([]Led(nil), leds...)
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"github.com/go-ini/ini"
+	"picp/logger"
+)
+
+const (
+	ProtectActionDisplay   = "display"
+	ProtectActionWebhook   = "webhook"
+	ProtectActionCpufreq   = "cpufreq"
+	ProtectActionStopUnits = "stop_units"
+	ProtectActionShutdown  = "shutdown"
+)
+
+var protectCfg = Protect{
+	Source:          "cpu",
+	Interval:        5,
+	WarnTemp:        75,
+	WarnHold:        30,
+	WarnActions:     []string{ProtectActionDisplay},
+	CriticalTemp:    82,
+	CriticalHold:    10,
+	CriticalActions: []string{ProtectActionDisplay, ProtectActionCpufreq},
+	Hysteresis:      3,
+	CpufreqMax:      1000000,
+}
+
+type Protect struct {
+	cfg          *ini.Section `ini:"-"`
+	Enable       bool         `json:"enable" ini:"enable"`
+	Source       string       `json:"source" ini:"source,omitempty" validate:"temp_source"`
+	Interval     int          `json:"interval" ini:"interval,omitempty" validate:"gt=0"`
+	WarnTemp     float32      `json:"warn_temp" ini:"warn_temp,omitempty" validate:"gt=0,ltfield=CriticalTemp"`
+	WarnHold     int          `json:"warn_hold" ini:"warn_hold" validate:"gte=0"`
+	WarnActions  []string     `json:"warn_actions" ini:"warn_actions" validate:"dive,oneof=display webhook cpufreq stop_units shutdown"`
+	CriticalTemp float32      `json:"critical_temp" ini:"critical_temp,omitempty" validate:"gt=0"`
+	CriticalHold int          `json:"critical_hold" ini:"critical_hold" validate:"gte=0"`
+	// CriticalActions run in addition to the warning ones
+	CriticalActions []string `json:"critical_actions" ini:"critical_actions" validate:"dive,oneof=display webhook cpufreq stop_units shutdown"`
+	// degrees below a threshold before its level is left
+	Hysteresis float32 `json:"hysteresis" ini:"hysteresis" validate:"gte=0"`
+	Webhook    string  `json:"webhook" ini:"webhook" validate:"omitempty,url"`
+	// scaling_max_freq in kHz applied by the cpufreq action
+	CpufreqMax int      `json:"cpufreq_max" ini:"cpufreq_max" validate:"gt=0"`
+	Units      []string `json:"units" ini:"units" validate:"dive,required"`
+}
+
+func (c *Protect) NeedValidate() bool {
+	return c.Enable
+}
+
+// HasAction reports whether action runs at the critical level when critical
+// is set, otherwise at the warning level
+func (c *Protect) HasAction(critical bool, action string) bool {
+	actions := c.WarnActions
+	if critical {
+		actions = append(append([]string(nil), c.WarnActions...), c.CriticalActions...)
+	}
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Protect) clone() Protect {
+	ret := *c
+	ret.WarnActions = append([]string(nil), c.WarnActions...)
+	ret.CriticalActions = append([]string(nil), c.CriticalActions...)
+	ret.Units = append([]string(nil), c.Units...)
+	return ret
+}
+
+func initProtect() {
+	var ok bool
+	protectCfg.cfg, ok = Get("protect")
+	if ok {
+		if err := StrictMapTo(protectCfg.cfg, &protectCfg); err != nil {
+			logger.Fatalf("protect config error: %s", err)
+		}
+	}
+}
+
+func GetProtectCfg() Protect {
+	cfgLock.RLock()
+	defer cfgLock.RUnlock()
+	return protectCfg.clone()
+}
+
+func SetProtectCfg(cfg *Protect) (err error) {
+	err = Validate(cfg)
+	if err != nil {
+		return
+	}
+	cfgLock.Lock()
+	defer cfgLock.Unlock()
+	old := protectCfg
+	defer func() {
+		if err != nil {
+			protectCfg = old
+		}
+	}()
+	section := protectCfg.cfg
+	protectCfg = cfg.clone()
+	protectCfg.cfg = section
+	err = protectCfg.cfg.ReflectFrom(&protectCfg)
+	if err == nil {
+		return SaveCfg()
+	}
+	return
+}
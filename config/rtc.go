@@ -0,0 +1,47 @@
+package config
+
+import (
+	"github.com/go-ini/ini"
+	"picp/logger"
+)
+
+var rtcCfg = RTC{
+	IICConfig: IICConfig{
+		Enable: false,
+		Bus:    1,
+		Addr:   0x68,
+	},
+	Chip:         "ds3231",
+	SyncInterval: 60,
+}
+
+type RTC struct {
+	cfg          *ini.Section `ini:"-"`
+	IICConfig    `ini:",extends"`
+	Chip         string `json:"chip" ini:"chip,omitempty" validate:"oneof=ds3231 pcf8563"`
+	SyncInterval int    `json:"sync_interval" ini:"sync_interval,omitempty" validate:"gt=0"`
+}
+
+func (c *RTC) NeedValidate() bool {
+	return c.Enable
+}
+
+func (c *RTC) usedPins() []int {
+	return i2cBusPins(c.Bus)
+}
+
+func initRtc() {
+	var ok bool
+	rtcCfg.cfg, ok = Get("rtc")
+	if ok {
+		if err := StrictMapTo(rtcCfg.cfg, &rtcCfg); err != nil {
+			logger.Fatalf("rtc config error: %s", err)
+		}
+	}
+}
+
+func GetRtcCfg() RTC {
+	cfgLock.RLock()
+	defer cfgLock.RUnlock()
+	return rtcCfg
+}
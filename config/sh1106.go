@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"github.com/go-ini/ini"
 	"go.uber.org/zap"
+	"picp/go-spi"
 	"picp/logger"
 	"picp/sh1106"
 	"sync"
@@ -10,31 +12,61 @@ import (
 
 var SH1106 = SH1106Config{
 	IICConfig: IICConfig{
-		Enable: true,
-		Bus:    1,
-		Addr:   0x3C,
+		Enable:       true,
+		Bus:          1,
+		Addr:         0x3C,
+		Retries:      2,
+		RetryBackoff: 10,
 	},
+	Interface:      "i2c",
+	Controller:     "sh1106",
+	SpiBus:         0,
+	SpiCs:          0,
+	SpiSpeed:       8000000,
+	DcPin:          24,
+	RstPin:         25,
 	Width:          128,
 	Height:         64,
 	VccState:       0,
 	StatusInterval: 1,
+	TempSource:     "cpu",
+	MenuTimeout:    30,
 }
 var sh1106Lock sync.Mutex
 
 type SH1106Config struct {
 	cfg            *ini.Section `ini:"-"`
 	IICConfig      `ini:",extends"`
-	Height         int  `json:"height" ini:"height,omitempty" validate:"required,gt=0,lt=32767"`
-	Width          int  `json:"width" ini:"width,omitempty" validate:"required,gt=0,lt=32767"`
-	VccState       int  `json:"vcc_state" ini:"vcc_state,omitempty" validate:"oneof=0 1"`
-	StatusInterval int  `json:"status_interval" ini:"status_interval,omitempty" validate:"gt=0"`
-	Invert         bool `json:"invert" ini:"invert"`
+	Interface      string `json:"interface" ini:"interface,omitempty" validate:"oneof=i2c spi"`
+	Controller     string `json:"controller" ini:"controller,omitempty" validate:"oneof=sh1106 ssd1306"`
+	SpiBus         int    `json:"spi_bus" ini:"spi_bus" validate:"gte=0"`
+	SpiCs          int    `json:"spi_cs" ini:"spi_cs" validate:"gte=0"`
+	SpiSpeed       int    `json:"spi_speed" ini:"spi_speed,omitempty" validate:"gt=0"`
+	DcPin          int    `json:"dc_pin" ini:"dc_pin" validate:"gte=0,lt=255"`
+	RstPin         int    `json:"rst_pin" ini:"rst_pin" validate:"gte=-1,lt=255"`
+	Height         int    `json:"height" ini:"height,omitempty" validate:"required,gt=0,lt=32767"`
+	Width          int    `json:"width" ini:"width,omitempty" validate:"required,gt=0,lt=32767"`
+	VccState       int    `json:"vcc_state" ini:"vcc_state,omitempty" validate:"oneof=0 1"`
+	StatusInterval int    `json:"status_interval" ini:"status_interval,omitempty" validate:"gt=0"`
+	Invert         bool   `json:"invert" ini:"invert"`
+	// 0 keeps the default of the panel size
+	Contrast   int    `json:"contrast" ini:"contrast" validate:"gte=0,lte=255"`
+	TempSource string `json:"temp_source" ini:"temp_source,omitempty" validate:"temp_source"`
+	// seconds without a button press before the menu falls back to the status page
+	MenuTimeout int `json:"menu_timeout" ini:"menu_timeout,omitempty" validate:"gt=0"`
 }
 
 func (c *SH1106Config) NeedValidate() bool {
 	return c.Enable
 }
 
+func (c *SH1106Config) usedPins() []int {
+	if c.Interface == "spi" {
+		return append([]int{c.DcPin, c.RstPin}, spiBusPins(c.SpiBus, c.SpiCs)...)
+	}
+	return i2cBusPins(c.Bus)
+}
+
 func (c *SH1106Config) GetMode() sh1106.VccMode {
 	return []sh1106.VccMode{
 		sh1106.ExternalVCC,
@@ -42,6 +74,35 @@ func (c *SH1106Config) GetMode() sh1106.VccMode {
 	}[c.VccState]
 }
 
+func (c *SH1106Config) GetController() sh1106.Controller {
+	if c.Controller == "ssd1306" {
+		return sh1106.SSD1306
+	}
+	return sh1106.SH1106
+}
+
+func (c *SH1106Config) CreateSPI() (*spi.SPI, error) {
+	if !c.Enable {
+		return nil, ErrorSensorDisabled
+	}
+	conn, err := spi.NewSPI(c.SpiBus, c.SpiCs)
+	if err != nil {
+		return nil, err
+	}
+	err = conn.SetMode(spi.Mode0)
+	if err == nil {
+		err = conn.SetBitsPerWord(8)
+	}
+	if err == nil {
+		err = conn.SetSpeed(uint32(c.SpiSpeed))
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
 func initSH1106() {
 	var ok bool
 	SH1106.cfg, ok = Get("sh1106")
@@ -60,6 +121,16 @@ func GetSH1106Cfg() SH1106Config {
 }
 
 func SaveSH1106(cfg *SH1106Config) (err error) {
+	if cfg.Enable && cfg.Interface == "spi" {
+		if ws2812Cfg.Enable && ws2812Cfg.SpiBus == cfg.SpiBus {
+			return fmt.Errorf("spi bus %d is used by the ws2812 strip", cfg.SpiBus)
+		}
+	}
+	if cfg.Enable {
+		if err = checkUserGpioPins("display", cfg.usedPins()...); err != nil {
+			return
+		}
+	}
 	old := SH1106
 	defer func() {
 		if err != nil {
@@ -68,10 +139,20 @@ func SaveSH1106(cfg *SH1106Config) (err error) {
 	}()
 	SH1106.Invert = cfg.Invert
 	SH1106.IICConfig = cfg.IICConfig
+	SH1106.Interface = cfg.Interface
+	SH1106.Controller = cfg.Controller
+	SH1106.SpiBus = cfg.SpiBus
+	SH1106.SpiCs = cfg.SpiCs
+	SH1106.SpiSpeed = cfg.SpiSpeed
+	SH1106.DcPin = cfg.DcPin
+	SH1106.RstPin = cfg.RstPin
 	SH1106.Height = cfg.Height
 	SH1106.Width = cfg.Width
 	SH1106.VccState = cfg.VccState
 	SH1106.StatusInterval = cfg.StatusInterval
+	SH1106.TempSource = cfg.TempSource
+	SH1106.MenuTimeout = cfg.MenuTimeout
+	SH1106.Contrast = cfg.Contrast
 	err = SH1106.cfg.ReflectFrom(&SH1106)
 	if err != nil {
 		return err
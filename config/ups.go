@@ -0,0 +1,95 @@
+package config
+
+import (
+	"github.com/go-ini/ini"
+	"picp/logger"
+)
+
+var upsCfg = UPS{
+	IICConfig: IICConfig{
+		Enable: false,
+		Bus:    1,
+		Addr:   0x36,
+	},
+	Chip:            "max17048",
+	Interval:        5,
+	ShutdownPercent: 10,
+	ShutdownDelay:   30,
+	PowerPin:        -1,
+	MinVoltage:      3.0,
+	MaxVoltage:      4.2,
+	ShuntOhms:       0.1,
+}
+
+type UPS struct {
+	cfg             *ini.Section `ini:"-"`
+	IICConfig       `ini:",extends"`
+	Chip            string  `json:"chip" ini:"chip,omitempty" validate:"oneof=max17040 max17048 ina219"`
+	Interval        int     `json:"interval" ini:"interval,omitempty" validate:"gt=0"`
+	ShutdownPercent float32 `json:"shutdown_percent" ini:"shutdown_percent" validate:"gte=0,lte=100"`
+	ShutdownDelay   int     `json:"shutdown_delay" ini:"shutdown_delay" validate:"gte=0"`
+	PowerPin        int     `json:"power_pin" ini:"power_pin" validate:"gte=-1,lt=255"`
+	MinVoltage      float32 `json:"min_voltage" ini:"min_voltage,omitempty" validate:"gte=0,ltfield=MaxVoltage"`
+	MaxVoltage      float32 `json:"max_voltage" ini:"max_voltage,omitempty" validate:"gt=0"`
+	ShuntOhms       float32 `json:"shunt_ohms" ini:"shunt_ohms,omitempty" validate:"gt=0"`
+	InvertCurrent   bool    `json:"invert_current" ini:"invert_current"`
+}
+
+func (c *UPS) NeedValidate() bool {
+	return c.Enable
+}
+
+func (c *UPS) usedPins() []int {
+	return append(i2cBusPins(c.Bus), c.PowerPin)
+}
+
+func initUps() {
+	var ok bool
+	upsCfg.cfg, ok = Get("ups")
+	if ok {
+		if err := StrictMapTo(upsCfg.cfg, &upsCfg); err != nil {
+			logger.Fatalf("ups config error: %s", err)
+		}
+	}
+}
+
+func GetUpsCfg() UPS {
+	cfgLock.RLock()
+	defer cfgLock.RUnlock()
+	return upsCfg
+}
+
+func SetUpsCfg(cfg *UPS) (err error) {
+	err = Validate(cfg)
+	if err != nil {
+		return
+	}
+	cfgLock.Lock()
+	defer cfgLock.Unlock()
+	if cfg.Enable {
+		if err = checkUserGpioPins("ups", cfg.usedPins()...); err != nil {
+			return
+		}
+	}
+	old := upsCfg
+	defer func() {
+		if err != nil {
+			upsCfg = old
+		}
+	}()
+	upsCfg.IICConfig = cfg.IICConfig
+	upsCfg.Chip = cfg.Chip
+	upsCfg.Interval = cfg.Interval
+	upsCfg.ShutdownPercent = cfg.ShutdownPercent
+	upsCfg.ShutdownDelay = cfg.ShutdownDelay
+	upsCfg.PowerPin = cfg.PowerPin
+	upsCfg.MinVoltage = cfg.MinVoltage
+	upsCfg.MaxVoltage = cfg.MaxVoltage
+	upsCfg.ShuntOhms = cfg.ShuntOhms
+	upsCfg.InvertCurrent = cfg.InvertCurrent
+	err = upsCfg.cfg.ReflectFrom(&upsCfg)
+	if err == nil {
+		return SaveCfg()
+	}
+	return
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"github.com/go-ini/ini"
+	"picp/logger"
+	"picp/w1"
+)
+
+var w1Cfg = W1{
+	Root:  w1.DefaultRoot,
+	Pin:   4,
+	Names: map[string]string{},
+}
+
+type W1 struct {
+	cfg    *ini.Section      `ini:"-"`
+	Enable bool              `json:"enable" ini:"enable"`
+	Root   string            `json:"root" ini:"root,omitempty" validate:"required"`
+	Names  map[string]string `json:"names" ini:"-"`
+	// gpio of the w1-gpio overlay, -1 when the bus is not on the header
+	Pin int `json:"pin" ini:"pin" validate:"gte=-1,lt=255"`
+}
+
+func (c *W1) NeedValidate() bool {
+	return c.Enable
+}
+
+// NameOf returns the user assigned name of a probe, or its id
+func (c *W1) NameOf(id string) string {
+	if name, ok := c.Names[id]; ok && name != "" {
+		return name
+	}
+	return id
+}
+
+// IdOf resolves a probe name or id to the probe id
+func (c *W1) IdOf(name string) string {
+	for id, value := range c.Names {
+		if value == name {
+			return id
+		}
+	}
+	return name
+}
+
+func initW1() {
+	var ok bool
+	w1Cfg.cfg, ok = Get("w1")
+	if ok {
+		if err := StrictMapTo(w1Cfg.cfg, &w1Cfg); err != nil {
+			logger.Fatalf("w1 config error: %s", err)
+		}
+	}
+	if names, ok := Get("w1.names"); ok {
+		w1Cfg.Names = names.KeysHash()
+	}
+}
+
+func GetW1Cfg() W1 {
+	cfgLock.RLock()
+	defer cfgLock.RUnlock()
+	ret := w1Cfg
+	ret.Names = make(map[string]string, len(w1Cfg.Names))
+	for id, name := range w1Cfg.Names {
+		ret.Names[id] = name
+	}
+	return ret
+}
+
+func SetW1Cfg(cfg *W1) (err error) {
+	err = Validate(cfg)
+	if err != nil {
+		return
+	}
+	cfgLock.Lock()
+	defer cfgLock.Unlock()
+	if cfg.Enable {
+		if err = checkUserGpioPins("1-wire", cfg.Pin); err != nil {
+			return
+		}
+	}
+	old := w1Cfg
+	defer func() {
+		if err != nil {
+			w1Cfg = old
+		}
+	}()
+	w1Cfg.Enable = cfg.Enable
+	w1Cfg.Root = cfg.Root
+	w1Cfg.Pin = cfg.Pin
+	w1Cfg.Names = make(map[string]string, len(cfg.Names))
+	for id, name := range cfg.Names {
+		w1Cfg.Names[id] = name
+	}
+	err = w1Cfg.cfg.ReflectFrom(&w1Cfg)
+	if err != nil {
+		return
+	}
+	rootCfg.DeleteSection("w1.names")
+	names, err := rootCfg.NewSection("w1.names")
+	if err != nil {
+		return
+	}
+	for id, name := range w1Cfg.Names {
+		if _, err = names.NewKey(id, name); err != nil {
+			return
+		}
+	}
+	return SaveCfg()
+}
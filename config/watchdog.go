@@ -0,0 +1,41 @@
+package config
+
+import (
+	"github.com/go-ini/ini"
+	"picp/logger"
+)
+
+var watchdogCfg = Watchdog{
+	Device:  "/dev/watchdog",
+	Timeout: 15,
+}
+
+// Watchdog is the [watchdog] section, the hardware watchdog petted while
+// the service is healthy
+type Watchdog struct {
+	cfg    *ini.Section `ini:"-"`
+	Enable bool         `json:"enable" ini:"enable"`
+	Device string       `json:"device" ini:"device" validate:"required"`
+	// seconds without a pet before the board resets, 15 at most on the Pi
+	Timeout int `json:"timeout" ini:"timeout" validate:"gte=3,lte=3600"`
+}
+
+func (c *Watchdog) NeedValidate() bool {
+	return c.Enable
+}
+
+func initWatchdog() {
+	var ok bool
+	watchdogCfg.cfg, ok = Get("watchdog")
+	if ok {
+		if err := StrictMapTo(watchdogCfg.cfg, &watchdogCfg); err != nil {
+			logger.Fatalf("watchdog config error: %s", err)
+		}
+	}
+}
+
+func GetWatchdogCfg() Watchdog {
+	cfgLock.RLock()
+	defer cfgLock.RUnlock()
+	return watchdogCfg
+}
@@ -55,6 +55,11 @@ func SetWifiConfig(cfg *Wifi) (err error) {
 	}
 	cfgLock.Lock()
 	defer cfgLock.Unlock()
+	if cfg.Enable {
+		if err = checkUserGpioPins("wifi", cfg.Pin); err != nil {
+			return
+		}
+	}
 	old := wifiCfg
 	defer func() {
 		if err != nil {
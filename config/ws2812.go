@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"github.com/go-ini/ini"
+	"picp/go-spi"
+	"picp/logger"
+	"picp/ws2812"
+	"strings"
+)
+
+const (
+	StripViewCpu         = "cpu"
+	StripViewTemperature = "temperature"
+	StripViewWifi        = "wifi"
+)
+
+var ws2812Cfg = WS2812{
+	SpiBus:     0,
+	SpiCs:      0,
+	Pixels:     8,
+	Order:      "grb",
+	Brightness: 64,
+	Views:      "cpu,temperature,wifi",
+	TempSource: "cpu",
+	TempLow:    40,
+	TempHigh:   80,
+	Alerts:     true,
+}
+
+// WS2812 is the [ws2812] section, a NeoPixel strip on the MOSI pin of a spi
+// bus split evenly between the listed views
+type WS2812 struct {
+	cfg        *ini.Section `ini:"-"`
+	Enable     bool         `json:"enable" ini:"enable"`
+	SpiBus     int          `json:"spi_bus" ini:"spi_bus" validate:"gte=0"`
+	SpiCs      int          `json:"spi_cs" ini:"spi_cs" validate:"gte=0"`
+	Pixels     int          `json:"pixels" ini:"pixels" validate:"gt=0,lte=450"`
+	Order      string       `json:"order" ini:"order" validate:"oneof=rgb rbg grb gbr brg bgr"`
+	Brightness int          `json:"brightness" ini:"brightness" validate:"gte=0,lte=255"`
+	// comma separated cpu, temperature and wifi
+	Views      string  `json:"views" ini:"views" validate:"required"`
+	TempSource string  `json:"temp_source" ini:"temp_source" validate:"temp_source"`
+	TempLow    float32 `json:"temp_low" ini:"temp_low"`
+	TempHigh   float32 `json:"temp_high" ini:"temp_high" validate:"gtfield=TempLow"`
+	// flash the whole strip on overheat and errors
+	Alerts bool `json:"alerts" ini:"alerts"`
+}
+
+func (c *WS2812) NeedValidate() bool {
+	return c.Enable
+}
+
+// GetViews returns the views in the order they sit on the strip
+func (c *WS2812) GetViews() []string {
+	var views []string
+	for _, view := range strings.Split(c.Views, ",") {
+		if view = strings.TrimSpace(view); view != "" {
+			views = append(views, view)
+		}
+	}
+	return views
+}
+
+func (c *WS2812) checkViews() error {
+	views := c.GetViews()
+	if len(views) == 0 || len(views) > c.Pixels {
+		return fmt.Errorf("%d views do not fit %d pixels", len(views), c.Pixels)
+	}
+	for _, view := range views {
+		switch view {
+		case StripViewCpu, StripViewTemperature, StripViewWifi:
+		default:
+			return fmt.Errorf("unknown strip view %q", view)
+		}
+	}
+	return nil
+}
+
+func (c *WS2812) usedPins() []int {
+	return spiBusPins(c.SpiBus, c.SpiCs)
+}
+
+func (c *WS2812) GetOrder() ws2812.Order {
+	order, _ := ws2812.ParseOrder(c.Order)
+	return order
+}
+
+func (c *WS2812) CreateSPI() (*spi.SPI, error) {
+	if !c.Enable {
+		return nil, ErrorSensorDisabled
+	}
+	conn, err := spi.NewSPI(c.SpiBus, c.SpiCs)
+	if err != nil {
+		return nil, err
+	}
+	err = conn.SetMode(spi.Mode0)
+	if err == nil {
+		err = conn.SetBitsPerWord(8)
+	}
+	if err == nil {
+		err = conn.SetSpeed(ws2812.SpeedHz)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func initWS2812() {
+	var ok bool
+	ws2812Cfg.cfg, ok = Get("ws2812")
+	if !ok {
+		return
+	}
+	if err := StrictMapTo(ws2812Cfg.cfg, &ws2812Cfg); err != nil {
+		logger.Fatalf("ws2812 config error: %s", err)
+	}
+	if !ws2812Cfg.Enable {
+		return
+	}
+	if err := ws2812Cfg.checkViews(); err != nil {
+		logger.Fatalf("ws2812 config error: %s", err)
+	}
+	// the strip has no chip select, it takes whatever goes over MOSI
+	if SH1106.Enable && SH1106.Interface == "spi" && SH1106.SpiBus == ws2812Cfg.SpiBus {
+		logger.Fatalf("ws2812 can not share spi bus %d with the display", ws2812Cfg.SpiBus)
+	}
+}
+
+func GetWS2812Cfg() WS2812 {
+	cfgLock.RLock()
+	defer cfgLock.RUnlock()
+	return ws2812Cfg
+}
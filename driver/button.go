@@ -0,0 +1,317 @@
+package driver
+
+import (
+	"context"
+	"github.com/skip2/go-qrcode"
+	"go.uber.org/zap"
+	"image"
+	"image/color"
+	"net"
+	"picp/button"
+	"picp/config"
+	"picp/gpio"
+	"picp/logger"
+	"picp/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+const qrShowTime = 30 * time.Second
+
+// quiet zone around the qr code in modules, the standard asks for 4 but the
+// panel is too small for that
+const qrQuietZone = 2
+
+// a quick turn is a few milliseconds per detent, only matters when the rpio
+// backend polls for edges
+const encoderPollInterval = time.Millisecond
+
+var buttonRunner *utils.Runner
+
+// notice hides the status page while a button shows something, gen makes a
+// stale timer leave a newer notice alone
+var (
+	noticeLock  sync.Mutex
+	noticeTimer *time.Timer
+	noticeGen   int
+)
+
+func buttonInit(ctx context.Context) {
+	buttonRunner = utils.NewRunner(ctx, runButtons)
+	buttonRunner.Start()
+}
+
+// wifiButton keeps the [wifi] pin working as a plain active high button
+// unless a [button.<name>] or [encoder.<name>] section took it over
+func wifiButton(buttons []config.Button, encoders []config.Encoder) (config.Button, bool) {
+	cfg := config.GetWifiConfig()
+	if !cfg.Enable {
+		return config.Button{}, false
+	}
+	for _, b := range buttons {
+		if b.Pin == cfg.Pin {
+			return config.Button{}, false
+		}
+	}
+	for _, e := range encoders {
+		if e.PinA == cfg.Pin || e.PinB == cfg.Pin {
+			return config.Button{}, false
+		}
+	}
+	b := config.DefaultButton("wifi")
+	b.Pin = cfg.Pin
+	// like the old rpio input, boards may pull the pin in the device tree
+	b.Pull = "as_is"
+	b.Active = "high"
+	b.LongPress = 0
+	b.DoubleClick = 0
+	b.OnClick = config.ButtonActionWifi
+	return b, true
+}
+
+func runButtons(ctx context.Context) {
+	buttons := config.GetButtons()
+	encoders := config.GetEncoders()
+	for _, e := range encoders {
+		if b, ok := e.SwitchButton(); ok {
+			buttons = append(buttons, b)
+		}
+	}
+	if b, ok := wifiButton(buttons, encoders); ok {
+		buttons = append(buttons, b)
+	}
+	var wg sync.WaitGroup
+	for _, b := range buttons {
+		wg.Add(1)
+		go func(b config.Button) {
+			defer wg.Done()
+			watchButton(ctx, &b)
+		}(b)
+	}
+	for _, e := range encoders {
+		wg.Add(1)
+		go func(e config.Encoder) {
+			defer wg.Done()
+			watchEncoder(ctx, &e)
+		}(e)
+	}
+	wg.Wait()
+}
+
+// buttonBias maps the pull setting of a button
+var buttonBias = map[string]gpio.Bias{
+	"none":  gpio.BiasDisable,
+	"as_is": gpio.BiasAsIs,
+	"up":    gpio.BiasPullUp,
+	"down":  gpio.BiasPullDown,
+}
+
+func watchButton(ctx context.Context, cfg *config.Button) {
+	line, err := gpio.Request(cfg.Pin, gpio.Config{
+		ActiveLow: cfg.Active == "low",
+		Bias:      buttonBias[cfg.Pull],
+		Edge:      gpio.EdgeBoth,
+	})
+	if err != nil {
+		logger.Error("button disabled", zap.String("name", cfg.Name), zap.Error(err))
+		return
+	}
+	defer func() {
+		if err := line.Close(); err != nil {
+			logger.Debug("close button line failed", zap.String("name", cfg.Name), zap.Error(err))
+		}
+	}()
+	detector := &button.Detector{
+		Debounce:    time.Duration(cfg.Debounce) * time.Millisecond,
+		LongPress:   time.Duration(cfg.LongPress) * time.Millisecond,
+		DoubleClick: time.Duration(cfg.DoubleClick) * time.Millisecond,
+	}
+	err = button.Watch(ctx, line, detector, func(event button.Event) {
+		var action string
+		switch event {
+		case button.Click:
+			action = cfg.OnClick
+		case button.DoubleClick:
+			action = cfg.OnDoubleClick
+		case button.LongPress:
+			action = cfg.OnLongPress
+		}
+		logger.Debug("button event", zap.String("name", cfg.Name), zap.Stringer("event", event), zap.String("action", action))
+		if action != "" {
+			runButtonAction(cfg.Name, action)
+		}
+	})
+	if err != nil {
+		logger.Error("button stopped", zap.String("name", cfg.Name), zap.Error(err))
+	}
+}
+
+func watchEncoder(ctx context.Context, cfg *config.Encoder) {
+	lineCfg := gpio.Config{Bias: buttonBias[cfg.Pull], Edge: gpio.EdgeBoth, PollInterval: encoderPollInterval}
+	// one request keeps the edges of A and B in order
+	lines, err := gpio.RequestGroup([]int{cfg.PinA, cfg.PinB}, lineCfg)
+	if err != nil {
+		logger.Error("encoder disabled", zap.String("name", cfg.Name), zap.Error(err))
+		return
+	}
+	defer func() {
+		_ = lines.Close()
+	}()
+	encoder := &button.Encoder{
+		StepsPerDetent: cfg.StepsPerDetent,
+		FastTurn:       time.Duration(cfg.FastTurn) * time.Millisecond,
+		Acceleration:   cfg.Acceleration,
+	}
+	err = button.WatchEncoder(ctx, lines, encoder, func(steps int) {
+		if cfg.Reverse {
+			steps = -steps
+		}
+		logger.Debug("encoder turn", zap.String("name", cfg.Name), zap.Int("steps", steps))
+		MenuTurn(steps)
+	})
+	if err != nil {
+		logger.Error("encoder stopped", zap.String("name", cfg.Name), zap.Error(err))
+	}
+}
+
+func runButtonAction(name, action string) {
+	playBuzzerEvent(BuzzerEventButton)
+	var err error
+	switch action {
+	case config.ButtonActionWifi:
+		err = ToggleWifiAp()
+	case config.ButtonActionNextPage:
+		hideNotice()
+		statusRunner.NextPage()
+	case config.ButtonActionQr:
+		err = showWebQr()
+	case config.ButtonActionMenuUp, config.ButtonActionMenuDown, config.ButtonActionMenuSelect, config.ButtonActionMenuBack:
+		MenuInput(action)
+	case config.ButtonActionReboot:
+		err = RequestPower(PowerReboot)
+	case config.ButtonActionShutdown:
+		err = RequestPower(PowerShutdown)
+	default:
+		if script, ok := strings.CutPrefix(action, config.ButtonActionScript); ok {
+			go runButtonScript(name, script)
+		}
+	}
+	if err != nil {
+		logger.Warn("button action failed", zap.String("name", name), zap.String("action", action), zap.Error(err))
+	}
+}
+
+func runButtonScript(name, script string) {
+	output, err := utils.RunScript(script)
+	if err != nil {
+		logger.Warn("button script failed", zap.String("name", name), zap.String("script", script), zap.Error(err))
+		return
+	}
+	logger.Info("button script done", zap.String("name", name), zap.String("script", script), zap.String("output", output))
+}
+
+// showNotice hides the status page and calls show, the status page comes
+// back after duration or once hideNotice is called
+func showNotice(duration time.Duration, show func()) {
+	// before noticeLock, the menu takes the locks the other way round
+	closeMenu()
+	noticeLock.Lock()
+	defer noticeLock.Unlock()
+	if noticeTimer != nil {
+		noticeTimer.Stop()
+	}
+	noticeGen++
+	gen := noticeGen
+	statusRunner.StatusShowEnable(false)
+	show()
+	noticeTimer = time.AfterFunc(duration, func() {
+		noticeLock.Lock()
+		defer noticeLock.Unlock()
+		if gen == noticeGen {
+			noticeTimer = nil
+			statusRunner.StatusShowEnable(true)
+		}
+	})
+}
+
+func hideNotice() {
+	noticeLock.Lock()
+	defer noticeLock.Unlock()
+	if noticeTimer == nil {
+		return
+	}
+	noticeTimer.Stop()
+	noticeTimer = nil
+	noticeGen++
+	statusRunner.StatusShowEnable(true)
+}
+
+// webUrl is the address of the web ui as seen from the network
+func webUrl() string {
+	host, port, err := net.SplitHostPort(config.Common.BindAddr)
+	if err != nil {
+		port = "80"
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = utils.GetHostIP()
+	}
+	return "http://" + net.JoinHostPort(host, port) + "/"
+}
+
+// showWebQr shows the web ui address as a qr code, pressing again hides it
+func showWebQr() error {
+	noticeLock.Lock()
+	shown := noticeTimer != nil
+	noticeLock.Unlock()
+	if shown {
+		hideNotice()
+		return nil
+	}
+	code, err := qrcode.New(webUrl(), qrcode.Low)
+	if err != nil {
+		return err
+	}
+	code.DisableBorder = true
+	modules := code.Bitmap()
+	showNotice(qrShowTime, func() {
+		err = DisplayDraw(func(width, height int) *image.Gray {
+			return drawQr(modules, width, height)
+		})
+	})
+	return err
+}
+
+// drawQr centers the code on a lit background, dark modules stay off
+func drawQr(code [][]bool, width, height int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	size := len(code)
+	modules := size + qrQuietZone*2
+	scale := min(width, height) / modules
+	if scale == 0 {
+		scale = 1
+	}
+	left := (width - modules*scale) / 2
+	top := (height - modules*scale) / 2
+	for y := 0; y < modules*scale; y++ {
+		for x := 0; x < modules*scale; x++ {
+			mx, my := x/scale-qrQuietZone, y/scale-qrQuietZone
+			dark := mx >= 0 && my >= 0 && mx < size && my < size && code[my][mx]
+			if !dark {
+				img.SetGray(left+x, top+y, color.Gray{Y: 0xff})
+			}
+		}
+	}
+	return img
+}
+
+func restartButtons() {
+	_ = buttonRunner.Stop(context.Background())
+	buttonRunner.Start()
+}
+
+func closeButton() {
+	_ = buttonRunner.Stop(context.Background())
+	closeMenu()
+	hideNotice()
+}
@@ -0,0 +1,30 @@
+package driver
+
+import (
+	"github.com/skip2/go-qrcode"
+	"testing"
+)
+
+func TestDrawQr(t *testing.T) {
+	code, err := qrcode.New("http://192.168.100.100:8888", qrcode.Low)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code.DisableBorder = true
+	modules := code.Bitmap()
+	img := drawQr(modules, 128, 64)
+	scale := 64 / (len(modules) + qrQuietZone*2)
+	if scale == 0 {
+		t.Fatalf("%d modules do not fit the panel", len(modules))
+	}
+	left := (128 - (len(modules)+qrQuietZone*2)*scale) / 2
+	top := (64 - (len(modules)+qrQuietZone*2)*scale) / 2
+	// quiet zone lit, top left finder pattern corner dark
+	if img.GrayAt(left, top).Y != 0xff {
+		t.Error("quiet zone is not lit")
+	}
+	corner := qrQuietZone * scale
+	if img.GrayAt(left+corner, top+corner).Y != 0 {
+		t.Error("finder pattern is not dark")
+	}
+}
@@ -0,0 +1,215 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"picp/buzzer"
+	"picp/config"
+	"picp/logger"
+	"picp/pwm"
+	"picp/utils"
+	"time"
+)
+
+const (
+	BuzzerEventOverheat = "overheat"
+	BuzzerEventFanStall = "fan_stall"
+	BuzzerEventWifiLost = "wifi_lost"
+	BuzzerEventUpsLow   = "ups_low"
+	BuzzerEventButton   = "button"
+)
+
+// alerts are checked as often as the LED state
+const buzzerCheckInterval = ledStateInterval
+
+// the pwm starts at this frequency, every note sets its own
+const buzzerBaseHz = 1000
+
+var ErrorBuzzerDisabled = errors.New("buzzer is disabled")
+
+var buzzerRunner *utils.Runner
+var buzzerPlayer atomic.Pointer[buzzer.Player]
+
+func buzzerInit(ctx context.Context) {
+	buzzerRunner = utils.NewRunner(ctx, runBuzzer)
+	buzzerRunner.Start()
+}
+
+func openBuzzer(cfg *config.Buzzer) (pwm.Tuner, error) {
+	var out pwm.Output
+	var err error
+	switch cfg.Backend {
+	case pwm.BackendSysfs:
+		out, err = pwm.NewSysfs(cfg.PwmChip, cfg.PwmChannel, buzzerBaseHz)
+	case pwm.BackendSoftware:
+		out, err = pwm.NewSoftware(cfg.Pin, buzzerBaseHz)
+	default:
+		out, err = pwm.NewRpio(cfg.Pin, buzzerBaseHz*pwm.MaxDuty)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.(pwm.Tuner), nil
+}
+
+// buzzerAlert remembers when an alert went off so it repeats while it lasts
+type buzzerAlert struct {
+	active bool
+	played time.Time
+}
+
+func runBuzzer(ctx context.Context) {
+	cfg := config.GetBuzzerCfg()
+	if !cfg.Enable {
+		return
+	}
+	out, err := openBuzzer(&cfg)
+	if err != nil {
+		logger.Error("open buzzer failed", zap.Error(err))
+		return
+	}
+	player := buzzer.NewPlayer(out, uint32(cfg.Volume))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := player.Run(ctx); err != nil {
+			logger.Warn("buzzer stopped", zap.Error(err))
+		}
+	}()
+	buzzerPlayer.Store(player)
+	defer func() {
+		buzzerPlayer.Store(nil)
+		<-done
+		if err := out.Close(); err != nil {
+			logger.Debug("close buzzer failed", zap.Error(err))
+		}
+	}()
+	alerts := map[string]*buzzerAlert{}
+	var wifiSeen bool
+	ticker := time.NewTicker(buzzerCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		// only a connection that was there can get lost, the access point
+		// going up is not losing it
+		var wifiLost bool
+		if connected, ok := wifiConnected(); ok && !wifiApActive.Load() {
+			wifiLost = wifiSeen && !connected
+			wifiSeen = wifiSeen || connected
+		}
+		active := map[string]bool{
+			BuzzerEventOverheat: GetProtectStatus().Level >= ProtectLevelWarning,
+			BuzzerEventFanStall: fanStalled(),
+			BuzzerEventWifiLost: wifiLost,
+			BuzzerEventUpsLow:   upsLow(),
+		}
+		now := time.Now()
+		for event, on := range active {
+			alert := alerts[event]
+			if alert == nil {
+				alert = &buzzerAlert{}
+				alerts[event] = alert
+			}
+			repeat := cfg.Repeat > 0 && now.Sub(alert.played) >= time.Duration(cfg.Repeat)*time.Second
+			if on && (!alert.active || repeat) {
+				alert.played = now
+				playBuzzerEvent(event)
+			}
+			alert.active = on
+		}
+	}
+}
+
+// fanStalled reports whether any fan with a tachometer stopped turning
+func fanStalled() bool {
+	for _, name := range config.GetFanNames() {
+		if speed, err := GetFanSpeed(name); err == nil && speed.Stall {
+			return true
+		}
+	}
+	return false
+}
+
+func upsLow() bool {
+	status := GetUpsStatus()
+	return status != nil && !status.ShutdownAt.IsZero()
+}
+
+// wifiConnected reports whether a wifi device is connected, ok is false when
+// NetworkManager could not be asked
+func wifiConnected() (connected, ok bool) {
+	state, ok := wifiDeviceState()
+	return state == LedStateWifiConnected, ok
+}
+
+// playBuzzerEvent plays the tone of event unless it is disabled or it is
+// quiet hours
+func playBuzzerEvent(event string) {
+	player := buzzerPlayer.Load()
+	if player == nil {
+		return
+	}
+	cfg := config.GetBuzzerCfg()
+	var enable bool
+	var tone string
+	switch event {
+	case BuzzerEventOverheat:
+		enable, tone = cfg.Overheat, cfg.OverheatTone
+	case BuzzerEventFanStall:
+		enable, tone = cfg.FanStall, cfg.FanStallTone
+	case BuzzerEventWifiLost:
+		enable, tone = cfg.WifiLost, cfg.WifiLostTone
+	case BuzzerEventUpsLow:
+		enable, tone = cfg.UpsLow, cfg.UpsLowTone
+	case BuzzerEventButton:
+		enable, tone = cfg.Button, cfg.ButtonTone
+	}
+	if !enable || cfg.IsQuiet(time.Now()) {
+		return
+	}
+	if event != BuzzerEventButton {
+		logger.Info("buzzer alert", zap.String("event", event))
+	}
+	melody, err := buzzer.Parse(tone)
+	if err != nil {
+		logger.Warn("buzzer tone invalid", zap.String("event", event), zap.Error(err))
+		return
+	}
+	player.Play(melody)
+}
+
+// PlayBuzzer plays tone right away, also during quiet hours
+func PlayBuzzer(tone string) error {
+	melody, err := buzzer.Parse(tone)
+	if err != nil {
+		return err
+	}
+	player := buzzerPlayer.Load()
+	if player == nil {
+		return ErrorBuzzerDisabled
+	}
+	if !player.Play(melody) {
+		return errors.New("buzzer is busy")
+	}
+	return nil
+}
+
+func SetBuzzerConfig(cfg *config.Buzzer) error {
+	err := config.SetBuzzerCfg(cfg)
+	if err != nil {
+		return err
+	}
+	_ = buzzerRunner.Stop(context.Background())
+	buzzerRunner.Start()
+	return nil
+}
+
+func closeBuzzer() {
+	_ = buzzerRunner.Stop(context.Background())
+}
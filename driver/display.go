@@ -3,8 +3,11 @@ package driver
 import (
 	"context"
 	_ "embed"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/golang/freetype/truetype"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 	"golang.org/x/image/font"
 	"golang.org/x/image/math/fixed"
@@ -13,7 +16,9 @@ import (
 	"picp/config"
 	"picp/logger"
 	"picp/sh1106"
+	"picp/utils"
 	"sync"
+	"time"
 )
 
 //go:embed fonts/BoutiqueBitmap9x9_1.6.ttf
@@ -33,16 +38,51 @@ func init() {
 	})
 }
 
+type DisplayHealth int32
+
+const (
+	DisplayHealthOk DisplayHealth = iota
+	DisplayHealthDegraded
+	DisplayHealthAbsent
+)
+
+var displayHealthString = []string{"ok", "degraded", "absent"}
+
+func (h DisplayHealth) String() string {
+	if int(h) >= len(displayHealthString) {
+		return fmt.Sprintf("unknown(%d)", h)
+	}
+	return displayHealthString[h]
+}
+
+func (h DisplayHealth) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.String())
+}
+
+const (
+	// consecutive failed writes before the panel is treated as unplugged
+	displayAbsentFailures = 3
+	displayProbeInterval  = 5 * time.Second
+)
+
 var display *sh1106.Device
 var displayLock sync.Mutex
+var displayHealth atomic.Int32
+var displayFailures int
+var displayProbeRunner *utils.Runner
 
 func sh1106Init(ctx context.Context) {
-	var err error
-	display, err = createDisplay(&config.SH1106)
+	displayProbeRunner = utils.NewRunner(ctx, probeDisplay)
+	displayLock.Lock()
+	device, err := createDisplay(&config.SH1106)
+	setupDisplay(device)
 	if err != nil {
-		logger.Fatal("create sh1106 device failed", zap.Error(err))
+		// the bus or the lines may show up later
+		logger.Error("create sh1106 device failed, waiting for it", zap.Error(err))
+		setDisplayAbsent()
 	}
-	if display == nil {
+	displayLock.Unlock()
+	if device == nil {
 		_ = statusRunner.Stop(ctx)
 	} else {
 		statusRunner.Start()
@@ -50,29 +90,123 @@ func sh1106Init(ctx context.Context) {
 }
 
 func createDisplay(cfg *config.SH1106Config) (*sh1106.Device, error) {
+	deviceCfg := sh1106.Config{
+		Height:     int16(cfg.Height),
+		VccState:   cfg.GetMode(),
+		Width:      int16(cfg.Width),
+		Invert:     cfg.Invert,
+		Controller: cfg.GetController(),
+		Contrast:   uint8(cfg.Contrast),
+	}
+	if cfg.Interface == "spi" {
+		conn, err := cfg.CreateSPI()
+		if err != nil {
+			if !errors.Is(err, config.ErrorSensorDisabled) {
+				return nil, err
+			}
+			return nil, nil
+		}
+		device, err := sh1106.OpenSPI(conn, cfg.DcPin, cfg.RstPin, deviceCfg)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return device, nil
+	}
 	bus, err := cfg.Create()
 	if err != nil {
 		if !errors.Is(err, config.ErrorSensorDisabled) {
 			return nil, err
 		}
 		return nil, nil
-	} else {
-		var device *sh1106.Device
-		device, err = sh1106.NewI2C(bus, sh1106.Config{
-			Height:   int16(cfg.Height),
-			VccState: cfg.GetMode(),
-			Width:    int16(cfg.Width),
-			Invert:   cfg.Invert,
-		})
-		if err != nil {
-			_ = bus.Close()
-			return nil, err
-		} else {
-			return device, nil
+	}
+	return sh1106.OpenI2C(bus, deviceCfg), nil
+}
+
+// setupDisplay must be called with displayLock held
+func setupDisplay(device *sh1106.Device) {
+	display = device
+	displayFailures = 0
+	displayHealth.Store(int32(DisplayHealthOk))
+	if display == nil {
+		return
+	}
+	err := display.Reset()
+	if err != nil {
+		logger.Warn("sh1106 not responding, waiting for it", zap.Error(err))
+		setDisplayAbsent()
+	}
+}
+
+// setDisplayAbsent must be called with displayLock held
+func setDisplayAbsent() {
+	displayHealth.Store(int32(DisplayHealthAbsent))
+	displayProbeRunner.Start()
+}
+
+func probeDisplay(ctx context.Context) {
+	ticker := time.NewTicker(displayProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if reprobeDisplay() {
+			return
 		}
 	}
 }
 
+func reprobeDisplay() bool {
+	displayLock.Lock()
+	defer displayLock.Unlock()
+	if display == nil {
+		return createAbsentDisplay()
+	}
+	err := display.Reset()
+	if err != nil {
+		logger.Debug("sh1106 still absent", zap.Error(err))
+		return false
+	}
+	displayFailures = 0
+	displayHealth.Store(int32(DisplayHealthOk))
+	logger.Info("sh1106 reconnected")
+	// not started yet when the panel was missing since boot
+	if !powerPending.Load() {
+		statusRunner.Start()
+	}
+	return true
+}
+
+// createAbsentDisplay retries a display that could not be created, it must
+// be called with displayLock held
+func createAbsentDisplay() bool {
+	cfg := config.GetSH1106Cfg()
+	device, err := createDisplay(&cfg)
+	if err != nil {
+		logger.Debug("sh1106 still absent", zap.Error(err))
+		return false
+	}
+	setupDisplay(device)
+	if device == nil {
+		return true
+	}
+	if GetDisplayHealth() == DisplayHealthAbsent {
+		return false
+	}
+	logger.Info("sh1106 connected")
+	if !powerPending.Load() {
+		statusRunner.Start()
+	}
+	return true
+}
+
+func GetDisplayHealth() DisplayHealth {
+	return DisplayHealth(displayHealth.Load())
+}
+
 type DrawOptions struct {
 	VerticalAlign   bool
 	HorizontalAlign bool
@@ -149,12 +283,36 @@ func drawText(width, height int, opt *DrawOptions, lines ...string) *image.Gray
 }
 
 func Display(opt *DrawOptions, lines ...string) error {
+	return DisplayDraw(func(width, height int) *image.Gray {
+		return drawText(width, height, opt, lines...)
+	})
+}
+
+// DisplayDraw shows the image paint returns for the panel size
+func DisplayDraw(paint func(width, height int) *image.Gray) error {
 	displayLock.Lock()
 	defer displayLock.Unlock()
-	if display == nil {
+	if display == nil || GetDisplayHealth() == DisplayHealthAbsent {
 		return nil
 	}
-	return display.DisplayImage(drawText(display.GetWidth(), display.GetHeight(), opt, lines...))
+	err := display.DisplayImage(paint(display.GetWidth(), display.GetHeight()))
+	if err != nil {
+		displayFailures++
+		if displayFailures >= displayAbsentFailures {
+			logger.Warn("sh1106 lost, waiting for it to come back", zap.Error(err))
+			setDisplayAbsent()
+		} else {
+			displayHealth.Store(int32(DisplayHealthDegraded))
+		}
+		return err
+	}
+	if displayFailures > 0 {
+		displayFailures = 0
+		displayHealth.Store(int32(DisplayHealthOk))
+		// pages sent while the bus was failing may be lost, resend all of them
+		err = display.Display(true)
+	}
+	return err
 }
 
 var statusOpt = &DrawOptions{
@@ -185,23 +343,26 @@ func resetDisplay(cfg *config.SH1106Config) error {
 	if err != nil {
 		return err
 	}
+	_ = displayProbeRunner.Stop(context.Background())
 	displayLock.Lock()
 	defer displayLock.Unlock()
 	device, err := createDisplay(cfg)
-	if err != nil {
-		return err
+	if err == nil {
+		err = config.SaveSH1106(cfg)
+		if err != nil && device != nil {
+			_ = device.Close()
+		}
 	}
-	err = config.SaveSH1106(cfg)
 	if err != nil {
-		if device != nil {
-			_ = device.Close()
+		if GetDisplayHealth() == DisplayHealthAbsent {
+			displayProbeRunner.Start()
 		}
 		return err
 	}
 	if display != nil {
 		_ = display.Close()
 	}
-	display = device
+	setupDisplay(device)
 	return nil
 }
 
@@ -217,7 +378,40 @@ func SetDisplayConfig(cfg *config.SH1106Config) error {
 	return nil
 }
 
+// GetDisplayContrast returns the contrast the panel runs at
+func GetDisplayContrast() (int, error) {
+	displayLock.Lock()
+	defer displayLock.Unlock()
+	if display == nil {
+		return 0, errors.New("display is disabled")
+	}
+	return int(display.Contrast()), nil
+}
+
+// SetDisplayContrast changes the contrast of the panel, save keeps it in the
+// config file
+func SetDisplayContrast(contrast int, save bool) error {
+	if contrast < 0 || contrast > 255 {
+		return fmt.Errorf("contrast %d out of range 0-255", contrast)
+	}
+	displayLock.Lock()
+	defer displayLock.Unlock()
+	if display == nil {
+		return errors.New("display is disabled")
+	}
+	if err := display.SetContrast(uint8(contrast)); err != nil {
+		return err
+	}
+	if !save {
+		return nil
+	}
+	cfg := config.GetSH1106Cfg()
+	cfg.Contrast = contrast
+	return config.SaveSH1106(&cfg)
+}
+
 func closeDisplay() {
+	_ = displayProbeRunner.Stop(context.Background())
 	displayLock.Lock()
 	defer displayLock.Unlock()
 	if display != nil {
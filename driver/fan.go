@@ -2,78 +2,464 @@ package driver
 
 import (
 	"context"
-	"github.com/stianeikeland/go-rpio/v4"
+	"errors"
+	"fmt"
 	"go.uber.org/atomic"
 	"go.uber.org/zap"
+	"math"
 	"picp/config"
 	"picp/logger"
+	"picp/pwm"
 	"picp/utils"
+	"sync"
 	"time"
 )
 
 const (
+	// rpio pwm clock, the output runs at maxFanHz / maxCycleLen
 	maxFanHz    = 144
-	maxCycleLen = 100
+	maxCycleLen = pwm.MaxDuty
+	// default output frequencies of the other backends
+	fanSysfsHz    = 25000
+	fanSoftwareHz = 50
 )
 
-var fanEnable atomic.Bool
+const (
+	fanAutoTuneCycles  = 4
+	fanAutoTuneTimeout = time.Hour
+)
+
+type FanAutoTuneStatus struct {
+	Running    bool              `json:"running"`
+	Cycles     int               `json:"cycles"`
+	StartTime  time.Time         `json:"start_time"`
+	Suggestion *FanPidSuggestion `json:"suggestion,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+type FanOverride struct {
+	Duty uint32 `json:"duty"`
+	// zero keeps the override until it is cleared
+	ExpireAt time.Time `json:"expire_at"`
+}
+
+func (o *FanOverride) active(now time.Time) bool {
+	return o != nil && (o.ExpireAt.IsZero() || now.Before(o.ExpireAt))
+}
+
+type fanChannel struct {
+	*utils.Runner
+	name            string
+	enable          atomic.Bool
+	duty            atomic.Uint32
+	rpm             atomic.Int64
+	stall           atomic.Bool
+	openFailed      atomic.Bool
+	temperature     atomic.Float32
+	autoTuneRequest atomic.Bool
+	autoTune        atomic.Pointer[FanAutoTuneStatus]
+	override        atomic.Pointer[FanOverride]
+	// settings of the running loop and settings waiting to be picked up by it
+	running        atomic.Pointer[config.FanChanelCfg]
+	pending        atomic.Pointer[config.FanChanelCfg]
+	wake           chan struct{}
+	statusLock     sync.Mutex
+	lastTransition time.Time
+	runtime        time.Duration
+}
+
+var fanCtx context.Context
+var fanChannels = map[string]*fanChannel{}
+var fanChannelsLock sync.RWMutex
 
-var fanRunner *utils.Runner
+var ErrorFanNotFound = errors.New("fan not found")
 
 func fanInit(ctx context.Context) {
-	fanRunner = utils.NewRunner(ctx, runFan)
-	fanRunner.Start()
+	fanCtx = ctx
+	fanChannelsLock.Lock()
+	defer fanChannelsLock.Unlock()
+	for _, name := range config.GetFanNames() {
+		fanChannels[name] = newFanChannel(ctx, name)
+		fanChannels[name].Start()
+	}
 }
 
-func runFan(ctx context.Context) {
-	cfg := config.GetFanCfg()
-	if !cfg.Enable {
+func newFanChannel(ctx context.Context, name string) *fanChannel {
+	c := &fanChannel{name: name, wake: make(chan struct{}, 1)}
+	c.rpm.Store(-1)
+	c.Runner = utils.NewRunner(ctx, c.run)
+	return c
+}
+
+func getFanChannel(name string) (*fanChannel, error) {
+	fanChannelsLock.RLock()
+	defer fanChannelsLock.RUnlock()
+	c, ok := fanChannels[name]
+	if !ok {
+		return nil, ErrorFanNotFound
+	}
+	return c, nil
+}
+
+func (c *fanChannel) run(ctx context.Context) {
+	c.pending.Store(nil)
+	cfg, ok := effectiveFanCfg(c.name)
+	if !ok || !cfg.Enable {
+		return
+	}
+	fanPin, err := openFanOutput(&cfg)
+	c.openFailed.Store(err != nil)
+	if err != nil {
+		logger.Error("open fan pwm failed", zap.String("fan", c.name), zap.String("backend", cfg.Backend), zap.Error(err))
 		return
 	}
-	fanPin := rpio.Pin(cfg.Pin)
-	fanPin.Pwm()
-	fanPin.Freq(maxFanHz)
-	fanPin.DutyCycle(0, maxCycleLen)
-	tik := time.NewTicker(3 * time.Second)
+	running := cfg
+	c.running.Store(&running)
+	tik := time.NewTicker(time.Second * time.Duration(cfg.Interval))
+	var tuner *relayAutoTuner
+	var tuneStatus FanAutoTuneStatus
 	defer func() {
+		c.running.Store(nil)
 		tik.Stop()
-		changeFanSpeed(fanPin, 0)
+		c.changeSpeed(fanPin, 0)
+		if err := fanPin.Close(); err != nil {
+			logger.Warn("close fan pwm failed", zap.String("fan", c.name), zap.Error(err))
+		}
+		c.rpm.Store(-1)
+		c.stall.Store(false)
+		if tuner != nil {
+			tuneStatus.Running = false
+			tuneStatus.Error = "auto tune canceled"
+			c.autoTune.Store(&tuneStatus)
+		}
 	}()
+	controller := newFanController(&cfg)
+	limiter := fanLimiter{
+		minDuty:  float32(cfg.MinDuty),
+		rampRate: cfg.RampRate,
+		maxDuty:  float32(cfg.MaxDuty),
+	}
+	var tach *fanTach
+	var stallSince time.Time
+	c.rpm.Store(-1)
+	c.stall.Store(false)
+	if cfg.TachPin >= 0 {
+		tach, err = newFanTach(cfg.TachPin, cfg.PulsesPerRev)
+		if err != nil {
+			logger.Error("fan tachometer disabled", zap.String("fan", c.name), zap.Error(err))
+		} else {
+			go tach.run(ctx)
+		}
+	}
+	var duty float32
+	lastUpdate := time.Now()
 	for ctx.Err() == nil {
-		temperature, err := utils.GetCpuTemperature()
+		if pending := c.pending.Swap(nil); pending != nil {
+			cfg = *pending
+			c.running.Store(pending)
+			controller = newFanController(&cfg)
+			limiter.minDuty = float32(cfg.MinDuty)
+			limiter.rampRate = cfg.RampRate
+			limiter.maxDuty = float32(cfg.MaxDuty)
+			logger.Info("fan settings reloaded", zap.String("fan", c.name), zap.String("mode", cfg.Mode))
+		}
+		if tach != nil && tach.failed.Load() {
+			c.rpm.Store(-1)
+			stallSince = time.Time{}
+		} else if tach != nil {
+			stallSince = c.checkStall(&cfg, tach.rpm(), stallSince)
+		}
+		temperature, err := readTemperature(cfg.Source)
+		override := c.override.Load()
+		now := time.Now()
+		if override != nil && !override.active(now) {
+			logger.Info("fan override expired", zap.String("fan", c.name))
+			c.override.CompareAndSwap(override, nil)
+			override = nil
+		}
 		if err != nil {
-			logger.Debug("cpu temperature error", zap.Error(err))
+			logger.Debug("fan temperature error", zap.String("fan", c.name), zap.String("source", cfg.Source), zap.Error(err))
+			c.temperature.Store(float32(math.NaN()))
 		} else {
-			if temperature > cfg.MaxTemp && !fanEnable.Load() {
-				changeFanSpeed(fanPin, uint32(cfg.Speed))
-			} else if temperature < cfg.MinTemp && fanEnable.Load() {
-				changeFanSpeed(fanPin, 0)
+			c.temperature.Store(temperature)
+		}
+		if override != nil {
+			if target := float32(override.Duty); math.Round(float64(target)) != math.Round(float64(duty)) {
+				c.changeSpeed(fanPin, override.Duty)
+				duty = target
+			}
+			lastUpdate = now
+		} else if err == nil {
+			dt := now.Sub(lastUpdate)
+			lastUpdate = now
+			if c.autoTuneRequest.CompareAndSwap(true, false) && tuner == nil {
+				logger.Info("fan auto tune started", zap.String("fan", c.name), zap.Float32("target", cfg.Target))
+				tuner = newRelayAutoTuner(cfg.Target, float32(cfg.MinDuty), float32(cfg.MaxDuty), fanAutoTuneCycles)
+				tuneStatus = FanAutoTuneStatus{Running: true, StartTime: now}
+				c.autoTune.Store(&tuneStatus)
+			}
+			var target float32
+			if tuner != nil {
+				var done bool
+				target, done = tuner.update(temperature, dt)
+				status := tuneStatus
+				status.Cycles = len(tuner.switchTimes)
+				if done || now.Sub(status.StartTime) > fanAutoTuneTimeout {
+					status.Running = false
+					status.Suggestion, err = tuner.result()
+					if err != nil {
+						status.Error = err.Error()
+					}
+					logger.Info("fan auto tune finished", zap.String("fan", c.name), zap.Any("status", status))
+					tuner = nil
+					controller = newFanController(&cfg)
+				}
+				tuneStatus = status
+				c.autoTune.Store(&status)
+			} else {
+				target = limiter.limit(duty, controller.update(temperature, dt), dt)
 			}
+			if math.Round(float64(target)) != math.Round(float64(duty)) {
+				if duty == 0 && cfg.KickTime > 0 && float32(cfg.KickDuty) > target {
+					c.changeSpeed(fanPin, uint32(cfg.KickDuty))
+					select {
+					case <-time.After(time.Millisecond * time.Duration(cfg.KickTime)):
+					case <-ctx.Done():
+						return
+					}
+				}
+				c.changeSpeed(fanPin, uint32(math.Round(float64(target))))
+			}
+			duty = target
 		}
 		select {
 		case <-tik.C:
+		case <-c.wake:
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func changeFanSpeed(fanPin rpio.Pin, speed uint32) {
-	logger.Debug("change fan speed", zap.Uint32("speed", speed))
-	fanEnable.Store(speed != 0)
-	fanPin.DutyCycle(speed, maxCycleLen)
+func (c *fanChannel) checkStall(cfg *config.FanChanelCfg, rpm int64, stallSince time.Time) time.Time {
+	c.rpm.Store(rpm)
+	if c.duty.Load() == 0 || rpm > 0 {
+		if c.stall.Swap(false) {
+			logger.Info("fan stall cleared", zap.String("fan", c.name), zap.Int64("rpm", rpm))
+		}
+		return time.Time{}
+	}
+	if stallSince.IsZero() {
+		return time.Now()
+	}
+	if time.Since(stallSince) >= time.Second*time.Duration(cfg.StallTimeout) && !c.stall.Swap(true) {
+		logger.Error("fan stalled", zap.String("fan", c.name), zap.Uint32("duty", c.duty.Load()), zap.Time("since", stallSince))
+	}
+	return stallSince
+}
+
+func openFanOutput(cfg *config.FanChanelCfg) (pwm.Output, error) {
+	switch cfg.Backend {
+	case pwm.BackendSysfs:
+		frequency := cfg.Frequency
+		if frequency == 0 {
+			frequency = fanSysfsHz
+		}
+		return pwm.NewSysfs(cfg.PwmChip, cfg.PwmChannel, frequency)
+	case pwm.BackendSoftware:
+		frequency := cfg.Frequency
+		if frequency == 0 {
+			frequency = fanSoftwareHz
+		}
+		return pwm.NewSoftware(cfg.Pin, frequency)
+	default:
+		clock := maxFanHz
+		if cfg.Frequency > 0 {
+			clock = cfg.Frequency * maxCycleLen
+		}
+		return pwm.NewRpio(cfg.Pin, clock)
+	}
+}
+
+func (c *fanChannel) changeSpeed(fanPin pwm.Output, speed uint32) {
+	logger.Debug("change fan speed", zap.String("fan", c.name), zap.Uint32("speed", speed))
+	on := speed != 0
+	c.statusLock.Lock()
+	if on != c.enable.Load() {
+		now := time.Now()
+		if !on {
+			c.runtime += now.Sub(c.lastTransition)
+		}
+		c.lastTransition = now
+	}
+	c.enable.Store(on)
+	c.statusLock.Unlock()
+	c.duty.Store(speed)
+	if err := fanPin.SetDuty(speed); err != nil {
+		logger.Warn("set fan duty failed", zap.String("fan", c.name), zap.Error(err))
+	}
 }
 
-func SetFanConfig(cfg *config.FanChanelCfg) error {
-	err := config.SetFanCfg(cfg)
+func SetFanConfig(name string, cfg *config.FanChanelCfg) error {
+	err := config.SetFanChannelCfg(name, cfg)
 	if err != nil {
 		return err
 	}
-	_ = fanRunner.Stop(context.Background())
-	fanRunner.Start()
+	fanChannelsLock.Lock()
+	c, ok := fanChannels[name]
+	if !ok {
+		c = newFanChannel(fanCtx, name)
+		fanChannels[name] = c
+	}
+	fanChannelsLock.Unlock()
+	c.reload()
 	return nil
 }
 
+// reload applies the current settings, a running channel keeps its pwm
+// output open when only control settings changed
+func (c *fanChannel) reload() {
+	cfg, ok := effectiveFanCfg(c.name)
+	running := c.running.Load()
+	if ok && cfg.Enable && running != nil && sameFanHardware(running, &cfg) {
+		c.pending.Store(&cfg)
+		c.notify()
+		return
+	}
+	_ = c.Stop(context.Background())
+	c.Start()
+}
+
+func sameFanHardware(a, b *config.FanChanelCfg) bool {
+	return a.Backend == b.Backend && a.Pin == b.Pin && a.PwmChip == b.PwmChip && a.PwmChannel == b.PwmChannel &&
+		a.Frequency == b.Frequency && a.TachPin == b.TachPin && a.PulsesPerRev == b.PulsesPerRev && a.Interval == b.Interval
+}
+
+func StartFanAutoTune(name string) error {
+	c, err := getFanChannel(name)
+	if err != nil {
+		return err
+	}
+	cfg, _ := config.GetFanChannelCfg(name)
+	if !cfg.Enable {
+		return errors.New("fan is disabled")
+	}
+	if status := c.autoTune.Load(); status != nil && status.Running {
+		return errors.New("fan auto tune is already running")
+	}
+	c.autoTuneRequest.Store(true)
+	return nil
+}
+
+type FanSpeed struct {
+	Duty     uint32 `json:"duty"`
+	Rpm      int64  `json:"rpm"`
+	Stall    bool   `json:"stall"`
+	Override bool   `json:"override"`
+}
+
+type FanStatus struct {
+	FanSpeed
+	Enable         bool         `json:"enable"`
+	Temperature    *float32     `json:"temperature"`
+	LastTransition time.Time    `json:"last_transition"`
+	Runtime        float64      `json:"runtime"`
+	OverrideInfo   *FanOverride `json:"override_info,omitempty"`
+}
+
+// GetFanSpeed returns the current duty, the measured rpm (-1 without a working tachometer)
+// and whether the fan is stalled
+func GetFanSpeed(name string) (*FanSpeed, error) {
+	c, err := getFanChannel(name)
+	if err != nil {
+		return nil, err
+	}
+	return &FanSpeed{
+		Duty:     c.duty.Load(),
+		Rpm:      c.rpm.Load(),
+		Stall:    c.stall.Load(),
+		Override: c.override.Load().active(time.Now()),
+	}, nil
+}
+
+func GetFanStatus(name string) (*FanStatus, error) {
+	speed, err := GetFanSpeed(name)
+	if err != nil {
+		return nil, err
+	}
+	c, _ := getFanChannel(name)
+	status := &FanStatus{FanSpeed: *speed}
+	if temperature := c.temperature.Load(); !math.IsNaN(float64(temperature)) && c.IsRunning() {
+		status.Temperature = &temperature
+	}
+	c.statusLock.Lock()
+	status.Enable = c.enable.Load()
+	status.LastTransition = c.lastTransition
+	runtime := c.runtime
+	if status.Enable {
+		runtime += time.Since(c.lastTransition)
+	}
+	c.statusLock.Unlock()
+	status.Runtime = runtime.Seconds()
+	if override := c.override.Load(); override.active(time.Now()) {
+		status.OverrideInfo = override
+	}
+	return status, nil
+}
+
+// SetFanOverride holds the fan at a fixed duty, for duration or until cleared when duration is zero
+func SetFanOverride(name string, duty uint32, duration time.Duration) error {
+	c, err := getFanChannel(name)
+	if err != nil {
+		return err
+	}
+	if duty > maxCycleLen {
+		return fmt.Errorf("fan duty %d out of range 0-%d", duty, maxCycleLen)
+	}
+	if !c.IsRunning() {
+		return errors.New("fan is disabled")
+	}
+	override := &FanOverride{Duty: duty}
+	if duration > 0 {
+		override.ExpireAt = time.Now().Add(duration)
+	}
+	logger.Info("fan override", zap.String("fan", name), zap.Any("override", override))
+	c.override.Store(override)
+	c.notify()
+	return nil
+}
+
+func ClearFanOverride(name string) error {
+	c, err := getFanChannel(name)
+	if err != nil {
+		return err
+	}
+	if c.override.Swap(nil) != nil {
+		logger.Info("fan override cleared", zap.String("fan", name))
+		c.notify()
+	}
+	return nil
+}
+
+func (c *fanChannel) notify() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+func GetFanAutoTune(name string) (*FanAutoTuneStatus, error) {
+	c, err := getFanChannel(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.autoTune.Load(), nil
+}
+
 func closeFan() {
-	_ = fanRunner.Stop(context.Background())
+	fanChannelsLock.RLock()
+	defer fanChannelsLock.RUnlock()
+	for _, c := range fanChannels {
+		_ = c.Stop(context.Background())
+	}
 }
@@ -0,0 +1,167 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"picp/config"
+	"picp/logger"
+	"picp/utils"
+	"time"
+)
+
+// the schedule switches on whole minutes
+const fanProfileInterval = 15 * time.Second
+
+type FanProfileSwitch struct {
+	Profile string `json:"profile"`
+	// zero keeps the profile until the switch is cleared
+	RevertAt time.Time `json:"revert_at"`
+}
+
+func (s *FanProfileSwitch) active(now time.Time) bool {
+	return s != nil && (s.RevertAt.IsZero() || now.Before(s.RevertAt))
+}
+
+type FanProfileStatus struct {
+	// empty when the channel settings are used as they are
+	Active    string            `json:"active"`
+	Scheduled string            `json:"scheduled"`
+	Manual    *FanProfileSwitch `json:"manual,omitempty"`
+}
+
+var fanProfileRunner *utils.Runner
+var fanProfileActive atomic.String
+var fanProfileManual atomic.Pointer[FanProfileSwitch]
+var fanProfileWake = make(chan struct{}, 1)
+
+func fanProfileInit(ctx context.Context) {
+	fanProfileActive.Store(scheduledFanProfile(time.Now()))
+	fanProfileRunner = utils.NewRunner(ctx, runFanProfile)
+	fanProfileRunner.Start()
+}
+
+func scheduledFanProfile(now time.Time) string {
+	schedule := config.GetFanSchedule()
+	if !schedule.Enable {
+		return ""
+	}
+	return schedule.ProfileAt(now)
+}
+
+func runFanProfile(ctx context.Context) {
+	ticker := time.NewTicker(fanProfileInterval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		profile := scheduledFanProfile(now)
+		if manual := fanProfileManual.Load(); manual != nil {
+			if manual.active(now) {
+				profile = manual.Profile
+			} else if fanProfileManual.CompareAndSwap(manual, nil) {
+				logger.Info("fan profile switch expired", zap.String("profile", manual.Profile))
+			}
+		}
+		if old := fanProfileActive.Swap(profile); old != profile {
+			logger.Info("fan profile changed", zap.String("from", old), zap.String("to", profile))
+			reloadFans()
+		}
+		select {
+		case <-ticker.C:
+		case <-fanProfileWake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func notifyFanProfile() {
+	select {
+	case fanProfileWake <- struct{}{}:
+	default:
+	}
+}
+
+func reloadFans() {
+	fanChannelsLock.RLock()
+	defer fanChannelsLock.RUnlock()
+	for _, c := range fanChannels {
+		c.reload()
+	}
+}
+
+// effectiveFanCfg returns the channel settings with the active profile applied
+func effectiveFanCfg(name string) (config.FanChanelCfg, bool) {
+	cfg, ok := config.GetFanChannelCfg(name)
+	if !ok || !cfg.Enable {
+		return cfg, ok
+	}
+	profile, found := config.GetFanProfile(fanProfileActive.Load())
+	if !found || !profile.AppliesTo(name) {
+		return cfg, ok
+	}
+	base := cfg
+	if err := profile.Apply(&cfg); err != nil {
+		logger.Error("apply fan profile failed", zap.String("fan", name), zap.Error(err))
+		return base, ok
+	}
+	return cfg, ok
+}
+
+func GetFanProfileStatus() *FanProfileStatus {
+	status := &FanProfileStatus{
+		Active:    fanProfileActive.Load(),
+		Scheduled: scheduledFanProfile(time.Now()),
+	}
+	if manual := fanProfileManual.Load(); manual.active(time.Now()) {
+		status.Manual = manual
+	}
+	return status
+}
+
+// SetFanProfile switches to profile until duration passed, or until the
+// switch is cleared when duration is zero. An empty profile selects the
+// channel settings
+func SetFanProfile(profile string, duration time.Duration) error {
+	if profile != "" {
+		if _, ok := config.GetFanProfile(profile); !ok {
+			return fmt.Errorf("fan profile %s not found", profile)
+		}
+	}
+	manual := &FanProfileSwitch{Profile: profile}
+	if duration > 0 {
+		manual.RevertAt = time.Now().Add(duration)
+	}
+	logger.Info("fan profile switch", zap.Any("switch", manual))
+	fanProfileManual.Store(manual)
+	notifyFanProfile()
+	return nil
+}
+
+func ClearFanProfile() {
+	if fanProfileManual.Swap(nil) != nil {
+		logger.Info("fan profile switch cleared")
+		notifyFanProfile()
+	}
+}
+
+func SetFanProfilesConfig(cfg *config.FanProfiles) error {
+	err := config.SetFanProfilesCfg(cfg)
+	if err != nil {
+		return err
+	}
+	if manual := fanProfileManual.Load(); manual != nil && manual.Profile != "" {
+		if _, ok := config.GetFanProfile(manual.Profile); !ok {
+			fanProfileManual.CompareAndSwap(manual, nil)
+		}
+	}
+	// the settings of the active profile may have changed too
+	reloadFans()
+	notifyFanProfile()
+	return nil
+}
+
+func closeFanProfile() {
+	_ = fanProfileRunner.Stop(context.Background())
+}
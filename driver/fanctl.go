@@ -0,0 +1,283 @@
+package driver
+
+import (
+	"errors"
+	"math"
+	"picp/config"
+	"time"
+)
+
+// fanController turns a temperature sample into a target duty in percent
+type fanController interface {
+	update(temperature float32, dt time.Duration) float32
+}
+
+func newFanController(cfg *config.FanChanelCfg) fanController {
+	switch cfg.Mode {
+	case config.FanModeCurve:
+		return &curveController{curve: cfg.Curve, stopHysteresis: cfg.StopHysteresis, minDuty: float32(cfg.MinDuty)}
+	case config.FanModePid:
+		return &pidController{
+			kp:     cfg.Kp,
+			ki:     cfg.Ki,
+			kd:     cfg.Kd,
+			target: cfg.Target,
+			maxOut: float32(cfg.MaxDuty),
+		}
+	default:
+		return &hysteresisController{
+			speed:   float32(cfg.Speed),
+			minTemp: cfg.MinTemp,
+			maxTemp: cfg.MaxTemp,
+		}
+	}
+}
+
+// hysteresisController switches between off and a fixed speed
+type hysteresisController struct {
+	speed   float32
+	minTemp float32
+	maxTemp float32
+	on      bool
+}
+
+func (c *hysteresisController) update(temperature float32, _ time.Duration) float32 {
+	if temperature > c.maxTemp {
+		c.on = true
+	} else if temperature < c.minTemp {
+		c.on = false
+	}
+	if c.on {
+		return c.speed
+	}
+	return 0
+}
+
+// curveController keeps a running fan at its minimum duty until the
+// temperature is stopHysteresis below where the curve starts it, so it does
+// not start and stop around that point
+type curveController struct {
+	curve          config.FanCurve
+	stopHysteresis float32
+	minDuty        float32
+	running        bool
+}
+
+func (c *curveController) update(temperature float32, _ time.Duration) float32 {
+	duty := interpolateCurve(c.curve, temperature)
+	if duty > 0 {
+		c.running = true
+		return duty
+	}
+	if c.running && len(c.curve) > 0 && temperature > c.curve[0].Temp-c.stopHysteresis {
+		// any duty above zero keeps it running, the limiter raises it to min_duty
+		return max(c.minDuty, 1)
+	}
+	c.running = false
+	return 0
+}
+
+func interpolateCurve(curve config.FanCurve, temperature float32) float32 {
+	if len(curve) == 0 {
+		return 0
+	}
+	if temperature <= curve[0].Temp {
+		return float32(curve[0].Duty)
+	}
+	for i := 1; i < len(curve); i++ {
+		if temperature <= curve[i].Temp {
+			low, high := curve[i-1], curve[i]
+			ratio := (temperature - low.Temp) / (high.Temp - low.Temp)
+			return float32(low.Duty) + ratio*float32(high.Duty-low.Duty)
+		}
+	}
+	return float32(curve[len(curve)-1].Duty)
+}
+
+// pidController drives the duty up while the temperature is above the target,
+// the integral only accumulates while the output is not saturated
+type pidController struct {
+	kp       float32
+	ki       float32
+	kd       float32
+	target   float32
+	maxOut   float32
+	integral float32
+	lastErr  float32
+	hasLast  bool
+}
+
+func (c *pidController) update(temperature float32, dt time.Duration) float32 {
+	e := temperature - c.target
+	seconds := float32(dt.Seconds())
+	var derivative float32
+	if c.hasLast && seconds > 0 {
+		derivative = c.kd * (e - c.lastErr) / seconds
+	}
+	c.lastErr = e
+	c.hasLast = true
+	integral := c.integral + c.ki*e*seconds
+	out := c.kp*e + integral + derivative
+	if out > c.maxOut {
+		out = c.maxOut
+		if e < 0 {
+			c.integral = integral
+		}
+	} else if out < 0 {
+		out = 0
+		if e > 0 {
+			c.integral = integral
+		}
+	} else {
+		c.integral = integral
+	}
+	c.integral = clamp(c.integral, 0, c.maxOut)
+	return out
+}
+
+func clamp(value, low, high float32) float32 {
+	if value < low {
+		return low
+	}
+	if value > high {
+		return high
+	}
+	return value
+}
+
+type FanPidSuggestion struct {
+	Kp float32 `json:"kp"`
+	Ki float32 `json:"ki"`
+	Kd float32 `json:"kd"`
+	Ku float32 `json:"ku"`
+	Tu float32 `json:"tu"`
+}
+
+// relayAutoTuner switches the fan between two duties around the target
+// and derives Ziegler-Nichols gains from the resulting oscillation
+type relayAutoTuner struct {
+	target      float32
+	hysteresis  float32
+	high        float32
+	low         float32
+	cycles      int
+	output      float32
+	started     bool
+	peakHigh    float32
+	peakLow     float32
+	highs       []float32
+	lows        []float32
+	switchTimes []time.Duration
+	elapsed     time.Duration
+}
+
+func newRelayAutoTuner(target, low, high float32, cycles int) *relayAutoTuner {
+	return &relayAutoTuner{
+		target:     target,
+		hysteresis: 0.5,
+		high:       high,
+		low:        low,
+		cycles:     cycles,
+	}
+}
+
+// update returns the duty for the next interval and whether enough cycles were seen
+func (t *relayAutoTuner) update(temperature float32, dt time.Duration) (float32, bool) {
+	if !t.started {
+		t.started = true
+		t.peakHigh = temperature
+		t.peakLow = temperature
+		if temperature > t.target {
+			t.output = t.high
+		} else {
+			t.output = t.low
+		}
+		return t.output, false
+	}
+	t.elapsed += dt
+	if t.output == t.high {
+		if temperature < t.peakLow {
+			t.peakLow = temperature
+		}
+		if temperature < t.target-t.hysteresis {
+			t.output = t.low
+			t.lows = append(t.lows, t.peakLow)
+			t.peakHigh = temperature
+		}
+	} else {
+		if temperature > t.peakHigh {
+			t.peakHigh = temperature
+		}
+		if temperature > t.target+t.hysteresis {
+			t.output = t.high
+			t.highs = append(t.highs, t.peakHigh)
+			t.switchTimes = append(t.switchTimes, t.elapsed)
+			t.peakLow = temperature
+		}
+	}
+	return t.output, len(t.switchTimes) > t.cycles
+}
+
+func (t *relayAutoTuner) result() (*FanPidSuggestion, error) {
+	if len(t.switchTimes) < 2 || len(t.highs) < 2 || len(t.lows) < 2 {
+		return nil, errors.New("not enough oscillation cycles")
+	}
+	// the first half cycle starts from an arbitrary temperature, skip it
+	amplitude := (average(t.highs[1:]) - average(t.lows[1:])) / 2
+	if amplitude <= 0 {
+		return nil, errors.New("no temperature oscillation")
+	}
+	period := (t.switchTimes[len(t.switchTimes)-1] - t.switchTimes[0]).Seconds() / float64(len(t.switchTimes)-1)
+	ku := 4 * (t.high - t.low) / 2 / (math.Pi * amplitude)
+	tu := float32(period)
+	return &FanPidSuggestion{
+		Kp: 0.6 * ku,
+		Ki: 1.2 * ku / tu,
+		Kd: 0.075 * ku * tu,
+		Ku: ku,
+		Tu: tu,
+	}, nil
+}
+
+func average(values []float32) float32 {
+	var sum float32
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float32(len(values))
+}
+
+// fanLimiter keeps a running fan between its minimum and maximum duty and
+// limits how fast the duty may change, starting and stopping are not rate
+// limited
+type fanLimiter struct {
+	minDuty  float32
+	rampRate float32
+	// 0 allows maxCycleLen
+	maxDuty float32
+}
+
+func (l *fanLimiter) limit(current, target float32, dt time.Duration) float32 {
+	if target <= 0 {
+		return 0
+	}
+	if target < l.minDuty {
+		target = l.minDuty
+	}
+	if l.rampRate > 0 && current > 0 {
+		step := l.rampRate * float32(dt.Seconds())
+		if target > current+step {
+			target = current + step
+		} else if target < current-step {
+			target = current - step
+		}
+	}
+	limit := float32(maxCycleLen)
+	if l.maxDuty > 0 {
+		limit = min(l.maxDuty, limit)
+	}
+	if target > limit {
+		target = limit
+	}
+	return target
+}
@@ -0,0 +1,164 @@
+package driver
+
+import (
+	"picp/config"
+	"testing"
+	"time"
+)
+
+func TestInterpolateCurve(t *testing.T) {
+	curve := config.FanCurve{
+		{Temp: 40, Duty: 0},
+		{Temp: 50, Duty: 40},
+		{Temp: 60, Duty: 100},
+	}
+	tests := []struct {
+		name        string
+		temperature float32
+		want        float32
+	}{
+		{name: "below", temperature: 30, want: 0},
+		{name: "first", temperature: 40, want: 0},
+		{name: "between", temperature: 45, want: 20},
+		{name: "point", temperature: 50, want: 40},
+		{name: "upper", temperature: 55, want: 70},
+		{name: "above", temperature: 80, want: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := interpolateCurve(curve, tt.temperature); got != tt.want {
+				t.Errorf("interpolateCurve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFanLimiter(t *testing.T) {
+	limiter := fanLimiter{minDuty: 30, rampRate: 5}
+	tests := []struct {
+		name    string
+		current float32
+		target  float32
+		want    float32
+	}{
+		{name: "off", current: 50, target: 0, want: 0},
+		{name: "start below min", current: 0, target: 10, want: 30},
+		{name: "start unlimited", current: 0, target: 80, want: 80},
+		{name: "ramp up", current: 40, target: 80, want: 50},
+		{name: "ramp down", current: 80, target: 40, want: 70},
+		{name: "small step", current: 40, target: 45, want: 45},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limiter.limit(tt.current, tt.target, 2*time.Second); got != tt.want {
+				t.Errorf("limit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPidController(t *testing.T) {
+	c := pidController{kp: 10, ki: 1, kd: 0, target: 50, maxOut: 100}
+	if got := c.update(45, time.Second); got != 0 {
+		t.Errorf("below target update() = %v, want 0", got)
+	}
+	if c.integral != 0 {
+		t.Errorf("integral wound below zero: %v", c.integral)
+	}
+	if got := c.update(52, time.Second); got != 22 {
+		t.Errorf("above target update() = %v, want 22", got)
+	}
+	for i := 0; i < 100; i++ {
+		c.update(80, time.Second)
+	}
+	if c.integral > c.maxOut {
+		t.Errorf("integral wound above max: %v", c.integral)
+	}
+	if got := c.update(50, time.Second); got >= 100 {
+		t.Errorf("update() stuck saturated at target: %v", got)
+	}
+}
+
+func TestRelayAutoTuner(t *testing.T) {
+	tuner := newRelayAutoTuner(50, 0, 100, 3)
+	// temperature follows the relay: +1 per second while off, -1 while on
+	temperature := float32(50)
+	done := false
+	for i := 0; i < 1000 && !done; i++ {
+		var duty float32
+		duty, done = tuner.update(temperature, time.Second)
+		if duty > 0 {
+			temperature--
+		} else {
+			temperature++
+		}
+	}
+	if !done {
+		t.Fatal("auto tune did not finish")
+	}
+	got, err := tuner.result()
+	if err != nil {
+		t.Fatal("result", err)
+	}
+	if got.Tu <= 0 || got.Ku <= 0 || got.Kp <= 0 || got.Ki <= 0 || got.Kd <= 0 {
+		t.Errorf("result() = %+v, want positive gains", got)
+	}
+}
+
+func TestCurveStopHysteresis(t *testing.T) {
+	cfg := config.FanChanelCfg{
+		Mode:           config.FanModeCurve,
+		Curve:          config.FanCurve{{Temp: 45, Duty: 0}, {Temp: 50, Duty: 40}},
+		MinDuty:        30,
+		StopHysteresis: 3,
+	}
+	controller := newFanController(&cfg)
+	limiter := fanLimiter{minDuty: float32(cfg.MinDuty)}
+	var duty float32
+	starts, stops := 0, 0
+	// wobbling around the first curve point, then cooling down well below it
+	for _, temperature := range []float32{44, 45.5, 44.5, 45.5, 44, 45.2, 43, 42.5, 41.9, 41, 44.9} {
+		next := limiter.limit(duty, controller.update(temperature, time.Second), time.Second)
+		if duty == 0 && next > 0 {
+			starts++
+		}
+		if duty > 0 && next == 0 {
+			stops++
+			if temperature > 42 {
+				t.Errorf("stopped at %v, want below %v", temperature, 42)
+			}
+		}
+		duty = next
+	}
+	if starts != 1 || stops != 1 {
+		t.Errorf("fan started %d and stopped %d times, want once each", starts, stops)
+	}
+}
+
+func TestCurveMaxDuty(t *testing.T) {
+	cfg := config.FanChanelCfg{
+		Mode:    config.FanModeCurve,
+		Curve:   config.FanCurve{{Temp: 45, Duty: 0}, {Temp: 50, Duty: 40}, {Temp: 60, Duty: 100}},
+		MinDuty: 30,
+		MaxDuty: 60,
+	}
+	controller := newFanController(&cfg)
+	limiter := fanLimiter{minDuty: float32(cfg.MinDuty), maxDuty: float32(cfg.MaxDuty)}
+	tests := []struct {
+		name        string
+		temperature float32
+		want        float32
+	}{
+		{name: "below the cap", temperature: 50, want: 40},
+		{name: "between points", temperature: 55, want: 60},
+		{name: "last point", temperature: 60, want: 60},
+		{name: "above the curve", temperature: 80, want: 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limiter.limit(0, controller.update(tt.temperature, time.Second), time.Second); got != tt.want {
+				t.Errorf("limit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,24 +2,54 @@ package driver
 
 import (
 	"context"
-	"github.com/stianeikeland/go-rpio/v4"
 	"go.uber.org/zap"
+	"picp/config"
+	"picp/gpio"
 	"picp/logger"
 )
 
 func Init(ctx context.Context) {
-	err := rpio.Open()
-	if err != nil {
-		logger.Fatal("open rpio failed", zap.Error(err))
-	}
+	openGpio()
+	rtcInit(ctx)
 	initStatusRunner(ctx)
 	sh1106Init(ctx)
 	wifiInit(ctx)
+	buttonInit(ctx)
+	fanProfileInit(ctx)
 	fanInit(ctx)
+	upsInit(ctx)
+	protectInit(ctx)
+	ledInit(ctx)
+	buzzerInit(ctx)
+	stripInit(ctx)
+	userGpioInit(ctx)
+	watchdogInit(ctx)
 }
 func Close() {
+	closeWatchdog()
+	closeUserGpio()
+	closeStrip()
+	closeBuzzer()
+	closeLed()
+	closeProtect()
+	closeUps()
+	closeButton()
 	closeWifi()
 	closeStatus()
+	closeFanProfile()
 	closeFan()
 	closeDisplay()
+	closeRtc()
+	_ = gpio.Close()
+}
+
+// openGpio runs first, features needing a pin report a failure themselves
+// and the rest keeps working
+func openGpio() {
+	err := gpio.Open(config.Common.GpioBackend, config.Common.GpioChip)
+	if err != nil {
+		logger.Error("open gpio failed", zap.Error(err))
+	} else {
+		logger.Info("gpio opened", zap.String("backend", gpio.Backend()), zap.Bool("rpio", gpio.RpioMapped()))
+	}
 }
@@ -0,0 +1,254 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"picp/config"
+	"picp/led"
+	"picp/logger"
+	"picp/utils"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LedState is what the LEDs show, a higher state wins over the lower ones
+type LedState int
+
+const (
+	LedStateIdle LedState = iota
+	LedStateWifiConnected
+	LedStateWifiConnecting
+	LedStateApActive
+	LedStateOverheat
+	LedStateError
+)
+
+var ledStateString = []string{"idle", "wifi_connected", "wifi_connecting", "ap_active", "overheat", "error"}
+
+func (s LedState) String() string {
+	if int(s) >= len(ledStateString) {
+		return fmt.Sprintf("unknown(%d)", s)
+	}
+	return ledStateString[s]
+}
+
+func (s LedState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// nmcli is too slow to be asked more often
+const ledStateInterval = 2 * time.Second
+
+const wifiDeviceType = "wifi"
+
+var ErrorLedNotFound = errors.New("led not found")
+
+type LedOverride struct {
+	Pattern string `json:"pattern"`
+	// zero keeps the override until it is cleared
+	ExpireAt time.Time `json:"expire_at"`
+}
+
+func (o *LedOverride) active(now time.Time) bool {
+	return o != nil && (o.ExpireAt.IsZero() || now.Before(o.ExpireAt))
+}
+
+type LedStatus struct {
+	Name     string       `json:"name"`
+	State    LedState     `json:"state"`
+	Pattern  string       `json:"pattern"`
+	Override *LedOverride `json:"override,omitempty"`
+}
+
+type ledChannel struct {
+	cfg      config.Led
+	out      led.Output
+	blinker  *led.Blinker
+	override atomic.Pointer[LedOverride]
+}
+
+func (c *ledChannel) pattern(state LedState) string {
+	return []string{c.cfg.Idle, c.cfg.WifiConnected, c.cfg.WifiConnecting,
+		c.cfg.ApActive, c.cfg.Overheat, c.cfg.Error}[state]
+}
+
+func (c *ledChannel) update(state LedState, now time.Time) {
+	if override := c.override.Load(); override.active(now) {
+		c.blinker.SetPattern(override.Pattern)
+	} else {
+		c.blinker.SetPattern(c.pattern(state))
+	}
+}
+
+var ledRunner *utils.Runner
+var ledChannels = map[string]*ledChannel{}
+var ledLock sync.RWMutex
+var ledState atomic.Int32
+var ledWake = make(chan struct{}, 1)
+
+func ledInit(ctx context.Context) {
+	ledRunner = utils.NewRunner(ctx, runLeds)
+	ledRunner.Start()
+}
+
+func openLed(cfg *config.Led) (led.Output, error) {
+	if cfg.Sysfs != "" {
+		return led.NewSysfs(cfg.Sysfs)
+	}
+	return led.NewGpio(cfg.Pin, cfg.Active == "low")
+}
+
+func runLeds(ctx context.Context) {
+	var wg sync.WaitGroup
+	channels := map[string]*ledChannel{}
+	for _, cfg := range config.GetLeds() {
+		out, err := openLed(&cfg)
+		if err != nil {
+			logger.Error("open led failed", zap.String("name", cfg.Name), zap.Error(err))
+			continue
+		}
+		c := &ledChannel{cfg: cfg, out: out, blinker: led.NewBlinker(out)}
+		channels[cfg.Name] = c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.blinker.Run(ctx); err != nil {
+				logger.Warn("led stopped", zap.String("name", c.cfg.Name), zap.Error(err))
+			}
+			if err := c.out.Close(); err != nil {
+				logger.Debug("close led failed", zap.String("name", c.cfg.Name), zap.Error(err))
+			}
+		}()
+	}
+	ledLock.Lock()
+	ledChannels = channels
+	ledLock.Unlock()
+	defer func() {
+		wg.Wait()
+		ledLock.Lock()
+		ledChannels = map[string]*ledChannel{}
+		ledLock.Unlock()
+	}()
+	if len(channels) == 0 {
+		return
+	}
+	ticker := time.NewTicker(ledStateInterval)
+	defer ticker.Stop()
+	for {
+		state := currentLedState()
+		ledState.Store(int32(state))
+		now := time.Now()
+		for _, c := range channels {
+			c.update(state, now)
+		}
+		select {
+		case <-ticker.C:
+		case <-ledWake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// currentLedState picks the highest state that applies
+func currentLedState() LedState {
+	if serviceError() {
+		return LedStateError
+	}
+	if GetProtectStatus().Level >= ProtectLevelWarning {
+		return LedStateOverheat
+	}
+	return wifiLedState()
+}
+
+// wifiLedState is the highest of idle, wifi_connected, wifi_connecting and
+// ap_active that applies
+func wifiLedState() LedState {
+	if wifiApActive.Load() {
+		return LedStateApActive
+	}
+	state, _ := wifiDeviceState()
+	return state
+}
+
+// serviceError reports a stalled fan or a display that stopped answering
+func serviceError() bool {
+	return fanStalled() || config.GetSH1106Cfg().Enable && GetDisplayHealth() != DisplayHealthOk
+}
+
+func getLedChannel(name string) (*ledChannel, error) {
+	ledLock.RLock()
+	defer ledLock.RUnlock()
+	c, ok := ledChannels[name]
+	if !ok {
+		return nil, ErrorLedNotFound
+	}
+	return c, nil
+}
+
+func wakeLeds() {
+	select {
+	case ledWake <- struct{}{}:
+	default:
+	}
+}
+
+func GetLedStatus() []LedStatus {
+	ledLock.RLock()
+	defer ledLock.RUnlock()
+	state := LedState(ledState.Load())
+	now := time.Now()
+	ret := make([]LedStatus, 0, len(ledChannels))
+	for name, c := range ledChannels {
+		status := LedStatus{Name: name, State: state, Pattern: c.blinker.Pattern()}
+		if override := c.override.Load(); override.active(now) {
+			status.Override = override
+		}
+		ret = append(ret, status)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// SetLedOverride shows pattern regardless of the state, for duration or until
+// cleared when duration is zero
+func SetLedOverride(name, pattern string, duration time.Duration) error {
+	if err := led.Check(pattern); err != nil {
+		return err
+	}
+	c, err := getLedChannel(name)
+	if err != nil {
+		return err
+	}
+	override := &LedOverride{Pattern: pattern}
+	if duration > 0 {
+		override.ExpireAt = time.Now().Add(duration)
+	}
+	logger.Info("led override", zap.String("led", name), zap.Any("override", override))
+	c.override.Store(override)
+	wakeLeds()
+	return nil
+}
+
+func ClearLedOverride(name string) error {
+	c, err := getLedChannel(name)
+	if err != nil {
+		return err
+	}
+	if c.override.Swap(nil) != nil {
+		logger.Info("led override cleared", zap.String("led", name))
+		wakeLeds()
+	}
+	return nil
+}
+
+func closeLed() {
+	_ = ledRunner.Stop(context.Background())
+}
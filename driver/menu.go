@@ -0,0 +1,570 @@
+package driver
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"picp/config"
+	"picp/logger"
+	"picp/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is shown by the menu, set by main before Init
+var Version string
+
+// a title line and the items below it fill the 64 pixel panel
+const menuVisibleItems = statusMaxLines - 1
+
+// menu work done this fast needs no "Working..." in between
+const menuWorkingDelay = 200 * time.Millisecond
+
+const wifiConnectionType = "802-11-wireless"
+
+var menuOpt = &DrawOptions{}
+
+// menuItem either opens a submenu built by items, runs action, whose
+// result lines are shown until the next button press, or adjusts a value
+type menuItem struct {
+	label   string
+	items   func() []menuItem
+	action  func() ([]string, error)
+	adjust  func() (*menuAdjust, error)
+	confirm bool
+}
+
+// menuAdjust changes a value with up and down or the turns of an encoder,
+// every change is applied right away. Select keeps the value, back restores
+// what was there before.
+type menuAdjust struct {
+	title    string
+	unit     string
+	value    int
+	min, max int
+	step     int
+	apply    func(value int) error
+	// keep is optional, for values that are saved once chosen
+	keep    func(value int) error
+	restore func() error
+}
+
+func (a *menuAdjust) change(steps int) error {
+	value := min(max(a.value+steps*a.step, a.min), a.max)
+	if value == a.value {
+		return nil
+	}
+	if err := a.apply(value); err != nil {
+		return err
+	}
+	a.value = value
+	return nil
+}
+
+type menuFrame struct {
+	title  string
+	build  func() []menuItem
+	items  []menuItem
+	cursor int
+	// a confirmation closes itself once its result was seen
+	confirm bool
+}
+
+func (f *menuFrame) setItems(items []menuItem) {
+	f.items = items
+	if f.cursor >= len(f.items) {
+		f.cursor = max(len(f.items)-1, 0)
+	}
+}
+
+type menuState struct {
+	lock     sync.Mutex
+	frames   []*menuFrame
+	message  []string
+	adjust   *menuAdjust
+	timer    *time.Timer
+	deadline time.Time
+	// building items and running actions happen without the lock, the
+	// result is dropped when the menu closed in the meantime
+	working bool
+	gen     int
+}
+
+var menu menuState
+
+// MenuInput handles one of the menu button actions, any of them but back
+// opens the menu while the status page is shown
+func MenuInput(action string) {
+	menu.lock.Lock()
+	defer menu.lock.Unlock()
+	switch {
+	case len(menu.frames) == 0:
+		if action == config.ButtonActionMenuBack {
+			return
+		}
+		hideNotice()
+		statusRunner.StatusShowEnable(false)
+		menu.push(&menuFrame{title: "Menu", build: rootMenu})
+	case menu.working:
+		return
+	case menu.message != nil:
+		menu.dismiss()
+	case menu.adjust != nil:
+		menu.adjustInput(action)
+	default:
+		menu.input(action)
+	}
+	if len(menu.frames) == 0 {
+		menu.exit()
+		return
+	}
+	menu.touch()
+	menu.render()
+}
+
+// MenuTurn moves the cursor or adjusts a value by steps turned on an
+// encoder, while the menu is closed it pages the status display instead
+func MenuTurn(steps int) {
+	menu.lock.Lock()
+	defer menu.lock.Unlock()
+	switch {
+	case len(menu.frames) == 0:
+		hideNotice()
+		statusRunner.TurnPage(steps)
+		return
+	case menu.working:
+		return
+	case menu.message != nil:
+		menu.dismiss()
+	case menu.adjust != nil:
+		if err := menu.adjust.change(steps); err != nil {
+			menu.adjustFailed(err)
+		}
+	default:
+		menu.move(steps)
+	}
+	menu.touch()
+	menu.render()
+}
+
+func (m *menuState) top() *menuFrame {
+	return m.frames[len(m.frames)-1]
+}
+
+func (m *menuState) push(frame *menuFrame) {
+	m.frames = append(m.frames, frame)
+	m.refresh(frame)
+}
+
+// refresh rebuilds the items of frame, submenus such as the wifi networks
+// ask nmcli
+func (m *menuState) refresh(frame *menuFrame) {
+	m.work(func() func() {
+		items := frame.build()
+		return func() {
+			frame.setItems(items)
+		}
+	})
+}
+
+// work runs fn without the lock and the function it returns under the lock,
+// "Working..." is shown when it takes a while. Input is ignored meanwhile.
+func (m *menuState) work(fn func() func()) {
+	m.working = true
+	m.gen++
+	gen := m.gen
+	time.AfterFunc(menuWorkingDelay, func() {
+		menu.lock.Lock()
+		defer menu.lock.Unlock()
+		if gen == menu.gen && menu.working {
+			DisplayAllAlign("Working...")
+		}
+	})
+	go func() {
+		done := fn()
+		menu.lock.Lock()
+		defer menu.lock.Unlock()
+		if gen != menu.gen || !menu.working {
+			return
+		}
+		menu.working = false
+		done()
+		menu.touch()
+		menu.render()
+	}()
+}
+
+// dismiss drops the result lines shown, a confirmation goes with them
+func (m *menuState) dismiss() {
+	m.message = nil
+	if m.top().confirm {
+		m.frames = m.frames[:len(m.frames)-1]
+	}
+	m.refresh(m.top())
+}
+
+// move walks the cursor by steps, wrapping around at either end
+func (m *menuState) move(steps int) {
+	frame := m.top()
+	if len(frame.items) == 0 {
+		return
+	}
+	frame.cursor = ((frame.cursor+steps)%len(frame.items) + len(frame.items)) % len(frame.items)
+}
+
+func (m *menuState) input(action string) {
+	frame := m.top()
+	switch action {
+	case config.ButtonActionMenuUp:
+		m.move(-1)
+	case config.ButtonActionMenuDown:
+		m.move(1)
+	case config.ButtonActionMenuBack:
+		m.frames = m.frames[:len(m.frames)-1]
+	case config.ButtonActionMenuSelect:
+		if len(frame.items) == 0 {
+			return
+		}
+		m.selectItem(frame.items[frame.cursor])
+	}
+}
+
+func (m *menuState) selectItem(item menuItem) {
+	switch {
+	case item.confirm:
+		action := item.action
+		m.push(&menuFrame{title: item.label + "?", confirm: true, build: func() []menuItem {
+			return []menuItem{
+				{label: "No", action: func() ([]string, error) { return nil, nil }},
+				{label: "Yes", action: action},
+			}
+		}})
+	case item.items != nil:
+		m.push(&menuFrame{title: item.label, build: item.items})
+	case item.adjust != nil:
+		adjust, err := item.adjust()
+		if err != nil {
+			m.message = strings.Split(err.Error(), "\n")
+			return
+		}
+		m.adjust = adjust
+	case item.action != nil:
+		action := item.action
+		m.work(func() func() {
+			lines, err := action()
+			return func() {
+				menu.showResult(lines, err)
+			}
+		})
+	}
+}
+
+// showResult shows the lines an action returned until the next input
+func (m *menuState) showResult(lines []string, err error) {
+	if err != nil {
+		lines = strings.Split(err.Error(), "\n")
+	}
+	if len(lines) == 0 && m.top().confirm {
+		// "No" goes straight back
+		m.frames = m.frames[:len(m.frames)-1]
+		return
+	}
+	if len(lines) == 0 {
+		lines = []string{"Done"}
+	}
+	m.message = lines
+}
+
+// adjustInput turns up and down into single steps, the value grows upwards
+func (m *menuState) adjustInput(action string) {
+	var err error
+	switch action {
+	case config.ButtonActionMenuUp:
+		err = m.adjust.change(1)
+	case config.ButtonActionMenuDown:
+		err = m.adjust.change(-1)
+	case config.ButtonActionMenuSelect:
+		if m.adjust.keep != nil {
+			err = m.adjust.keep(m.adjust.value)
+		}
+		m.adjust = nil
+		m.refresh(m.top())
+	case config.ButtonActionMenuBack:
+		m.dropAdjust()
+		m.refresh(m.top())
+	}
+	if err != nil {
+		m.adjustFailed(err)
+	}
+}
+
+// adjustFailed restores the value from before and shows err
+func (m *menuState) adjustFailed(err error) {
+	m.dropAdjust()
+	m.message = strings.Split(err.Error(), "\n")
+}
+
+// dropAdjust leaves an adjustment without keeping its value, a preview such
+// as a fan override must not outlive the menu
+func (m *menuState) dropAdjust() {
+	if m.adjust == nil {
+		return
+	}
+	if err := m.adjust.restore(); err != nil {
+		logger.Warn("menu restore value failed", zap.String("title", m.adjust.title), zap.Error(err))
+	}
+	m.adjust = nil
+}
+
+func (m *menuState) render() {
+	if m.working {
+		return
+	}
+	if m.message != nil {
+		DisplayAllAlign(m.message...)
+		return
+	}
+	if m.adjust != nil {
+		DisplayAllAlign(m.adjust.title, fmt.Sprintf("%d%s", m.adjust.value, m.adjust.unit), "select keeps it")
+		return
+	}
+	frame := m.top()
+	lines := []string{frame.title}
+	if len(frame.items) == 0 {
+		lines = append(lines, "  (empty)")
+	}
+	start := max(frame.cursor-menuVisibleItems+1, 0)
+	for i := start; i < len(frame.items) && i < start+menuVisibleItems; i++ {
+		prefix := "  "
+		if i == frame.cursor {
+			prefix = "> "
+		}
+		lines = append(lines, prefix+frame.items[i].label)
+	}
+	if err := Display(menuOpt, lines...); err != nil {
+		logger.Warn("display menu error", zap.Error(err))
+	}
+}
+
+// touch pushes the timeout back after a button press
+func (m *menuState) touch() {
+	timeout := time.Duration(config.GetSH1106Cfg().MenuTimeout) * time.Second
+	m.deadline = time.Now().Add(timeout)
+	if m.timer == nil {
+		m.timer = time.AfterFunc(timeout, menuTimeout)
+	} else {
+		m.timer.Reset(timeout)
+	}
+}
+
+func menuTimeout() {
+	menu.lock.Lock()
+	defer menu.lock.Unlock()
+	// a press may have come in while this was waiting for the lock, an
+	// action touches the menu once it is done
+	if len(menu.frames) == 0 || menu.working || time.Now().Before(menu.deadline) {
+		return
+	}
+	menu.exit()
+}
+
+// close drops the menu without touching the display
+func (m *menuState) close() {
+	m.dropAdjust()
+	m.frames = nil
+	m.message = nil
+	m.working = false
+	m.gen++
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+}
+
+func (m *menuState) exit() {
+	m.close()
+	statusRunner.StatusShowEnable(true)
+}
+
+// closeMenu hands the display over to whoever shows something next
+func closeMenu() {
+	menu.lock.Lock()
+	defer menu.lock.Unlock()
+	menu.close()
+}
+
+func rootMenu() []menuItem {
+	return []menuItem{
+		{label: "Network", action: networkInfo},
+		{label: "WiFi", items: wifiMenu},
+		{label: "Radio", items: radioMenu},
+		{label: "Fans", items: fanMenu},
+		{label: "Display", items: displayMenu},
+		{label: "Power", items: powerMenu},
+		{label: "Version", action: versionInfo},
+	}
+}
+
+func networkInfo() ([]string, error) {
+	devices, err := utils.GetDevices()
+	if err != nil {
+		return []string{"IP " + utils.GetHostIP()}, nil
+	}
+	var lines []string
+	for _, device := range devices {
+		for _, ip := range device.IPV4 {
+			if !ip.IsLoopback() {
+				lines = append(lines, device.Device+" "+ip.String())
+			}
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No network")
+	}
+	return lines, nil
+}
+
+func wifiMenu() []menuItem {
+	connections, err := utils.GetConnections()
+	if err != nil {
+		logger.Warn("menu get connections error", zap.Error(err))
+		return nil
+	}
+	apName := config.GetWifiConfig().Name
+	var items []menuItem
+	for _, connection := range connections {
+		if connection.Type != wifiConnectionType || connection.Name == apName {
+			continue
+		}
+		label := "  " + connection.Name
+		if connection.State == utils.NMActiveConnectionStateActivated {
+			label = "* " + connection.Name
+		}
+		uuid, name := connection.UUID, connection.Name
+		items = append(items, menuItem{label: label, action: func() ([]string, error) {
+			if err := utils.UpConnection(uuid); err != nil {
+				return nil, err
+			}
+			return []string{"Connected", name}, nil
+		}})
+	}
+	return items
+}
+
+func radioMenu() []menuItem {
+	info, err := utils.GetRadioInfo()
+	if err != nil {
+		return nil
+	}
+	items := []menuItem{radioItem("WiFi", true, info.Wifi)}
+	if info.WwanHW {
+		items = append(items, radioItem("WWAN", false, info.Wwan))
+	}
+	return items
+}
+
+func radioItem(name string, isWifi, on bool) menuItem {
+	label := name + " on"
+	if !on {
+		label = name + " off"
+	}
+	return menuItem{label: label, action: func() ([]string, error) {
+		return nil, utils.RadioSwitch(isWifi, !on)
+	}}
+}
+
+func fanMenu() []menuItem {
+	var items []menuItem
+	for _, name := range config.GetFanNames() {
+		speed, err := GetFanSpeed(name)
+		if err != nil {
+			continue
+		}
+		name := name
+		if speed.Override {
+			items = append(items, menuItem{label: fmt.Sprintf("%s %d%% MANUAL", name, speed.Duty), action: func() ([]string, error) {
+				return []string{"Fan " + name, "auto"}, ClearFanOverride(name)
+			}})
+		} else {
+			items = append(items, menuItem{label: fmt.Sprintf("%s %d%% auto", name, speed.Duty), action: func() ([]string, error) {
+				return []string{"Fan " + name, "full speed"}, SetFanOverride(name, maxCycleLen, 0)
+			}})
+		}
+		items = append(items, menuItem{label: "  set " + name + " duty", adjust: func() (*menuAdjust, error) {
+			return fanDutyAdjust(name)
+		}})
+	}
+	return items
+}
+
+func fanDutyAdjust(name string) (*menuAdjust, error) {
+	status, err := GetFanStatus(name)
+	if err != nil {
+		return nil, err
+	}
+	previous := status.OverrideInfo
+	return &menuAdjust{
+		title: "Fan " + name,
+		unit:  "%",
+		value: int(status.Duty),
+		max:   maxCycleLen,
+		step:  5,
+		apply: func(value int) error {
+			return SetFanOverride(name, uint32(value), 0)
+		},
+		restore: func() error {
+			if previous == nil {
+				return ClearFanOverride(name)
+			}
+			var remain time.Duration
+			if !previous.ExpireAt.IsZero() {
+				remain = max(time.Until(previous.ExpireAt), time.Millisecond)
+			}
+			return SetFanOverride(name, previous.Duty, remain)
+		},
+	}, nil
+}
+
+func displayMenu() []menuItem {
+	return []menuItem{{label: "Contrast", adjust: contrastAdjust}}
+}
+
+func contrastAdjust() (*menuAdjust, error) {
+	contrast, err := GetDisplayContrast()
+	if err != nil {
+		return nil, err
+	}
+	previous := config.GetSH1106Cfg().Contrast
+	return &menuAdjust{
+		title: "Contrast",
+		value: contrast,
+		min:   1,
+		max:   255,
+		step:  8,
+		apply: func(value int) error {
+			return SetDisplayContrast(value, false)
+		},
+		keep: func(value int) error {
+			return SetDisplayContrast(value, true)
+		},
+		restore: func() error {
+			return SetDisplayContrast(previous, false)
+		},
+	}, nil
+}
+
+func powerMenu() []menuItem {
+	return []menuItem{
+		{label: "Reboot", confirm: true, action: func() ([]string, error) {
+			return []string{"Rebooting..."}, RequestPower(PowerReboot)
+		}},
+		{label: "Shutdown", confirm: true, action: func() ([]string, error) {
+			return []string{"Shutting down..."}, RequestPower(PowerShutdown)
+		}},
+	}
+}
+
+func versionInfo() ([]string, error) {
+	hostname, _ := os.Hostname()
+	return []string{"picp " + Version, hostname}, nil
+}
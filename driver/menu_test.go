@@ -0,0 +1,135 @@
+package driver
+
+import (
+	"errors"
+	"picp/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMenuDropsAdjust(t *testing.T) {
+	tests := []struct {
+		name  string
+		leave func()
+	}{
+		{name: "timeout", leave: func() {
+			menu.deadline = time.Now().Add(-time.Second)
+			menuTimeout()
+		}},
+		{name: "closed", leave: closeMenu},
+		{name: "failed", leave: func() {
+			menu.lock.Lock()
+			defer menu.lock.Unlock()
+			menu.adjustFailed(errors.New("apply failed"))
+			menu.close()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restored := 0
+			menu.lock.Lock()
+			menu.frames = []*menuFrame{{title: "Fans", build: func() []menuItem { return nil }}}
+			menu.adjust = &menuAdjust{
+				value: 0,
+				max:   100,
+				step:  5,
+				apply: func(value int) error { return nil },
+				restore: func() error {
+					restored++
+					return nil
+				},
+			}
+			_ = menu.adjust.change(-1)
+			menu.lock.Unlock()
+			tt.leave()
+			menu.lock.Lock()
+			defer menu.lock.Unlock()
+			if restored != 1 {
+				t.Errorf("restore called %d times, want 1", restored)
+			}
+			if menu.adjust != nil || menu.frames != nil {
+				t.Errorf("menu still open: adjust %v, frames %d", menu.adjust, len(menu.frames))
+			}
+		})
+	}
+}
+
+// menuShown sums up what the menu shows, the caller holds menu.lock
+func menuShown() string {
+	if menu.message != nil {
+		return strings.Join(menu.message, "|")
+	}
+	if len(menu.frames) == 0 {
+		return ""
+	}
+	shown := menu.top().title
+	for _, item := range menu.top().items {
+		shown += "|" + item.label
+	}
+	return shown
+}
+
+func TestMenuWorkUnlocked(t *testing.T) {
+	tests := []struct {
+		name    string
+		submenu bool
+		closed  bool
+		want    string
+	}{
+		{name: "action result", want: "Connected"},
+		{name: "action closed meanwhile", closed: true},
+		{name: "submenu items", submenu: true, want: "WiFi|home"},
+		{name: "submenu closed meanwhile", submenu: true, closed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan struct{})
+			item := menuItem{label: "WiFi", action: func() ([]string, error) {
+				<-release
+				return []string{"Connected"}, nil
+			}}
+			if tt.submenu {
+				item = menuItem{label: "WiFi", items: func() []menuItem {
+					<-release
+					return []menuItem{{label: "home"}}
+				}}
+			}
+			menu.lock.Lock()
+			menu.frames = []*menuFrame{{title: "Menu", build: func() []menuItem { return nil }}}
+			menu.top().setItems([]menuItem{item})
+			menu.lock.Unlock()
+			defer closeMenu()
+			// returns while the action or the builder is still blocked
+			MenuInput(config.ButtonActionMenuSelect)
+			MenuInput(config.ButtonActionMenuDown)
+			menu.lock.Lock()
+			working := menu.working
+			menu.lock.Unlock()
+			if !working {
+				t.Fatal("menu not working while blocked")
+			}
+			if tt.closed {
+				closeMenu()
+			}
+			close(release)
+			deadline := time.Now().Add(time.Second)
+			for {
+				menu.lock.Lock()
+				shown, working := menuShown(), menu.working
+				menu.lock.Unlock()
+				if !working && (shown == tt.want || tt.closed) || time.Now().After(deadline) {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			// a dropped result would show up by now
+			time.Sleep(20 * time.Millisecond)
+			menu.lock.Lock()
+			defer menu.lock.Unlock()
+			if got := menuShown(); got != tt.want {
+				t.Errorf("menu shows %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package driver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"picp/config"
+	"picp/logger"
+	"picp/utils"
+	"sync"
+	"time"
+)
+
+const (
+	PowerReboot   = "reboot"
+	PowerShutdown = "shutdown"
+)
+
+const (
+	powerCountdown = 5
+	// how long a confirmation token of the api stays valid
+	powerTokenTTL = 30 * time.Second
+	// runners get this long to stop before the system goes down anyway
+	powerStopTimeout = 20 * time.Second
+)
+
+var ErrorPowerPending = errors.New("reboot or shutdown already in progress")
+
+type PowerToken struct {
+	Action   string    `json:"action"`
+	Token    string    `json:"token"`
+	ExpireAt time.Time `json:"expire_at"`
+}
+
+var powerPending atomic.Bool
+var powerToken *PowerToken
+var powerTokenLock sync.Mutex
+
+func checkPowerAction(action string) error {
+	if action != PowerReboot && action != PowerShutdown {
+		return fmt.Errorf("unknown power action %q", action)
+	}
+	return nil
+}
+
+// NewPowerToken returns the token ConfirmPower wants for action, a new token
+// replaces the previous one
+func NewPowerToken(action string) (*PowerToken, error) {
+	if err := checkPowerAction(action); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	token := &PowerToken{Action: action, Token: hex.EncodeToString(buf), ExpireAt: time.Now().Add(powerTokenTTL)}
+	powerTokenLock.Lock()
+	defer powerTokenLock.Unlock()
+	powerToken = token
+	return token, nil
+}
+
+// ConfirmPower runs action when token came from NewPowerToken for the same
+// action and has not expired, a token can only be used once
+func ConfirmPower(action, token string) error {
+	powerTokenLock.Lock()
+	current := powerToken
+	powerToken = nil
+	powerTokenLock.Unlock()
+	if current == nil || current.Token != token || current.Action != action || time.Now().After(current.ExpireAt) {
+		return errors.New("invalid or expired confirmation token")
+	}
+	return RequestPower(action)
+}
+
+// RequestPower counts down on the display, stops the runners, flushes the
+// config and hands over to systemd. It returns once the countdown started.
+func RequestPower(action string) error {
+	if err := checkPowerAction(action); err != nil {
+		return err
+	}
+	if !powerPending.CompareAndSwap(false, true) {
+		return ErrorPowerPending
+	}
+	logger.Warn("power action requested", zap.String("action", action))
+	// callers may be runners that are about to be stopped
+	go runPower(action)
+	return nil
+}
+
+func runPower(action string) {
+	title := "Rebooting"
+	if action == PowerShutdown {
+		title = "Shutting down"
+	}
+	closeMenu()
+	hideNotice()
+	statusRunner.StatusShowEnable(false)
+	for i := powerCountdown; i > 0; i-- {
+		DisplayAllAlign(title, fmt.Sprintf("in %ds", i))
+		time.Sleep(time.Second)
+	}
+	runners := stopRunners()
+	DisplayAllAlign(title + "...")
+	err := config.Flush()
+	if err != nil {
+		logger.Error("flush config failed", zap.Error(err))
+	}
+	if action == PowerShutdown {
+		err = utils.PowerOff()
+	} else {
+		err = utils.Reboot()
+	}
+	if err == nil {
+		return
+	}
+	logger.Error("power action failed", zap.String("action", action), zap.Error(err))
+	for _, runner := range runners {
+		runner.Start()
+	}
+	powerPending.Store(false)
+	showNotice(10*time.Second, func() {
+		DisplayAllAlign(title+" failed", err.Error())
+	})
+}
+
+// stopRunners stops everything but the display and returns what was running
+func stopRunners() []*utils.Runner {
+	closeMenu()
+	hideNotice()
+	runners := []*utils.Runner{userGpioRunner, stripRunner, buzzerRunner, ledRunner, protectRunner, upsRunner, buttonRunner, wifiRunner, statusRunner.Runner, fanProfileRunner}
+	fanChannelsLock.RLock()
+	for _, c := range fanChannels {
+		runners = append(runners, c.Runner)
+	}
+	fanChannelsLock.RUnlock()
+	runners = append(runners, rtcRunner)
+	ctx, cancel := context.WithTimeout(context.Background(), powerStopTimeout)
+	defer cancel()
+	var stopped []*utils.Runner
+	for _, runner := range runners {
+		if runner == nil || !runner.IsRunning() {
+			continue
+		}
+		if err := runner.Stop(ctx); err != nil {
+			logger.Warn("stop runner failed", zap.Error(err))
+		}
+		stopped = append(stopped, runner)
+	}
+	return stopped
+}
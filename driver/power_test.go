@@ -0,0 +1,56 @@
+package driver
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConfirmPower(t *testing.T) {
+	// a pending action keeps an accepted token from running anything
+	powerPending.Store(true)
+	defer powerPending.Store(false)
+	tests := []struct {
+		name    string
+		action  string
+		token   func(token *PowerToken) string
+		expired bool
+		want    error
+	}{
+		{name: "accepted", action: PowerReboot, token: func(token *PowerToken) string { return token.Token }, want: ErrorPowerPending},
+		{name: "wrong token", action: PowerReboot, token: func(token *PowerToken) string { return flipFirst(token.Token) }},
+		{name: "other action", action: PowerShutdown, token: func(token *PowerToken) string { return token.Token }},
+		{name: "expired", action: PowerReboot, token: func(token *PowerToken) string { return token.Token }, expired: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := NewPowerToken(PowerReboot)
+			if err != nil {
+				t.Fatal("new token", err)
+			}
+			if tt.expired {
+				token.ExpireAt = time.Now().Add(-time.Second)
+			}
+			value := tt.token(token)
+			err = ConfirmPower(tt.action, value)
+			if tt.want != nil && !errors.Is(err, tt.want) || tt.want == nil && (err == nil || errors.Is(err, ErrorPowerPending)) {
+				t.Errorf("ConfirmPower() error = %v, want %v", err, tt.want)
+			}
+			// tokens are single use
+			if err = ConfirmPower(PowerReboot, token.Token); err == nil || errors.Is(err, ErrorPowerPending) {
+				t.Errorf("reused token error = %v", err)
+			}
+		})
+	}
+	if _, err := NewPowerToken("halt"); err == nil {
+		t.Error("NewPowerToken(halt) accepted")
+	}
+}
+
+// flipFirst changes the first hex digit so the token never matches
+func flipFirst(token string) string {
+	if token[0] == '0' {
+		return "1" + token[1:]
+	}
+	return "0" + token[1:]
+}
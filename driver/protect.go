@@ -0,0 +1,343 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"os"
+	"picp/config"
+	"picp/logger"
+	"picp/utils"
+	"sync"
+	"time"
+)
+
+type ProtectLevel int
+
+const (
+	ProtectLevelNormal ProtectLevel = iota
+	ProtectLevelWarning
+	ProtectLevelCritical
+)
+
+var protectLevelString = []string{"normal", "warning", "critical"}
+
+func (l ProtectLevel) String() string {
+	if int(l) >= len(protectLevelString) {
+		return fmt.Sprintf("unknown(%d)", l)
+	}
+	return protectLevelString[l]
+}
+
+func (l ProtectLevel) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
+
+const (
+	// event action of a level change, the others are the config actions
+	protectActionLevel = "level"
+	protectHistorySize = 100
+	protectWebhookTime = 10 * time.Second
+)
+
+type ProtectEvent struct {
+	Time        time.Time    `json:"time"`
+	Level       ProtectLevel `json:"level"`
+	Action      string       `json:"action"`
+	Detail      string       `json:"detail,omitempty"`
+	Temperature float32      `json:"temperature"`
+	Error       string       `json:"error,omitempty"`
+}
+
+type ProtectStatus struct {
+	Enable      bool           `json:"enable"`
+	Level       ProtectLevel   `json:"level"`
+	Since       time.Time      `json:"since"`
+	Temperature *float32       `json:"temperature"`
+	Events      []ProtectEvent `json:"events"`
+}
+
+var protectRunner *utils.Runner
+var protectLock sync.Mutex
+var protectLevel ProtectLevel
+var protectSince time.Time
+var protectTemperature = float32(math.NaN())
+var protectEvents []ProtectEvent
+
+func protectInit(ctx context.Context) {
+	protectRunner = utils.NewRunner(ctx, runProtect)
+	protectRunner.Start()
+}
+
+// protectState turns temperature samples into a level, a level is entered
+// once its threshold was exceeded for the hold time and left once the
+// temperature drops hysteresis degrees below the threshold
+type protectState struct {
+	level         ProtectLevel
+	warnSince     time.Time
+	criticalSince time.Time
+}
+
+func protectAbove(since time.Time, above bool, now time.Time) time.Time {
+	if !above {
+		return time.Time{}
+	}
+	if since.IsZero() {
+		return now
+	}
+	return since
+}
+
+func (s *protectState) update(cfg *config.Protect, temperature float32, now time.Time) ProtectLevel {
+	s.warnSince = protectAbove(s.warnSince, temperature >= cfg.WarnTemp, now)
+	s.criticalSince = protectAbove(s.criticalSince, temperature >= cfg.CriticalTemp, now)
+	warnHold := time.Second * time.Duration(cfg.WarnHold)
+	criticalHold := time.Second * time.Duration(cfg.CriticalHold)
+	switch {
+	case !s.criticalSince.IsZero() && now.Sub(s.criticalSince) >= criticalHold:
+		s.level = ProtectLevelCritical
+	case s.level == ProtectLevelCritical && temperature > cfg.CriticalTemp-cfg.Hysteresis:
+	case !s.warnSince.IsZero() && now.Sub(s.warnSince) >= warnHold:
+		s.level = ProtectLevelWarning
+	case s.level >= ProtectLevelWarning && temperature > cfg.WarnTemp-cfg.Hysteresis:
+		s.level = ProtectLevelWarning
+	default:
+		s.level = ProtectLevelNormal
+	}
+	return s.level
+}
+
+// protectActions tracks what has been applied so it can be undone when the
+// level drops
+type protectActions struct {
+	cfg      *config.Protect
+	display  bool
+	cpufreq  map[string]int
+	stopped  []string
+	shutdown bool
+}
+
+func (a *protectActions) apply(previous, level ProtectLevel, temperature float32) {
+	critical := level == ProtectLevelCritical
+	active := level > ProtectLevelNormal
+	if active && a.cfg.HasAction(critical, config.ProtectActionCpufreq) {
+		if a.cpufreq == nil {
+			limits, err := utils.CapCpuFreq(a.cfg.CpufreqMax)
+			a.cpufreq = limits
+			if a.cpufreq == nil {
+				a.cpufreq = map[string]int{}
+			}
+			recordProtectEvent(level, config.ProtectActionCpufreq, fmt.Sprintf("cap %dkHz", a.cfg.CpufreqMax), temperature, err)
+		}
+	} else if a.cpufreq != nil {
+		a.restoreCpufreq(level, temperature)
+	}
+	if active && a.cfg.HasAction(critical, config.ProtectActionStopUnits) {
+		if a.stopped == nil {
+			a.stopped = []string{}
+			for _, unit := range a.cfg.Units {
+				err := utils.SystemctlStop(unit)
+				if err == nil {
+					a.stopped = append(a.stopped, unit)
+				}
+				recordProtectEvent(level, config.ProtectActionStopUnits, "stop "+unit, temperature, err)
+			}
+		}
+	} else if a.stopped != nil {
+		a.startUnits(level, temperature)
+	}
+	if active && a.cfg.HasAction(critical, config.ProtectActionDisplay) {
+		if !a.display {
+			a.display = true
+			statusRunner.StatusShowEnable(false)
+			recordProtectEvent(level, config.ProtectActionDisplay, "show alert", temperature, nil)
+		}
+		// a pending reboot or shutdown shows its countdown instead
+		if !powerPending.Load() {
+			DisplayAllAlign("Overheat "+level.String(), fmt.Sprintf("%.1f℃", temperature))
+		}
+	} else if a.display {
+		a.hideDisplay(level, temperature)
+	}
+	if critical && a.cfg.HasAction(critical, config.ProtectActionShutdown) && !a.shutdown {
+		a.shutdown = true
+		DisplayAllAlign("Overheat", "Shutting down...")
+		err := RequestPower(PowerShutdown)
+		recordProtectEvent(level, config.ProtectActionShutdown, "", temperature, err)
+	}
+	// the webhook is told about entering and leaving a level it is set on,
+	// in the background so a slow endpoint never delays the local actions
+	hadWebhook := previous > ProtectLevelNormal && a.cfg.HasAction(previous == ProtectLevelCritical, config.ProtectActionWebhook)
+	hasWebhook := active && a.cfg.HasAction(critical, config.ProtectActionWebhook)
+	if previous != level && (hadWebhook || hasWebhook) {
+		go func() {
+			err := a.webhook(previous, level, temperature)
+			recordProtectEvent(level, config.ProtectActionWebhook, a.cfg.Webhook, temperature, err)
+		}()
+	}
+}
+
+// revert undoes the reversible actions when the runner stops
+func (a *protectActions) revert(temperature float32) {
+	if a.cpufreq != nil {
+		a.restoreCpufreq(ProtectLevelNormal, temperature)
+	}
+	if a.stopped != nil {
+		a.startUnits(ProtectLevelNormal, temperature)
+	}
+	if a.display {
+		a.hideDisplay(ProtectLevelNormal, temperature)
+	}
+}
+
+func (a *protectActions) restoreCpufreq(level ProtectLevel, temperature float32) {
+	err := utils.RestoreCpuFreq(a.cpufreq)
+	a.cpufreq = nil
+	recordProtectEvent(level, config.ProtectActionCpufreq, "restore", temperature, err)
+}
+
+func (a *protectActions) startUnits(level ProtectLevel, temperature float32) {
+	for _, unit := range a.stopped {
+		err := utils.SystemctlStart(unit)
+		recordProtectEvent(level, config.ProtectActionStopUnits, "start "+unit, temperature, err)
+	}
+	a.stopped = nil
+}
+
+func (a *protectActions) hideDisplay(level ProtectLevel, temperature float32) {
+	a.display = false
+	if !powerPending.Load() {
+		statusRunner.StatusShowEnable(true)
+	}
+	recordProtectEvent(level, config.ProtectActionDisplay, "hide alert", temperature, nil)
+}
+
+func (a *protectActions) webhook(previous, level ProtectLevel, temperature float32) error {
+	if a.cfg.Webhook == "" {
+		return fmt.Errorf("webhook url is empty")
+	}
+	hostname, _ := os.Hostname()
+	body, err := json.Marshal(map[string]interface{}{
+		"host":        hostname,
+		"level":       level,
+		"previous":    previous,
+		"temperature": temperature,
+		"source":      a.cfg.Source,
+		"time":        time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: protectWebhookTime}
+	resp, err := client.Post(a.cfg.Webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook replied %s", resp.Status)
+	}
+	return nil
+}
+
+func recordProtectEvent(level ProtectLevel, action, detail string, temperature float32, err error) {
+	event := ProtectEvent{
+		Time:        time.Now(),
+		Level:       level,
+		Action:      action,
+		Detail:      detail,
+		Temperature: temperature,
+	}
+	if err != nil {
+		event.Error = err.Error()
+		logger.Error("thermal protect action failed", zap.Any("event", event))
+	} else {
+		logger.Warn("thermal protect action", zap.Any("event", event))
+	}
+	protectLock.Lock()
+	defer protectLock.Unlock()
+	protectEvents = append(protectEvents, event)
+	if len(protectEvents) > protectHistorySize {
+		protectEvents = protectEvents[len(protectEvents)-protectHistorySize:]
+	}
+}
+
+func setProtectLevel(level ProtectLevel, temperature float32) {
+	protectLock.Lock()
+	defer protectLock.Unlock()
+	if level != protectLevel {
+		protectLevel = level
+		protectSince = time.Now()
+	}
+	protectTemperature = temperature
+}
+
+func runProtect(ctx context.Context) {
+	cfg := config.GetProtectCfg()
+	if !cfg.Enable {
+		return
+	}
+	ticker := time.NewTicker(time.Second * time.Duration(cfg.Interval))
+	var state protectState
+	var temperature float32
+	actions := protectActions{cfg: &cfg}
+	defer func() {
+		ticker.Stop()
+		actions.revert(temperature)
+		setProtectLevel(ProtectLevelNormal, float32(math.NaN()))
+	}()
+	for {
+		current, err := readTemperature(cfg.Source)
+		if err != nil {
+			logger.Warn("thermal protect temperature error", zap.String("source", cfg.Source), zap.Error(err))
+		} else {
+			temperature = current
+			previous := state.level
+			level := state.update(&cfg, temperature, time.Now())
+			if level != previous {
+				recordProtectEvent(level, protectActionLevel, previous.String()+" -> "+level.String(), temperature, nil)
+			}
+			setProtectLevel(level, temperature)
+			actions.apply(previous, level, temperature)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func GetProtectStatus() *ProtectStatus {
+	protectLock.Lock()
+	defer protectLock.Unlock()
+	status := &ProtectStatus{
+		Enable: config.GetProtectCfg().Enable,
+		Level:  protectLevel,
+		Since:  protectSince,
+		Events: append([]ProtectEvent(nil), protectEvents...),
+	}
+	if !math.IsNaN(float64(protectTemperature)) {
+		temperature := protectTemperature
+		status.Temperature = &temperature
+	}
+	return status
+}
+
+func SetProtectConfig(cfg *config.Protect) error {
+	err := config.SetProtectCfg(cfg)
+	if err != nil {
+		return err
+	}
+	_ = protectRunner.Stop(context.Background())
+	protectRunner.Start()
+	return nil
+}
+
+func closeProtect() {
+	_ = protectRunner.Stop(context.Background())
+}
@@ -0,0 +1,44 @@
+package driver
+
+import (
+	"picp/config"
+	"testing"
+	"time"
+)
+
+func TestProtectState(t *testing.T) {
+	cfg := config.Protect{
+		WarnTemp:     70,
+		WarnHold:     10,
+		CriticalTemp: 80,
+		CriticalHold: 5,
+		Hysteresis:   3,
+	}
+	start := time.Now()
+	tests := []struct {
+		name        string
+		offset      int
+		temperature float32
+		want        ProtectLevel
+	}{
+		{name: "cool", offset: 0, temperature: 60, want: ProtectLevelNormal},
+		{name: "warm not held", offset: 1, temperature: 72, want: ProtectLevelNormal},
+		{name: "warm held", offset: 11, temperature: 72, want: ProtectLevelWarning},
+		{name: "inside hysteresis", offset: 12, temperature: 68, want: ProtectLevelWarning},
+		{name: "hot not held", offset: 13, temperature: 85, want: ProtectLevelWarning},
+		{name: "hot held", offset: 18, temperature: 85, want: ProtectLevelCritical},
+		{name: "critical hysteresis", offset: 19, temperature: 78, want: ProtectLevelCritical},
+		{name: "back to warning", offset: 20, temperature: 76, want: ProtectLevelWarning},
+		{name: "cooled down", offset: 21, temperature: 66, want: ProtectLevelNormal},
+		{name: "warm again not held", offset: 22, temperature: 71, want: ProtectLevelNormal},
+	}
+	var state protectState
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := start.Add(time.Duration(tt.offset) * time.Second)
+			if got := state.update(&cfg, tt.temperature, now); got != tt.want {
+				t.Errorf("update() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
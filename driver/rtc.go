@@ -0,0 +1,164 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"picp/config"
+	"picp/logger"
+	"picp/rtc"
+	"picp/utils"
+	"sync"
+	"time"
+)
+
+var rtcRunner *utils.Runner
+var rtcClock rtc.Clock
+var rtcLock sync.Mutex
+var rtcLastSync atomic.Time
+
+var ErrorRtcDisabled = errors.New("rtc is disabled")
+
+type RtcStatus struct {
+	RtcTime         time.Time `json:"rtc_time"`
+	SystemTime      time.Time `json:"system_time"`
+	Drift           float64   `json:"drift"`
+	Temperature     *float32  `json:"temperature,omitempty"`
+	NtpSynchronized bool      `json:"ntp_synchronized"`
+	LastSync        time.Time `json:"last_sync"`
+}
+
+func rtcInit(ctx context.Context) {
+	rtcRunner = utils.NewRunner(ctx, runRtc)
+	rtcRunner.Start()
+}
+
+func createClock(cfg *config.RTC) (rtc.Clock, error) {
+	bus, err := cfg.Create()
+	if err != nil {
+		return nil, err
+	}
+	var clock rtc.Clock
+	switch cfg.Chip {
+	case "ds3231":
+		clock, err = rtc.NewDS3231(bus)
+	case "pcf8563":
+		clock, err = rtc.NewPCF8563(bus)
+	default:
+		err = fmt.Errorf("unsupported rtc chip %s", cfg.Chip)
+	}
+	if err != nil {
+		_ = bus.Close()
+		return nil, err
+	}
+	return clock, nil
+}
+
+func runRtc(ctx context.Context) {
+	cfg := config.GetRtcCfg()
+	if !cfg.Enable {
+		return
+	}
+	clock, err := createClock(&cfg)
+	if err != nil {
+		logger.Error("create rtc failed", zap.Error(err))
+		return
+	}
+	rtcLock.Lock()
+	rtcClock = clock
+	rtcLock.Unlock()
+	defer func() {
+		rtcLock.Lock()
+		defer rtcLock.Unlock()
+		_ = rtcClock.Close()
+		rtcClock = nil
+	}()
+	synced, err := utils.IsNtpSynchronized()
+	if err != nil {
+		logger.Warn("check ntp synchronized failed", zap.Error(err))
+	}
+	if !synced {
+		restoreSystemTime()
+	}
+	ticker := time.NewTicker(time.Second * time.Duration(cfg.SyncInterval))
+	defer ticker.Stop()
+	lastSynced := false
+	for {
+		if synced && !lastSynced {
+			saveSystemTime()
+		}
+		lastSynced = synced
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		synced, err = utils.IsNtpSynchronized()
+		if err != nil {
+			logger.Warn("check ntp synchronized failed", zap.Error(err))
+		}
+	}
+}
+
+func restoreSystemTime() {
+	rtcLock.Lock()
+	defer rtcLock.Unlock()
+	t, err := rtcClock.ReadTime()
+	if err != nil {
+		logger.Warn("read rtc time failed", zap.Error(err))
+		return
+	}
+	err = utils.SetSystemTime(t)
+	if err != nil {
+		logger.Error("set system time from rtc failed", zap.Error(err))
+		return
+	}
+	logger.Info("system time restored from rtc", zap.Time("time", t))
+}
+
+func saveSystemTime() {
+	rtcLock.Lock()
+	defer rtcLock.Unlock()
+	now := time.Now()
+	err := rtcClock.SetTime(now)
+	if err != nil {
+		logger.Error("write system time to rtc failed", zap.Error(err))
+		return
+	}
+	rtcLastSync.Store(now)
+	logger.Info("system time saved to rtc", zap.Time("time", now))
+}
+
+func GetRtcStatus() (*RtcStatus, error) {
+	rtcLock.Lock()
+	defer rtcLock.Unlock()
+	if rtcClock == nil {
+		return nil, ErrorRtcDisabled
+	}
+	rtcTime, err := rtcClock.ReadTime()
+	if err != nil {
+		return nil, err
+	}
+	status := &RtcStatus{
+		RtcTime:    rtcTime,
+		SystemTime: time.Now(),
+		LastSync:   rtcLastSync.Load(),
+	}
+	status.Drift = status.RtcTime.Sub(status.SystemTime).Seconds()
+	status.NtpSynchronized, _ = utils.IsNtpSynchronized()
+	if thermometer, ok := rtcClock.(rtc.Thermometer); ok {
+		temperature, err := thermometer.Temperature()
+		if err != nil {
+			logger.Warn("read rtc temperature failed", zap.Error(err))
+		} else {
+			status.Temperature = &temperature
+		}
+	}
+	return status, nil
+}
+
+func closeRtc() {
+	_ = rtcRunner.Stop(context.Background())
+}
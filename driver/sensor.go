@@ -0,0 +1,92 @@
+package driver
+
+import (
+	"fmt"
+	"picp/config"
+	"picp/thermal"
+	"picp/w1"
+)
+
+const (
+	w1Kind         = "w1"
+	w1SourcePrefix = w1Kind + ":"
+)
+
+type SensorReading struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Type        string  `json:"type"`
+	Temperature float32 `json:"temperature"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// w1Source resolves the probe name on every read so renaming a probe does
+// not need the fan to restart
+type w1Source struct {
+	name string
+}
+
+func (s *w1Source) Temperature() (float32, error) {
+	cfg := config.GetW1Cfg()
+	if !cfg.Enable {
+		return 0, fmt.Errorf("w1 is disabled, can not read %s", s)
+	}
+	return w1.NewBus(cfg.Root).ReadTemperature(cfg.IdOf(s.name))
+}
+
+func (s *w1Source) String() string {
+	return w1SourcePrefix + s.name
+}
+
+func resolveSource(kind, arg string) (thermal.Source, error) {
+	if kind == w1Kind {
+		return &w1Source{name: arg}, nil
+	}
+	return nil, fmt.Errorf("unknown temperature source %s:%s", kind, arg)
+}
+
+func readTemperature(source string) (float32, error) {
+	s, err := thermal.Parse(source, resolveSource)
+	if err != nil {
+		return 0, err
+	}
+	return s.Temperature()
+}
+
+func GetSensors() ([]SensorReading, error) {
+	var ret []SensorReading
+	for _, info := range thermal.List() {
+		reading := SensorReading{ID: info.Spec, Name: info.Name, Type: info.Type}
+		temperature, err := readTemperature(info.Spec)
+		if err != nil {
+			reading.Error = err.Error()
+		} else {
+			reading.Temperature = temperature
+		}
+		ret = append(ret, reading)
+	}
+	cfg := config.GetW1Cfg()
+	if !cfg.Enable {
+		return ret, nil
+	}
+	bus := w1.NewBus(cfg.Root)
+	ids, err := bus.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		reading := SensorReading{
+			ID:   w1SourcePrefix + id,
+			Name: cfg.NameOf(id),
+			Type: "ds18b20",
+		}
+		temperature, err := bus.ReadTemperature(id)
+		if err != nil {
+			reading.Error = err.Error()
+		} else {
+			reading.Temperature = temperature
+		}
+		ret = append(ret, reading)
+	}
+	return ret, nil
+}
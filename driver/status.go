@@ -10,12 +10,29 @@ import (
 	"picp/config"
 	"picp/logger"
 	"picp/utils"
+	"strings"
 	"sync"
 	"time"
 )
 
 var statusRunner StatusRunner
 
+// vcgencmd is too slow to be run on every refresh
+const throttleCheckInterval = 5 * time.Second
+
+// warning icon shown while the firmware reports under-voltage or throttling
+const throttleIcon = "▲"
+
+// status pages cycled by NextPage and TurnPage
+const (
+	statusPageOverview = iota
+	statusPageSensors
+	statusPageCount
+)
+
+// lines fitting the 64 pixel panel
+const statusMaxLines = 6
+
 type StatusRunner struct {
 	*utils.Runner
 	cpuPercent    atomic.Float64
@@ -27,6 +44,9 @@ type StatusRunner struct {
 	statusLock    sync.Mutex
 	statusEnabled atomic.Bool
 	lastMsg       []string
+	throttleCheck time.Time
+	throttled     bool
+	page          atomic.Int32
 }
 
 func initStatusRunner(ctx context.Context) {
@@ -100,11 +120,36 @@ func (s *StatusRunner) StatusShowEnable(enabled bool) {
 	}
 }
 
+// NextPage switches to the next status page and shows it right away
+func (s *StatusRunner) NextPage() {
+	s.TurnPage(1)
+}
+
+// TurnPage moves steps pages forward, or backward when negative, wrapping
+// around at either end
+func (s *StatusRunner) TurnPage(steps int) {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+	page := (int(s.page.Load()) + steps) % statusPageCount
+	if page < 0 {
+		page += statusPageCount
+	}
+	s.page.Store(int32(page))
+	if s.statusEnabled.Load() {
+		s.DisplayStatus()
+	}
+}
+
 func (s *StatusRunner) DisplayStatus() {
-	cpuTemp, err := utils.GetCpuTemperature()
+	if s.page.Load() == statusPageSensors {
+		s.displaySensors()
+		return
+	}
+	source := config.GetSH1106Cfg().TempSource
+	cpuTemp, err := readTemperature(source)
 	if err != nil {
 		cpuTemp = -1
-		logger.Debug("cpu temperature error", zap.Error(err))
+		logger.Debug("status temperature error", zap.String("source", source), zap.Error(err))
 	}
 	total, used, err := utils.GetRootDiskInfo()
 	var diskPercent float64
@@ -126,11 +171,101 @@ func (s *StatusRunner) DisplayStatus() {
 	} else {
 		logger.Warn("get memory info error", zap.Error(err))
 	}
-	DisplayVerticalAlign("IP "+utils.GetHostIP(),
+	ipLine := "IP " + utils.GetHostIP()
+	if s.isThrottled() {
+		ipLine += " " + throttleIcon
+	}
+	lines := []string{ipLine,
 		fmt.Sprintf("CPU %.1f%% %.2f℃", s.cpuPercent.Load(), cpuTemp),
 		fmt.Sprintf("MEM %s %.1f%%", utils.ByteSize(memUsed, 1024), memPercent),
 		fmt.Sprintf("DISK %s %.1f%%", utils.ByteSize(used, 1024), diskPercent),
-		fmt.Sprintf("↑%s/s ↓%s/s", utils.ByteSize(s.txSpeed.Load(), 100), utils.ByteSize(s.rxSpeed.Load(), 100)))
+		fmt.Sprintf("↑%s/s ↓%s/s", utils.ByteSize(s.txSpeed.Load(), 100), utils.ByteSize(s.rxSpeed.Load(), 100))}
+	if line := fanStatusLine(); line != "" {
+		lines = append(lines, line)
+	}
+	DisplayVerticalAlign(lines...)
+}
+
+func (s *StatusRunner) displaySensors() {
+	sensors, err := GetSensors()
+	if err != nil {
+		logger.Debug("status sensors error", zap.Error(err))
+	}
+	var lines []string
+	for _, sensor := range sensors {
+		if len(lines) == statusMaxLines {
+			break
+		}
+		if sensor.Error != "" {
+			lines = append(lines, sensor.Name+" --")
+		} else {
+			lines = append(lines, fmt.Sprintf("%s %.1f℃", sensor.Name, sensor.Temperature))
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No sensors")
+	}
+	DisplayVerticalAlign(lines...)
+}
+
+// isThrottled must be called with statusLock held
+func (s *StatusRunner) isThrottled() bool {
+	if time.Since(s.throttleCheck) < throttleCheckInterval {
+		return s.throttled
+	}
+	s.throttleCheck = time.Now()
+	status, err := utils.GetThrottled()
+	if err != nil {
+		logger.Debug("get throttled error", zap.Error(err))
+		s.throttled = false
+	} else {
+		current := status.Current.Any()
+		if current && !s.throttled {
+			logger.Warn("raspberry pi is throttled", zap.Any("status", status))
+		}
+		s.throttled = current
+	}
+	return s.throttled
+}
+
+func fanStatusLine() string {
+	var speeds []*FanSpeed
+	for _, name := range config.GetFanNames() {
+		cfg, _ := config.GetFanChannelCfg(name)
+		if !cfg.Enable {
+			continue
+		}
+		speed, err := GetFanSpeed(name)
+		if err != nil {
+			continue
+		}
+		if speed.Stall {
+			return fmt.Sprintf("FAN %s STALL!", name)
+		}
+		speeds = append(speeds, speed)
+	}
+	switch len(speeds) {
+	case 0:
+		return ""
+	case 1:
+		if speeds[0].Override {
+			return fmt.Sprintf("FAN %d%% MANUAL", speeds[0].Duty)
+		}
+		if speeds[0].Rpm >= 0 {
+			return fmt.Sprintf("FAN %d%% %drpm", speeds[0].Duty, speeds[0].Rpm)
+		}
+		return fmt.Sprintf("FAN %d%%", speeds[0].Duty)
+	}
+	// several channels only fit their duty on one line, M marks an override
+	items := make([]string, 0, len(speeds))
+	for _, speed := range speeds {
+		if speed.Override {
+			items = append(items, fmt.Sprintf("M%d%%", speed.Duty))
+		} else {
+			items = append(items, fmt.Sprintf("%d%%", speed.Duty))
+		}
+	}
+	return "FAN " + strings.Join(items, " ")
 }
 
 func closeStatus() {
@@ -0,0 +1,161 @@
+package driver
+
+import (
+	"context"
+	"github.com/shirou/gopsutil/cpu"
+	"go.uber.org/zap"
+	"math"
+	"picp/config"
+	"picp/logger"
+	"picp/utils"
+	"picp/ws2812"
+	"time"
+)
+
+const (
+	stripFrameInterval = 100 * time.Millisecond
+	// cpu, temperature and the led state are sampled as often as the LEDs do
+	stripSampleInterval = ledStateInterval
+	stripFlashPeriod    = 500 * time.Millisecond
+)
+
+var (
+	// green to red along the bar
+	stripCpuStops = []ws2812.Color{{G: 255}, {R: 255, G: 255}, {R: 255}}
+	// blue at temp_low to red at temp_high
+	stripTempStops = []ws2812.Color{{B: 255}, {G: 255}, {R: 255, G: 255}, {R: 255}}
+	stripWifiColor = map[LedState]ws2812.Color{
+		LedStateIdle:           {R: 255},
+		LedStateWifiConnected:  {G: 255},
+		LedStateWifiConnecting: {R: 255, G: 160},
+		LedStateApActive:       {B: 255},
+	}
+	stripAlertColor = map[LedState]ws2812.Color{
+		LedStateOverheat: {R: 255, G: 80},
+		LedStateError:    {R: 255},
+	}
+)
+
+var stripRunner *utils.Runner
+
+// stripSample is what the views show, cpu is negative when unknown
+type stripSample struct {
+	cpu         float64
+	temperature float32
+	tempOk      bool
+	wifi        LedState
+	// idle without an alert, otherwise overheat or error
+	alert LedState
+}
+
+func stripInit(ctx context.Context) {
+	stripRunner = utils.NewRunner(ctx, runStrip)
+	stripRunner.Start()
+}
+
+func runStrip(ctx context.Context) {
+	cfg := config.GetWS2812Cfg()
+	if !cfg.Enable {
+		return
+	}
+	conn, err := cfg.CreateSPI()
+	if err != nil {
+		logger.Error("open ws2812 spi failed", zap.Error(err))
+		return
+	}
+	strip, err := ws2812.NewStrip(conn, cfg.Pixels, cfg.GetOrder(), uint8(cfg.Brightness))
+	if err != nil {
+		_ = conn.Close()
+		logger.Error("create ws2812 strip failed", zap.Error(err))
+		return
+	}
+	defer func() {
+		if err := strip.Close(); err != nil {
+			logger.Debug("close ws2812 failed", zap.Error(err))
+		}
+	}()
+	views := cfg.GetViews()
+	var sample stripSample
+	var sampledAt time.Time
+	ticker := time.NewTicker(stripFrameInterval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		if now.Sub(sampledAt) >= stripSampleInterval {
+			sample = sampleStrip(ctx, &cfg)
+			sampledAt = now
+		}
+		renderStrip(strip, views, &cfg, &sample, now)
+		if err = strip.Show(); err != nil {
+			logger.Warn("ws2812 stopped", zap.Error(err))
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func sampleStrip(ctx context.Context, cfg *config.WS2812) stripSample {
+	sample := stripSample{cpu: -1, wifi: wifiLedState()}
+	// zero interval compares with the previous call
+	if percent, err := cpu.PercentWithContext(ctx, 0, false); err == nil && len(percent) > 0 {
+		sample.cpu = percent[0]
+	}
+	if temperature, err := readTemperature(cfg.TempSource); err == nil {
+		sample.temperature, sample.tempOk = temperature, true
+	}
+	switch {
+	case serviceError():
+		sample.alert = LedStateError
+	case GetProtectStatus().Level >= ProtectLevelWarning:
+		sample.alert = LedStateOverheat
+	}
+	return sample
+}
+
+// renderStrip splits the strip evenly between views, the last one takes
+// the remainder. An alert flashes the whole strip.
+func renderStrip(strip *ws2812.Strip, views []string, cfg *config.WS2812, sample *stripSample, now time.Time) {
+	if cfg.Alerts && sample.alert != LedStateIdle && now.UnixMilli()%stripFlashPeriod.Milliseconds() < stripFlashPeriod.Milliseconds()/2 {
+		strip.Fill(stripAlertColor[sample.alert])
+		return
+	}
+	size := strip.Len() / len(views)
+	for i, view := range views {
+		start, end := i*size, (i+1)*size
+		if i == len(views)-1 {
+			end = strip.Len()
+		}
+		for j := start; j < end; j++ {
+			strip.Set(j, stripViewColor(view, j-start, end-start, cfg, sample))
+		}
+	}
+}
+
+// stripViewColor is the colour of pixel i of a view count pixels long
+func stripViewColor(view string, i, count int, cfg *config.WS2812, sample *stripSample) ws2812.Color {
+	switch view {
+	case config.StripViewCpu:
+		lit := int(math.Round(sample.cpu / 100 * float64(count)))
+		if i >= lit {
+			return ws2812.Color{}
+		}
+		return ws2812.Gradient(stripCpuStops, float64(i)/float64(max(count-1, 1)))
+	case config.StripViewTemperature:
+		if !sample.tempOk {
+			return ws2812.Color{}
+		}
+		t := (sample.temperature - cfg.TempLow) / (cfg.TempHigh - cfg.TempLow)
+		return ws2812.Gradient(stripTempStops, float64(t))
+	case config.StripViewWifi:
+		return stripWifiColor[sample.wifi]
+	}
+	return ws2812.Color{}
+}
+
+func closeStrip() {
+	_ = stripRunner.Stop(context.Background())
+}
@@ -0,0 +1,188 @@
+package driver
+
+import (
+	"context"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"picp/gpio"
+	"picp/logger"
+	"time"
+)
+
+// the rpio backend polls for edges, instead of counting every pulse the
+// tach times the pulses of tachMeasureSpan once per tachMeasureInterval. A 2
+// pulse per revolution fan at 10000 rpm still holds its output low longer
+// than the poll interval.
+const (
+	tachPollInterval    = time.Millisecond
+	tachMeasureSpan     = 100 * time.Millisecond
+	tachMeasureInterval = time.Second
+)
+
+// bounds a single wait for a pulse so a stopped fan still sees ctx
+const tachWaitTimeout = 200 * time.Millisecond
+
+// a tach whose line fails is requested again after this long
+const tachRetryInterval = 5 * time.Second
+
+// fanTach counts falling edges of an open collector tachometer output, or
+// measures their period when edges are polled
+type fanTach struct {
+	pin          int
+	line         gpio.Line
+	pulsesPerRev int
+	pulses       atomic.Uint64
+	lastPulses   uint64
+	lastTime     time.Time
+	polled       bool
+	measured     atomic.Int64
+	// set while the line fails, the stall check is skipped then
+	failed atomic.Bool
+}
+
+func newFanTach(pin int, pulsesPerRev int) (*fanTach, error) {
+	t := &fanTach{
+		pin:          pin,
+		pulsesPerRev: pulsesPerRev,
+		lastTime:     time.Now(),
+		polled:       gpio.Backend() == gpio.BackendRpio,
+	}
+	if err := t.request(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *fanTach) request() error {
+	line, err := gpio.Request(t.pin, gpio.Config{
+		Bias:         gpio.BiasPullUp,
+		Edge:         gpio.EdgeFalling,
+		PollInterval: tachPollInterval,
+	})
+	if err != nil {
+		return err
+	}
+	t.line = line
+	return nil
+}
+
+func (t *fanTach) closeLine() {
+	if t.line != nil {
+		_ = t.line.Close()
+		t.line = nil
+	}
+}
+
+// run reads the tach until ctx is done. A failing line is closed and
+// requested again every tachRetryInterval.
+func (t *fanTach) run(ctx context.Context) {
+	defer t.closeLine()
+	for ctx.Err() == nil {
+		var err error
+		if t.line == nil {
+			err = t.request()
+		}
+		if err == nil {
+			if t.polled {
+				err = t.runMeasure(ctx)
+			} else {
+				err = t.runCount(ctx)
+			}
+		}
+		if err == nil {
+			return
+		}
+		t.closeLine()
+		if !t.failed.Swap(true) {
+			logger.Warn("read fan tachometer failed, retrying", zap.Int("pin", t.pin), zap.Error(err))
+		}
+		select {
+		case <-time.After(tachRetryInterval):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// working clears failed once the line reads again
+func (t *fanTach) working() {
+	if t.failed.Load() && t.failed.Swap(false) {
+		logger.Info("fan tachometer recovered", zap.Int("pin", t.pin))
+	}
+}
+
+func (t *fanTach) runCount(ctx context.Context) error {
+	for ctx.Err() == nil {
+		_, ok, err := t.line.Wait(tachWaitTimeout)
+		if err != nil {
+			return err
+		}
+		t.working()
+		if ok {
+			t.pulses.Inc()
+		}
+	}
+	return nil
+}
+
+func (t *fanTach) runMeasure(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil
+		}
+		rpm, err := t.measure()
+		if err != nil {
+			return err
+		}
+		t.working()
+		t.measured.Store(rpm)
+		timer.Reset(tachMeasureInterval)
+	}
+}
+
+// measure times whole pulses for at least tachMeasureSpan, a fan slower than
+// a pulse per tachWaitTimeout reads as stopped
+func (t *fanTach) measure() (int64, error) {
+	// the first edge may have happened any time since the last poll
+	synced := false
+	var first time.Time
+	var pulses int64
+	for {
+		event, ok, err := t.line.Wait(tachWaitTimeout)
+		if err != nil || !ok {
+			return 0, err
+		}
+		switch {
+		case !synced:
+			synced = true
+		case first.IsZero():
+			first = event.Time
+		default:
+			pulses++
+			if span := event.Time.Sub(first); span >= tachMeasureSpan {
+				return pulses * int64(time.Minute) / int64(span) / int64(t.pulsesPerRev), nil
+			}
+		}
+	}
+}
+
+// rpm returns the speed averaged since the previous call, or the last
+// measured one when edges are polled
+func (t *fanTach) rpm() int64 {
+	if t.polled {
+		return t.measured.Load()
+	}
+	now := time.Now()
+	pulses := t.pulses.Load()
+	seconds := now.Sub(t.lastTime).Seconds()
+	count := pulses - t.lastPulses
+	t.lastPulses = pulses
+	t.lastTime = now
+	if seconds <= 0 {
+		return 0
+	}
+	return int64(float64(count) / float64(t.pulsesPerRev) / seconds * 60)
+}
@@ -0,0 +1,103 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"picp/gpio"
+	"testing"
+	"time"
+)
+
+// scriptedLine replays edges spaced by period, a zero period times out
+type scriptedLine struct {
+	now    time.Time
+	period time.Duration
+	err    error
+}
+
+func (l *scriptedLine) Get() (bool, error) {
+	return false, nil
+}
+
+func (l *scriptedLine) Set(bool) error {
+	return nil
+}
+
+func (l *scriptedLine) Wait(time.Duration) (gpio.Event, bool, error) {
+	if l.err != nil {
+		return gpio.Event{}, false, l.err
+	}
+	if l.period == 0 {
+		return gpio.Event{}, false, nil
+	}
+	l.now = l.now.Add(l.period)
+	return gpio.Event{Time: l.now}, true, nil
+}
+
+func (l *scriptedLine) Close() error {
+	return nil
+}
+
+func TestTachMeasure(t *testing.T) {
+	tests := []struct {
+		name         string
+		period       time.Duration
+		pulsesPerRev int
+		want         int64
+	}{
+		{name: "stopped", period: 0, pulsesPerRev: 2, want: 0},
+		{name: "1200 rpm", period: 25 * time.Millisecond, pulsesPerRev: 2, want: 1200},
+		{name: "10000 rpm", period: 3 * time.Millisecond, pulsesPerRev: 2, want: 10000},
+		{name: "one pulse per rev", period: 40 * time.Millisecond, pulsesPerRev: 1, want: 1500},
+		{name: "slower than the span", period: 150 * time.Millisecond, pulsesPerRev: 2, want: 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tach := &fanTach{
+				line:         &scriptedLine{now: time.Now(), period: tt.period},
+				pulsesPerRev: tt.pulsesPerRev,
+				polled:       true,
+			}
+			got, err := tach.measure()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("measure() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTachRunFailed(t *testing.T) {
+	for _, polled := range []bool{false, true} {
+		tach := &fanTach{
+			line:         &scriptedLine{err: errors.New("line gone")},
+			pulsesPerRev: 2,
+			polled:       polled,
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			tach.run(ctx)
+			close(done)
+		}()
+		deadline := time.Now().Add(time.Second)
+		for !tach.failed.Load() && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if !tach.failed.Load() {
+			t.Errorf("polled %v: tach not marked failed", polled)
+		}
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("polled %v: run did not return", polled)
+		}
+		tach.working()
+		if tach.failed.Load() {
+			t.Errorf("polled %v: tach still failed after a read", polled)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"picp/config"
+	"picp/gpio"
+	"picp/logger"
+	"picp/ups"
+	"picp/utils"
+	"time"
+)
+
+var upsRunner *utils.Runner
+var upsStatus atomic.Pointer[UpsStatus]
+
+type UpsStatus struct {
+	ups.Status
+	ShutdownAt time.Time `json:"shutdown_at"`
+	UpdateTime time.Time `json:"update_time"`
+}
+
+func upsInit(ctx context.Context) {
+	upsRunner = utils.NewRunner(ctx, runUps)
+	upsRunner.Start()
+}
+
+func createGauge(cfg *config.UPS) (ups.Gauge, error) {
+	bus, err := cfg.Create()
+	if err != nil {
+		return nil, err
+	}
+	var gauge ups.Gauge
+	switch cfg.Chip {
+	case "max17040":
+		gauge, err = ups.NewMAX17040(bus)
+	case "max17048":
+		gauge, err = ups.NewMAX17048(bus)
+	case "ina219":
+		gauge, err = ups.NewINA219(bus, ups.INA219Config{
+			ShuntOhms:     cfg.ShuntOhms,
+			MinVoltage:    cfg.MinVoltage,
+			MaxVoltage:    cfg.MaxVoltage,
+			InvertCurrent: cfg.InvertCurrent,
+		})
+	default:
+		err = fmt.Errorf("unsupported ups chip %s", cfg.Chip)
+	}
+	if err != nil {
+		_ = bus.Close()
+		return nil, err
+	}
+	return gauge, nil
+}
+
+func runUps(ctx context.Context) {
+	upsStatus.Store(nil)
+	cfg := config.GetUpsCfg()
+	if !cfg.Enable {
+		return
+	}
+	gauge, err := createGauge(&cfg)
+	if err != nil {
+		if !errors.Is(err, config.ErrorSensorDisabled) {
+			logger.Error("create ups gauge failed", zap.Error(err))
+		}
+		return
+	}
+	var powerPin gpio.Line
+	if cfg.PowerPin >= 0 {
+		powerPin, err = gpio.Request(cfg.PowerPin, gpio.Config{})
+		if err != nil {
+			logger.Error("ups power pin disabled", zap.Error(err))
+		}
+	}
+	// the voltage trend of a max17040 can not tell a full cell on external
+	// power from a discharging one
+	autoShutdown := cfg.Chip != "max17040" || powerPin != nil
+	if !autoShutdown {
+		logger.Warn("ups max17040 without power_pin, low battery shutdown disabled")
+	}
+	interval := time.Second * time.Duration(cfg.Interval)
+	timer := time.NewTimer(0)
+	var shutdownAt time.Time
+	restoreStatus := false
+	defer func() {
+		timer.Stop()
+		_ = gauge.Close()
+		if powerPin != nil {
+			_ = powerPin.Close()
+		}
+		// a pending power action owns the display until it fails
+		if (!shutdownAt.IsZero() || restoreStatus) && !powerPending.Load() {
+			statusRunner.StatusShowEnable(true)
+		}
+	}()
+	for {
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return
+		}
+		if restoreStatus {
+			restoreStatus = false
+			statusRunner.StatusShowEnable(true)
+		}
+		status, err := gauge.Read()
+		if err != nil {
+			logger.Warn("read ups status failed", zap.Error(err))
+			timer.Reset(interval)
+			continue
+		}
+		if powerPin != nil {
+			if charging, err := powerPin.Get(); err == nil {
+				status.Charging = charging
+			}
+		}
+		if autoShutdown && !status.Charging && status.Percent <= cfg.ShutdownPercent {
+			if shutdownAt.IsZero() {
+				shutdownAt = time.Now().Add(time.Second * time.Duration(cfg.ShutdownDelay))
+				logger.Warn("ups battery low, shutdown scheduled", zap.Float32("percent", status.Percent), zap.Time("shutdown_at", shutdownAt))
+				statusRunner.StatusShowEnable(false)
+			}
+			upsStatus.Store(&UpsStatus{Status: *status, ShutdownAt: shutdownAt, UpdateTime: time.Now()})
+			// keep monitoring after the request, runPower restarts this runner
+			// when the shutdown fails
+			remain := time.Until(shutdownAt)
+			switch {
+			case powerPending.Load():
+			case remain <= 0:
+				DisplayAllAlign("Battery low", "Shutting down...")
+				if err = RequestPower(PowerShutdown); err != nil {
+					logger.Error("ups shutdown failed", zap.Error(err))
+				}
+			default:
+				DisplayAllAlign("Battery low", fmt.Sprintf("%.0f%% %.2fV", status.Percent, status.Voltage),
+					fmt.Sprintf("Shutdown in %ds", int(remain.Round(time.Second).Seconds())))
+			}
+			timer.Reset(time.Second)
+			continue
+		}
+		if !shutdownAt.IsZero() {
+			logger.Info("ups power restored, shutdown canceled", zap.Float32("percent", status.Percent))
+			shutdownAt = time.Time{}
+			DisplayAllAlign("Power restored", "Shutdown canceled")
+			restoreStatus = true
+		}
+		upsStatus.Store(&UpsStatus{Status: *status, UpdateTime: time.Now()})
+		timer.Reset(interval)
+	}
+}
+
+func GetUpsStatus() *UpsStatus {
+	return upsStatus.Load()
+}
+
+func SetUpsConfig(cfg *config.UPS) error {
+	err := config.SetUpsCfg(cfg)
+	if err != nil {
+		return err
+	}
+	_ = upsRunner.Stop(context.Background())
+	upsRunner.Start()
+	return nil
+}
+
+func closeUps() {
+	_ = upsRunner.Stop(context.Background())
+}
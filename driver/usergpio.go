@@ -0,0 +1,244 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"picp/config"
+	"picp/gpio"
+	"picp/logger"
+	"picp/pwm"
+	"picp/utils"
+	"sync"
+	"time"
+)
+
+// an input Wait returns this often so the runner can stop
+const userGpioWait = 200 * time.Millisecond
+
+// events queued for a slow subscriber before it misses some
+const gpioSubscriberBuffer = 64
+
+var ErrorGpioNotFound = errors.New("gpio is not in the allowlist")
+
+type GpioStatus struct {
+	Name string `json:"name"`
+	Pin  int    `json:"pin"`
+	Mode string `json:"mode"`
+	// level of inputs and outputs, for pwm pins whether the duty is not zero
+	Value bool   `json:"value"`
+	Duty  uint32 `json:"duty"`
+}
+
+// GpioEvent is an edge seen on an input pin
+type GpioEvent struct {
+	Name   string    `json:"name"`
+	Pin    int       `json:"pin"`
+	Rising bool      `json:"rising"`
+	Time   time.Time `json:"time"`
+}
+
+type userPin struct {
+	cfg   config.UserGpio
+	line  gpio.Line
+	pwm   pwm.Output
+	value atomic.Bool
+	duty  atomic.Uint32
+}
+
+var userGpioRunner *utils.Runner
+var userPins = map[int]*userPin{}
+var userPinsLock sync.RWMutex
+
+var gpioSubscribers = map[chan GpioEvent]struct{}{}
+var gpioSubscribersLock sync.Mutex
+
+func userGpioInit(ctx context.Context) {
+	userGpioRunner = utils.NewRunner(ctx, runUserGpio)
+	userGpioRunner.Start()
+}
+
+func openUserPin(cfg *config.UserGpio) (*userPin, error) {
+	p := &userPin{cfg: *cfg}
+	var err error
+	switch cfg.Mode {
+	case config.GpioModePwm:
+		p.pwm, err = pwm.NewSoftware(cfg.Pin, cfg.Frequency)
+		if err == nil {
+			err = p.setDuty(uint32(cfg.InitialDuty))
+			if err != nil {
+				_ = p.pwm.Close()
+			}
+		}
+	case config.GpioModeOutput:
+		p.line, err = gpio.Request(cfg.Pin, gpio.Config{Output: true, Value: cfg.Initial, ActiveLow: cfg.Active == "low"})
+		p.value.Store(cfg.Initial)
+	default:
+		p.line, err = gpio.Request(cfg.Pin, gpio.Config{
+			ActiveLow: cfg.Active == "low",
+			Bias:      buttonBias[cfg.Pull],
+			Edge:      gpio.EdgeBoth,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *userPin) setDuty(duty uint32) error {
+	if err := p.pwm.SetDuty(duty); err != nil {
+		return err
+	}
+	p.duty.Store(duty)
+	p.value.Store(duty > 0)
+	return nil
+}
+
+func (p *userPin) close() error {
+	if p.pwm != nil {
+		return p.pwm.Close()
+	}
+	return p.line.Close()
+}
+
+func runUserGpio(ctx context.Context) {
+	pins := map[int]*userPin{}
+	for _, cfg := range config.GetUserGpios() {
+		p, err := openUserPin(&cfg)
+		if err != nil {
+			logger.Error("gpio disabled", zap.String("name", cfg.Name), zap.Int("pin", cfg.Pin), zap.Error(err))
+			continue
+		}
+		pins[cfg.Pin] = p
+	}
+	userPinsLock.Lock()
+	userPins = pins
+	userPinsLock.Unlock()
+	var wg sync.WaitGroup
+	for _, p := range pins {
+		if p.cfg.Mode != config.GpioModeInput {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := watchUserPin(ctx, p); err != nil {
+				logger.Error("gpio input stopped", zap.String("name", p.cfg.Name), zap.Error(err))
+			}
+		}()
+	}
+	<-ctx.Done()
+	wg.Wait()
+	userPinsLock.Lock()
+	userPins = map[int]*userPin{}
+	userPinsLock.Unlock()
+	for _, p := range pins {
+		if err := p.close(); err != nil {
+			logger.Debug("close gpio failed", zap.String("name", p.cfg.Name), zap.Error(err))
+		}
+	}
+}
+
+func watchUserPin(ctx context.Context, p *userPin) error {
+	value, err := p.line.Get()
+	if err != nil {
+		return err
+	}
+	p.value.Store(value)
+	for ctx.Err() == nil {
+		event, ok, err := p.line.Wait(userGpioWait)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		p.value.Store(event.Rising)
+		publishGpioEvent(GpioEvent{Name: p.cfg.Name, Pin: p.cfg.Pin, Rising: event.Rising, Time: event.Time})
+	}
+	return nil
+}
+
+func publishGpioEvent(event GpioEvent) {
+	gpioSubscribersLock.Lock()
+	defer gpioSubscribersLock.Unlock()
+	for ch := range gpioSubscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// SubscribeGpio returns the edges of every input pin from now on, cancel
+// must be called once they are not read anymore. A subscriber that falls
+// behind misses events.
+func SubscribeGpio() (events <-chan GpioEvent, cancel func()) {
+	ch := make(chan GpioEvent, gpioSubscriberBuffer)
+	gpioSubscribersLock.Lock()
+	gpioSubscribers[ch] = struct{}{}
+	gpioSubscribersLock.Unlock()
+	return ch, func() {
+		gpioSubscribersLock.Lock()
+		delete(gpioSubscribers, ch)
+		gpioSubscribersLock.Unlock()
+	}
+}
+
+func GetGpioStatus() []GpioStatus {
+	userPinsLock.RLock()
+	defer userPinsLock.RUnlock()
+	ret := make([]GpioStatus, 0, len(userPins))
+	for _, cfg := range config.GetUserGpios() {
+		p, ok := userPins[cfg.Pin]
+		if !ok {
+			continue
+		}
+		ret = append(ret, GpioStatus{
+			Name:  cfg.Name,
+			Pin:   cfg.Pin,
+			Mode:  cfg.Mode,
+			Value: p.value.Load(),
+			Duty:  p.duty.Load(),
+		})
+	}
+	return ret
+}
+
+// SetGpio drives an output pin to value or sets the duty of a pwm pin, pin
+// must be in the allowlist
+func SetGpio(pin int, value bool, duty uint32) error {
+	userPinsLock.RLock()
+	defer userPinsLock.RUnlock()
+	p, ok := userPins[pin]
+	if !ok {
+		return ErrorGpioNotFound
+	}
+	switch p.cfg.Mode {
+	case config.GpioModeOutput:
+		if err := p.line.Set(value); err != nil {
+			return err
+		}
+		p.value.Store(value)
+		logger.Info("gpio set", zap.String("name", p.cfg.Name), zap.Bool("value", value))
+		return nil
+	case config.GpioModePwm:
+		if duty > pwm.MaxDuty {
+			return fmt.Errorf("gpio duty %d out of range 0-%d", duty, pwm.MaxDuty)
+		}
+		if err := p.setDuty(duty); err != nil {
+			return err
+		}
+		logger.Info("gpio duty set", zap.String("name", p.cfg.Name), zap.Uint32("duty", duty))
+		return nil
+	default:
+		return fmt.Errorf("gpio %d is an input", pin)
+	}
+}
+
+func closeUserGpio() {
+	_ = userGpioRunner.Stop(context.Background())
+}
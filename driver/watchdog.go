@@ -0,0 +1,152 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"picp/config"
+	"picp/logger"
+	"picp/utils"
+	"picp/watchdog"
+	"time"
+)
+
+// the health checks may take this long before the service counts as hung
+const watchdogProbeTimeout = 5 * time.Second
+
+var watchdogRunner *utils.Runner
+
+var watchdogHttp = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+func watchdogInit(ctx context.Context) {
+	watchdogRunner = utils.NewRunner(ctx, runWatchdog)
+	watchdogRunner.Start()
+}
+
+// runWatchdog pets the hardware and the systemd watchdog at a third and a
+// half of their timeouts, but only while the service is healthy
+func runWatchdog(ctx context.Context) {
+	cfg := config.GetWatchdogCfg()
+	var device *watchdog.Device
+	var interval time.Duration
+	if cfg.Enable {
+		var err error
+		device, err = watchdog.Open(cfg.Device, time.Duration(cfg.Timeout)*time.Second)
+		if err != nil {
+			logger.Error("open watchdog failed", zap.String("device", cfg.Device), zap.Error(err))
+		} else {
+			interval = device.Timeout() / 3
+			logger.Info("watchdog armed", zap.String("device", cfg.Device), zap.Duration("timeout", device.Timeout()))
+		}
+	}
+	if device != nil {
+		defer func() {
+			if err := device.Close(); err != nil {
+				logger.Error("disarm watchdog failed", zap.Error(err))
+			}
+		}()
+	}
+	if timeout, ok := watchdog.SystemdTimeout(); ok && (interval == 0 || timeout/2 < interval) {
+		interval = timeout / 2
+	}
+	if interval == 0 {
+		notifySystemd(watchdog.NotifyReady)
+		return
+	}
+	defer notifySystemd(watchdog.NotifyStopping)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	ready := false
+	healthy := true
+	for {
+		err := checkHealth(ctx, min(interval, watchdogProbeTimeout))
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err == nil:
+			if device != nil {
+				if err = device.Keepalive(); err != nil {
+					logger.Warn("pet watchdog failed", zap.Error(err))
+				}
+			}
+			if !ready {
+				notifySystemd(watchdog.NotifyReady)
+				ready = true
+			}
+			notifySystemd(watchdog.NotifyWatchdog)
+			if !healthy {
+				logger.Info("service healthy again, watchdog petted")
+			}
+			healthy = true
+		case healthy:
+			logger.Error("service unhealthy, watchdog not petted", zap.Error(err))
+			healthy = false
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func notifySystemd(state string) {
+	if _, err := watchdog.Notify(state); err != nil {
+		logger.Warn("systemd notify failed", zap.String("state", state), zap.Error(err))
+	}
+}
+
+// checkHealth reports a stopped protect or fan loop and an http server not
+// answering within timeout
+func checkHealth(ctx context.Context, timeout time.Duration) error {
+	// runners are stopped on purpose before a shutdown or reboot
+	if powerPending.Load() {
+		return nil
+	}
+	if config.GetProtectCfg().Enable && !protectRunner.IsRunning() {
+		return errors.New("protect stopped")
+	}
+	fanChannelsLock.RLock()
+	for name, c := range fanChannels {
+		cfg, ok := effectiveFanCfg(name)
+		// a fan without output logged it and has nothing to check
+		if ok && cfg.Enable && !c.IsRunning() && !c.openFailed.Load() {
+			fanChannelsLock.RUnlock()
+			return fmt.Errorf("fan %s stopped", name)
+		}
+	}
+	fanChannelsLock.RUnlock()
+	return probeHttp(ctx, timeout)
+}
+
+func probeHttp(ctx context.Context, timeout time.Duration) error {
+	host, port, err := net.SplitHostPort(config.Common.BindAddr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+net.JoinHostPort(host, port)+"/api/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := watchdogHttp.Do(req)
+	if err != nil {
+		return fmt.Errorf("http server: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http server: %s", resp.Status)
+	}
+	return nil
+}
+
+func closeWatchdog() {
+	_ = watchdogRunner.Stop(context.Background())
+}
@@ -2,15 +2,34 @@ package driver
 
 import (
 	"context"
-	"github.com/stianeikeland/go-rpio/v4"
+	"errors"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
 	"picp/config"
+	"picp/logger"
 	"picp/utils"
 	"strings"
+	"sync"
 	"time"
 )
 
 var wifiRunner *utils.Runner
 
+// wifiApActive is read by the status LEDs
+var wifiApActive atomic.Bool
+
+// wifiDevices caches the state of the wifi devices for the LEDs, the buzzer
+// and the strip, so nmcli runs once per ledStateInterval for all of them
+var wifiDevices struct {
+	sync.Mutex
+	sampled time.Time
+	state   LedState
+	ok      bool
+}
+
+// wifiToggle is fed by the buttons bound to the wifi action
+var wifiToggle = make(chan struct{}, 1)
+
 func wifiInit(ctx context.Context) {
 	wifiRunner = utils.NewRunner(ctx, wifiHandler)
 	wifiRunner.Start()
@@ -28,6 +47,7 @@ func (i *WifiInvoker) startAp() {
 	err := startWifiAp(i.cfg)
 	if err == nil {
 		i.enabled = true
+		wifiApActive.Store(true)
 		i.showNotify("Connect success")
 	} else {
 		i.showNotify(strings.Split(err.Error(), "\n")...)
@@ -39,6 +59,7 @@ func (i *WifiInvoker) stopAp() {
 	err := stopWifiAp(i.cfg)
 	if err == nil {
 		i.enabled = false
+		wifiApActive.Store(false)
 		i.showNotify("Stop success")
 	} else {
 		i.showNotify(strings.Split(err.Error(), "\n")...)
@@ -75,31 +96,27 @@ func (i *WifiInvoker) Run() {
 	if !i.cfg.Enable {
 		return
 	}
-	wifiPin := rpio.Pin(i.cfg.Pin)
-	wifiPin.Input()
+	// drop a press made while the runner was stopped
+	select {
+	case <-wifiToggle:
+	default:
+	}
 	timer := time.NewTicker(time.Millisecond * 100)
 	defer func() {
 		timer.Stop()
 		_ = stopWifiAp(i.cfg)
+		wifiApActive.Store(false)
 		statusRunner.StatusShowEnable(true)
 	}()
-	lastApPress := false
 	for {
 		select {
-		case <-timer.C:
-			press := wifiPin.Read() == rpio.High
-			if press != lastApPress {
-				if lastApPress {
-					if !i.checkNotify(true) {
-						i.toggleAp()
-					}
-				} else {
-					i.checkNotify(false)
-				}
-				lastApPress = !lastApPress
-			} else {
-				i.checkNotify(false)
+		case <-wifiToggle:
+			// a press while a notification is shown only dismisses it
+			if !i.checkNotify(true) {
+				i.toggleAp()
 			}
+		case <-timer.C:
+			i.checkNotify(false)
 		case <-i.ctx.Done():
 			return
 		}
@@ -120,6 +137,18 @@ func wifiHandler(ctx context.Context) {
 	NewWifiInvoker(ctx, &cfg).Run()
 }
 
+// ToggleWifiAp starts the access point when it is down and stops it otherwise
+func ToggleWifiAp() error {
+	if !config.GetWifiConfig().Enable {
+		return errors.New("wifi ap is disabled")
+	}
+	select {
+	case wifiToggle <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
 func startWifiAp(cfg *config.Wifi) error {
 	err := utils.ForceScan()
 	if err != nil {
@@ -148,9 +177,42 @@ func SetWifiConfig(wifi *config.Wifi) error {
 	}
 	_ = wifiRunner.Stop(context.Background())
 	wifiRunner.Start()
+	// the implicit wifi button follows the pin
+	restartButtons()
 	return nil
 }
 
 func closeWifi() {
 	_ = wifiRunner.Stop(context.Background())
 }
+
+// wifiDeviceState is wifi_connected, wifi_connecting or idle, ok is false
+// when NetworkManager could not be asked
+func wifiDeviceState() (state LedState, ok bool) {
+	wifiDevices.Lock()
+	defer wifiDevices.Unlock()
+	if time.Since(wifiDevices.sampled) < ledStateInterval {
+		return wifiDevices.state, wifiDevices.ok
+	}
+	state = LedStateIdle
+	devices, err := utils.GetDevices()
+	if err != nil {
+		logger.Debug("get wifi devices error", zap.Error(err))
+	} else {
+		ok = true
+	}
+	for _, device := range devices {
+		if device.Type != wifiDeviceType {
+			continue
+		}
+		if device.State == utils.NMDeviceStateActivated {
+			state = LedStateWifiConnected
+			break
+		}
+		if device.State >= utils.NMDeviceStatePrepare && device.State <= utils.NMDeviceStateSecondaries {
+			state = LedStateWifiConnecting
+		}
+	}
+	wifiDevices.sampled, wifiDevices.state, wifiDevices.ok = time.Now(), state, ok
+	return state, ok
+}
@@ -13,13 +13,16 @@ import (
 	"fmt"
 	"os"
 	"syscall"
+	"time"
 )
 
 // I2C represents a connection to I2C-device.
 type I2C struct {
-	addr uint8
-	bus  int
-	rc   *os.File
+	addr         uint8
+	bus          int
+	rc           *os.File
+	retries      int
+	retryBackoff time.Duration
 }
 
 // NewI2C opens a connection for I2C-device.
@@ -53,10 +56,26 @@ func (v *I2C) write(buf []byte) (int, error) {
 	return v.rc.Write(buf)
 }
 
+// SetRetry configures how many times a failed write is retried.
+// The delay before the first retry is backoff and doubles on every
+// following attempt.
+func (v *I2C) SetRetry(retries int, backoff time.Duration) {
+	v.retries = retries
+	v.retryBackoff = backoff
+}
+
 // WriteBytes send bytes to the remote I2C-device. The interpretation of
 // the message is implementation-dependent.
-func (v *I2C) WriteBytes(buf []byte) (int, error) {
-	return v.write(buf)
+func (v *I2C) WriteBytes(buf []byte) (n int, err error) {
+	backoff := v.retryBackoff
+	for attempt := 0; ; attempt++ {
+		n, err = v.write(buf)
+		if err == nil || attempt >= v.retries {
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
 }
 
 func (v *I2C) read(buf []byte) (int, error) {
@@ -0,0 +1,155 @@
+// Package spi provides low level control over the Linux spidev interface.
+//
+// Before usage you should enable the SPI interface, for example with
+//
+//	dtparam=spi=on
+//
+// in /boot/firmware/config.txt. Every chip select line of a bus shows
+// up as its own /dev/spidevB.C device.
+package spi
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// ioctl requests from linux/spi/spidev.h
+const (
+	spiIocWrMode        = 0x40016b01
+	spiIocWrBitsPerWord = 0x40016b03
+	spiIocWrMaxSpeedHz  = 0x40046b04
+	spiIocMessage1      = 0x40206b00
+)
+
+// SPI modes
+const (
+	Mode0 uint8 = 0x0
+	Mode1 uint8 = 0x1
+	Mode2 uint8 = 0x2
+	Mode3 uint8 = 0x3
+)
+
+// MaxTransferSize is the default spidev buffer size, longer writes are split.
+const MaxTransferSize = 4096
+
+// spiIocTransfer mirrors struct spi_ioc_transfer.
+type spiIocTransfer struct {
+	txBuf          uint64
+	rxBuf          uint64
+	len            uint32
+	speedHz        uint32
+	delayUsecs     uint16
+	bitsPerWord    uint8
+	csChange       uint8
+	txNbits        uint8
+	rxNbits        uint8
+	wordDelayUsecs uint8
+	pad            uint8
+}
+
+// SPI represents a connection to a spidev device.
+type SPI struct {
+	bus   int
+	cs    int
+	speed uint32
+	bits  uint8
+	rc    *os.File
+}
+
+// NewSPI opens /dev/spidev<bus>.<cs>. The device keeps the kernel defaults
+// until SetMode, SetBitsPerWord and SetSpeed are called.
+func NewSPI(bus, cs int) (*SPI, error) {
+	f, err := os.OpenFile(fmt.Sprintf("/dev/spidev%d.%d", bus, cs), os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &SPI{rc: f, bus: bus, cs: cs, bits: 8}, nil
+}
+
+// GetBus return bus number of the device.
+func (s *SPI) GetBus() int {
+	return s.bus
+}
+
+// GetCs return chip select of the device.
+func (s *SPI) GetCs() int {
+	return s.cs
+}
+
+// SetMode sets clock polarity and phase.
+func (s *SPI) SetMode(mode uint8) error {
+	return s.ioctl(spiIocWrMode, unsafe.Pointer(&mode))
+}
+
+// SetBitsPerWord sets the word size.
+func (s *SPI) SetBitsPerWord(bits uint8) error {
+	err := s.ioctl(spiIocWrBitsPerWord, unsafe.Pointer(&bits))
+	if err == nil {
+		s.bits = bits
+	}
+	return err
+}
+
+// SetSpeed sets the maximum clock frequency in Hz.
+func (s *SPI) SetSpeed(hz uint32) error {
+	err := s.ioctl(spiIocWrMaxSpeedHz, unsafe.Pointer(&hz))
+	if err == nil {
+		s.speed = hz
+	}
+	return err
+}
+
+// Tx runs a full duplex transfer. read may be nil, otherwise it must be
+// as long as write.
+func (s *SPI) Tx(write, read []byte) error {
+	if len(write) == 0 {
+		return nil
+	}
+	if read != nil && len(read) != len(write) {
+		return fmt.Errorf("spi read buffer length %d mismatch write length %d", len(read), len(write))
+	}
+	transfer := spiIocTransfer{
+		txBuf:       uint64(uintptr(unsafe.Pointer(&write[0]))),
+		len:         uint32(len(write)),
+		speedHz:     s.speed,
+		bitsPerWord: s.bits,
+	}
+	if read != nil {
+		transfer.rxBuf = uint64(uintptr(unsafe.Pointer(&read[0])))
+	}
+	err := s.ioctl(spiIocMessage1, unsafe.Pointer(&transfer))
+	runtime.KeepAlive(write)
+	runtime.KeepAlive(read)
+	return err
+}
+
+// Write sends buf to the device, split into MaxTransferSize chunks.
+func (s *SPI) Write(buf []byte) error {
+	for len(buf) > 0 {
+		n := len(buf)
+		if n > MaxTransferSize {
+			n = MaxTransferSize
+		}
+		if err := s.Tx(buf[:n], nil); err != nil {
+			return err
+		}
+		buf = buf[n:]
+	}
+	return nil
+}
+
+// Close SPI-connection.
+func (s *SPI) Close() error {
+	return s.rc.Close()
+}
+
+func (s *SPI) ioctl(cmd uintptr, arg unsafe.Pointer) error {
+	_, _, err := syscall.Syscall(syscall.SYS_IOCTL, s.rc.Fd(), cmd, uintptr(arg))
+	if err != 0 {
+		return err
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/pkg/errors v0.9.1
 	github.com/shirou/gopsutil v3.21.11+incompatible
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/stianeikeland/go-rpio/v4 v4.6.0
 	go.uber.org/atomic v1.11.0
 	go.uber.org/zap v1.27.0
@@ -0,0 +1,317 @@
+package gpio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var devRoot = "/dev"
+
+// labels of the chip driving the header pins, pi 1-3, pi 4 and pi 5
+var piChipLabels = []string{"pinctrl-bcm2835", "pinctrl-bcm2711", "pinctrl-rp1"}
+
+// labels of the chips with the registers rpio knows, pi 1-4
+var bcmChipLabels = []string{"pinctrl-bcm2835", "pinctrl-bcm2711"}
+
+const consumer = "picp"
+
+// linux/gpio.h uAPI v2, the structs are marshalled by hand so the layout
+// does not depend on how Go aligns 64 bit fields on 32 bit arm
+const (
+	gpioGetChipInfoIoctl  = 0x8044b401
+	gpioV2GetLineIoctl    = 0xc250b407
+	gpioV2GetValuesIoctl  = 0xc010b40e
+	gpioV2SetValuesIoctl  = 0xc010b40f
+	chipInfoSize          = 68
+	lineRequestSize       = 592
+	lineValuesSize        = 16
+	lineEventSize         = 48
+	lineRequestConsumer   = 256
+	lineRequestFlags      = 288
+	lineRequestNumAttrs   = 296
+	lineRequestAttrs      = 320
+	lineRequestNumLines   = 560
+	lineRequestFd         = 588
+	lineAttrOutputValues  = 2
+	lineEventRisingEdge   = 1
+	lineFlagActiveLow     = 1 << 1
+	lineFlagInput         = 1 << 2
+	lineFlagOutput        = 1 << 3
+	lineFlagEdgeRising    = 1 << 4
+	lineFlagEdgeFalling   = 1 << 5
+	lineFlagPullUp        = 1 << 8
+	lineFlagPullDown      = 1 << 9
+	lineFlagBiasDisabled  = 1 << 10
+	lineFlagClockRealtime = 1 << 11
+)
+
+func ioctl(fd uintptr, request uintptr, buf []byte) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(unsafe.Pointer(&buf[0])))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+type cdevChip struct {
+	file  *os.File
+	label string
+	lines int
+}
+
+// openCdev opens chip, a device name like gpiochip0 or a chip label, or the
+// chip of the header pins of a Raspberry Pi when empty.
+func openCdev(chip string) (backend, error) {
+	paths, err := filepath.Glob(filepath.Join(devRoot, "gpiochip*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		file, err := os.OpenFile(path, os.O_RDWR|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			continue
+		}
+		buf := make([]byte, chipInfoSize)
+		if err = ioctl(file.Fd(), gpioGetChipInfoIoctl, buf); err != nil {
+			_ = file.Close()
+			continue
+		}
+		label := cString(buf[32:64])
+		match := filepath.Base(path) == chip || label == chip
+		if chip == "" {
+			for _, want := range piChipLabels {
+				match = match || label == want
+			}
+		}
+		if match {
+			return &cdevChip{file: file, label: label, lines: int(binary.LittleEndian.Uint32(buf[64:]))}, nil
+		}
+		_ = file.Close()
+	}
+	if chip == "" {
+		return nil, errors.New("gpiochip of the header pins not found")
+	}
+	return nil, fmt.Errorf("gpiochip %s not found", chip)
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+func (c *cdevChip) name() string {
+	return BackendCdev
+}
+
+func (c *cdevChip) bcm() bool {
+	for _, label := range bcmChipLabels {
+		if c.label == label {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeLineRequest builds a struct gpio_v2_line_request, an output may only
+// have a single line
+func encodeLineRequest(pins []int, cfg Config) []byte {
+	buf := make([]byte, lineRequestSize)
+	le := binary.LittleEndian
+	for i, pin := range pins {
+		le.PutUint32(buf[i*4:], uint32(pin))
+	}
+	copy(buf[lineRequestConsumer:], consumer)
+	var flags uint64
+	if cfg.ActiveLow {
+		flags |= lineFlagActiveLow
+	}
+	switch cfg.Bias {
+	case BiasDisable:
+		flags |= lineFlagBiasDisabled
+	case BiasPullUp:
+		flags |= lineFlagPullUp
+	case BiasPullDown:
+		flags |= lineFlagPullDown
+	}
+	if cfg.Output {
+		flags |= lineFlagOutput
+		// a single attribute with the initial value of line 0
+		le.PutUint32(buf[lineRequestNumAttrs:], 1)
+		le.PutUint32(buf[lineRequestAttrs:], lineAttrOutputValues)
+		if cfg.Value {
+			le.PutUint64(buf[lineRequestAttrs+8:], 1)
+		}
+		le.PutUint64(buf[lineRequestAttrs+16:], 1)
+	} else {
+		flags |= lineFlagInput
+		if cfg.Edge == EdgeRising || cfg.Edge == EdgeBoth {
+			flags |= lineFlagEdgeRising
+		}
+		if cfg.Edge == EdgeFalling || cfg.Edge == EdgeBoth {
+			flags |= lineFlagEdgeFalling
+		}
+		if cfg.Edge != EdgeNone {
+			flags |= lineFlagClockRealtime
+		}
+	}
+	le.PutUint64(buf[lineRequestFlags:], flags)
+	le.PutUint32(buf[lineRequestNumLines:], uint32(len(pins)))
+	return buf
+}
+
+// decodeLineEvent reads a struct gpio_v2_line_event, offset is the line on
+// the chip that changed
+func decodeLineEvent(buf []byte) (event Event, offset int) {
+	le := binary.LittleEndian
+	return Event{
+		Rising: le.Uint32(buf[8:]) == lineEventRisingEdge,
+		Time:   time.Unix(0, int64(le.Uint64(buf))),
+	}, int(le.Uint32(buf[12:]))
+}
+
+func (c *cdevChip) request(pin int, cfg Config) (Line, error) {
+	return c.requestLines([]int{pin}, cfg)
+}
+
+func (c *cdevChip) requestGroup(pins []int, cfg Config) (Group, error) {
+	l, err := c.requestLines(pins, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &cdevGroup{cdevLine: l, pins: pins}, nil
+}
+
+func (c *cdevChip) requestLines(pins []int, cfg Config) (*cdevLine, error) {
+	for _, pin := range pins {
+		if pin >= c.lines {
+			return nil, fmt.Errorf("chip has %d lines", c.lines)
+		}
+	}
+	buf := encodeLineRequest(pins, cfg)
+	if err := ioctl(c.file.Fd(), gpioV2GetLineIoctl, buf); err != nil {
+		return nil, err
+	}
+	l := &cdevLine{fd: int(int32(binary.LittleEndian.Uint32(buf[lineRequestFd:]))), epfd: -1}
+	if cfg.Output || cfg.Edge == EdgeNone {
+		return l, nil
+	}
+	var err error
+	l.epfd, err = syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err == nil {
+		event := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(l.fd)}
+		err = syscall.EpollCtl(l.epfd, syscall.EPOLL_CTL_ADD, l.fd, &event)
+	}
+	if err != nil {
+		_ = l.Close()
+		return nil, fmt.Errorf("epoll: %w", err)
+	}
+	return l, nil
+}
+
+func (c *cdevChip) close() error {
+	return c.file.Close()
+}
+
+type cdevLine struct {
+	fd   int
+	epfd int
+}
+
+func (l *cdevLine) Get() (bool, error) {
+	bits, err := l.values(1)
+	return bits&1 != 0, err
+}
+
+// values returns the levels of the lines in mask, bit i is line i of the request
+func (l *cdevLine) values(mask uint64) (uint64, error) {
+	buf := make([]byte, lineValuesSize)
+	binary.LittleEndian.PutUint64(buf[8:], mask)
+	if err := ioctl(uintptr(l.fd), gpioV2GetValuesIoctl, buf); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(buf) & mask, nil
+}
+
+func (l *cdevLine) Set(value bool) error {
+	buf := make([]byte, lineValuesSize)
+	if value {
+		binary.LittleEndian.PutUint64(buf, 1)
+	}
+	binary.LittleEndian.PutUint64(buf[8:], 1)
+	return ioctl(uintptr(l.fd), gpioV2SetValuesIoctl, buf)
+}
+
+func (l *cdevLine) Wait(timeout time.Duration) (Event, bool, error) {
+	event, _, ok, err := l.wait(timeout)
+	return event, ok, err
+}
+
+// wait reads the next edge of any line of the request, the kernel queues
+// them in the order they happened
+func (l *cdevLine) wait(timeout time.Duration) (Event, int, bool, error) {
+	if l.epfd < 0 {
+		return Event{}, 0, false, errors.New("line has no edge detection")
+	}
+	events := make([]syscall.EpollEvent, 1)
+	n, err := syscall.EpollWait(l.epfd, events, int(timeout.Milliseconds()))
+	if err != nil && !errors.Is(err, syscall.EINTR) {
+		return Event{}, 0, false, err
+	}
+	if n <= 0 {
+		return Event{}, 0, false, nil
+	}
+	buf := make([]byte, lineEventSize)
+	if _, err = syscall.Read(l.fd, buf); err != nil {
+		return Event{}, 0, false, err
+	}
+	event, offset := decodeLineEvent(buf)
+	return event, offset, true, nil
+}
+
+func (l *cdevLine) Close() error {
+	var err error
+	if l.epfd >= 0 {
+		err = syscall.Close(l.epfd)
+	}
+	return errors.Join(err, syscall.Close(l.fd))
+}
+
+// cdevGroup is a single request for several lines
+type cdevGroup struct {
+	*cdevLine
+	pins []int
+}
+
+func (g *cdevGroup) Values() ([]bool, error) {
+	bits, err := g.values(1<<len(g.pins) - 1)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]bool, len(g.pins))
+	for i := range values {
+		values[i] = bits&(1<<i) != 0
+	}
+	return values, nil
+}
+
+func (g *cdevGroup) Wait(timeout time.Duration) (Event, int, bool, error) {
+	event, offset, ok, err := g.wait(timeout)
+	if !ok || err != nil {
+		return event, 0, ok, err
+	}
+	for i, pin := range g.pins {
+		if pin == offset {
+			return event, i, true, nil
+		}
+	}
+	return Event{}, 0, false, fmt.Errorf("edge of gpio %d not requested", offset)
+}
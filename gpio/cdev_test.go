@@ -0,0 +1,90 @@
+package gpio
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestEncodeLineRequest(t *testing.T) {
+	le := binary.LittleEndian
+	tests := []struct {
+		name      string
+		cfg       Config
+		wantFlags uint64
+		wantAttrs uint32
+	}{
+		{
+			name:      "button",
+			cfg:       Config{ActiveLow: true, Bias: BiasPullUp, Edge: EdgeBoth},
+			wantFlags: lineFlagActiveLow | lineFlagInput | lineFlagPullUp | lineFlagEdgeRising | lineFlagEdgeFalling | lineFlagClockRealtime,
+		},
+		{
+			name:      "tachometer",
+			cfg:       Config{Bias: BiasPullUp, Edge: EdgeFalling},
+			wantFlags: lineFlagInput | lineFlagPullUp | lineFlagEdgeFalling | lineFlagClockRealtime,
+		},
+		{
+			name:      "plain input",
+			cfg:       Config{Bias: BiasDisable},
+			wantFlags: lineFlagInput | lineFlagBiasDisabled,
+		},
+		{
+			name:      "led",
+			cfg:       Config{Output: true, Value: true},
+			wantFlags: lineFlagOutput,
+			wantAttrs: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := encodeLineRequest([]int{17}, tt.cfg)
+			if len(buf) != lineRequestSize {
+				t.Fatalf("request size = %d, want %d", len(buf), lineRequestSize)
+			}
+			if got := le.Uint32(buf); got != 17 {
+				t.Errorf("offset = %d, want 17", got)
+			}
+			if got := cString(buf[lineRequestConsumer : lineRequestConsumer+32]); got != consumer {
+				t.Errorf("consumer = %q, want %q", got, consumer)
+			}
+			if got := le.Uint64(buf[lineRequestFlags:]); got != tt.wantFlags {
+				t.Errorf("flags = %#x, want %#x", got, tt.wantFlags)
+			}
+			if got := le.Uint32(buf[lineRequestNumAttrs:]); got != tt.wantAttrs {
+				t.Errorf("num_attrs = %d, want %d", got, tt.wantAttrs)
+			}
+			if tt.wantAttrs > 0 {
+				if id, values, mask := le.Uint32(buf[lineRequestAttrs:]), le.Uint64(buf[lineRequestAttrs+8:]), le.Uint64(buf[lineRequestAttrs+16:]); id != lineAttrOutputValues || values != 1 || mask != 1 {
+					t.Errorf("output attribute = %d %d %d, want %d 1 1", id, values, mask, lineAttrOutputValues)
+				}
+			}
+			if got := le.Uint32(buf[lineRequestNumLines:]); got != 1 {
+				t.Errorf("num_lines = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestEncodeGroupRequest(t *testing.T) {
+	le := binary.LittleEndian
+	buf := encodeLineRequest([]int{5, 6}, Config{Bias: BiasPullUp, Edge: EdgeBoth})
+	if a, b := le.Uint32(buf), le.Uint32(buf[4:]); a != 5 || b != 6 {
+		t.Errorf("offsets = %d %d, want 5 6", a, b)
+	}
+	if got := le.Uint32(buf[lineRequestNumLines:]); got != 2 {
+		t.Errorf("num_lines = %d, want 2", got)
+	}
+}
+
+func TestDecodeLineEvent(t *testing.T) {
+	buf := make([]byte, lineEventSize)
+	at := time.Date(2025, 8, 16, 17, 14, 0, 123456789, time.UTC)
+	binary.LittleEndian.PutUint64(buf, uint64(at.UnixNano()))
+	binary.LittleEndian.PutUint32(buf[8:], 2)
+	binary.LittleEndian.PutUint32(buf[12:], 23)
+	event, offset := decodeLineEvent(buf)
+	if event.Rising || !event.Time.Equal(at) || offset != 23 {
+		t.Errorf("decodeLineEvent() = %+v, %d, want falling at %v on 23", event, offset, at)
+	}
+}
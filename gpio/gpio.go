@@ -0,0 +1,219 @@
+// Package gpio requests GPIO lines from one of two backends:
+//
+//	cdev the kernel /dev/gpiochipN character device (uAPI v2), works on every
+//	     board including the Pi 5 and reports edges with timestamps
+//	rpio register access through /dev/gpiomem, Pi 1-4 only
+//
+// Pins are numbered by their offset on the chip, which is the BCM number on
+// a Raspberry Pi.
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stianeikeland/go-rpio/v4"
+	"sync"
+	"time"
+)
+
+const (
+	BackendAuto = "auto"
+	BackendCdev = "cdev"
+	BackendRpio = "rpio"
+)
+
+var ErrUnavailable = errors.New("gpio unavailable")
+
+type Bias int
+
+const (
+	// BiasAsIs leaves the pull resistor the way it is
+	BiasAsIs Bias = iota
+	BiasDisable
+	BiasPullUp
+	BiasPullDown
+)
+
+type Edge int
+
+const (
+	EdgeNone Edge = iota
+	EdgeRising
+	EdgeFalling
+	EdgeBoth
+)
+
+// DefaultPollInterval is how often the rpio backend samples a line for edges
+const DefaultPollInterval = 10 * time.Millisecond
+
+// Config of a requested line, values and edges are logical: with ActiveLow a
+// low level reads as true and rises when the pin is pulled low.
+type Config struct {
+	Output bool
+	// Value is the initial value of an output
+	Value     bool
+	ActiveLow bool
+	Bias      Bias
+	// Edge selects the events Wait reports on an input
+	Edge Edge
+	// PollInterval replaces DefaultPollInterval when edges are polled
+	PollInterval time.Duration
+}
+
+// Event is an edge of a line, Rising when it became true.
+type Event struct {
+	Rising bool
+	Time   time.Time
+}
+
+// Line is a requested GPIO line.
+type Line interface {
+	Get() (bool, error)
+	Set(value bool) error
+	// Wait blocks until an edge selected by Config.Edge or timeout, ok is
+	// false on timeout.
+	Wait(timeout time.Duration) (event Event, ok bool, err error)
+	Close() error
+}
+
+// Group is a set of input lines requested together, the edges of all of
+// them come from one Wait in the order they happened.
+type Group interface {
+	// Values returns the level of every line in the order they were requested
+	Values() ([]bool, error)
+	// Wait is Line.Wait for any of the lines, index is the position of the
+	// line that changed in the request
+	Wait(timeout time.Duration) (event Event, index int, ok bool, err error)
+	Close() error
+}
+
+type backend interface {
+	name() string
+	request(pin int, cfg Config) (Line, error)
+	requestGroup(pins []int, cfg Config) (Group, error)
+	close() error
+}
+
+var (
+	lock       sync.Mutex
+	lines      backend
+	rpioMapped bool
+)
+
+// Open sets up the line backend, auto prefers cdev. The rpio registers are
+// only mapped on the rpio backend or a cdev chip of a Pi 1-4, the address
+// rpio guesses is some other memory everywhere else.
+func Open(name, chip string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	if lines != nil {
+		return nil
+	}
+	var err error
+	switch name {
+	case BackendCdev:
+		lines, err = openCdev(chip)
+	case BackendRpio:
+		lines, err = openRpio()
+	case BackendAuto:
+		lines, err = openCdev(chip)
+		if err != nil {
+			var rpioErr error
+			if lines, rpioErr = openRpio(); rpioErr != nil {
+				err = errors.Join(err, rpioErr)
+			} else {
+				err = nil
+			}
+		}
+	default:
+		err = fmt.Errorf("unknown gpio backend %q", name)
+	}
+	if err != nil {
+		lines = nil
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	// hardware PWM still needs the registers next to the cdev lines
+	if c, ok := lines.(*cdevChip); ok && c.bcm() && rpio.Open() == nil {
+		rpioMapped = true
+	}
+	return nil
+}
+
+// Backend returns the name of the line backend, empty when there is none
+func Backend() string {
+	lock.Lock()
+	defer lock.Unlock()
+	if lines == nil {
+		return ""
+	}
+	return lines.name()
+}
+
+// RpioMapped reports whether the rpio registers can be used directly
+func RpioMapped() bool {
+	lock.Lock()
+	defer lock.Unlock()
+	return rpioMapped
+}
+
+// Request claims pin with cfg.
+func Request(pin int, cfg Config) (Line, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	if lines == nil {
+		return nil, ErrUnavailable
+	}
+	if pin < 0 {
+		return nil, fmt.Errorf("invalid gpio %d", pin)
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	line, err := lines.request(pin, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("request gpio %d: %w", pin, err)
+	}
+	return line, nil
+}
+
+// RequestGroup claims the input pins with cfg at once.
+func RequestGroup(pins []int, cfg Config) (Group, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	if lines == nil {
+		return nil, ErrUnavailable
+	}
+	if cfg.Output {
+		return nil, errors.New("a gpio group is input only")
+	}
+	seen := map[int]bool{}
+	for _, pin := range pins {
+		if pin < 0 || seen[pin] {
+			return nil, fmt.Errorf("invalid gpio %d", pin)
+		}
+		seen[pin] = true
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	group, err := lines.requestGroup(pins, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("request gpios %v: %w", pins, err)
+	}
+	return group, nil
+}
+
+func Close() error {
+	lock.Lock()
+	defer lock.Unlock()
+	var err error
+	if lines != nil {
+		err = lines.close()
+		lines = nil
+	}
+	if rpioMapped {
+		err = errors.Join(err, rpio.Close())
+		rpioMapped = false
+	}
+	return err
+}
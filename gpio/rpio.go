@@ -0,0 +1,150 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stianeikeland/go-rpio/v4"
+	"time"
+)
+
+type rpioBackend struct{}
+
+func openRpio() (backend, error) {
+	if err := rpio.Open(); err != nil {
+		return nil, fmt.Errorf("map rpio registers: %w", err)
+	}
+	rpioMapped = true
+	return rpioBackend{}, nil
+}
+
+func (rpioBackend) name() string {
+	return BackendRpio
+}
+
+func (rpioBackend) request(pin int, cfg Config) (Line, error) {
+	l := &rpioLine{pin: rpio.Pin(pin), cfg: cfg}
+	if cfg.Output {
+		l.pin.Output()
+		return l, l.Set(cfg.Value)
+	}
+	l.pin.Input()
+	switch cfg.Bias {
+	case BiasDisable:
+		l.pin.PullOff()
+	case BiasPullUp:
+		l.pin.PullUp()
+	case BiasPullDown:
+		l.pin.PullDown()
+	}
+	l.last, _ = l.Get()
+	return l, nil
+}
+
+func (b rpioBackend) requestGroup(pins []int, cfg Config) (Group, error) {
+	g := &rpioGroup{cfg: cfg}
+	for _, pin := range pins {
+		line, err := b.request(pin, cfg)
+		if err != nil {
+			return nil, err
+		}
+		g.lines = append(g.lines, line.(*rpioLine))
+	}
+	return g, nil
+}
+
+func (rpioBackend) close() error {
+	return nil
+}
+
+// rpioLine polls for edges every Config.PollInterval
+type rpioLine struct {
+	pin  rpio.Pin
+	cfg  Config
+	last bool
+}
+
+func (l *rpioLine) Get() (bool, error) {
+	return (l.pin.Read() == rpio.High) != l.cfg.ActiveLow, nil
+}
+
+func (l *rpioLine) Set(value bool) error {
+	if value != l.cfg.ActiveLow {
+		l.pin.High()
+	} else {
+		l.pin.Low()
+	}
+	return nil
+}
+
+func (l *rpioLine) Wait(timeout time.Duration) (Event, bool, error) {
+	if l.cfg.Edge == EdgeNone {
+		return Event{}, false, errors.New("line has no edge detection")
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		value, _ := l.Get()
+		now := time.Now()
+		if value != l.last {
+			l.last = value
+			if l.cfg.Edge == EdgeBoth || value == (l.cfg.Edge == EdgeRising) {
+				return Event{Rising: value, Time: now}, true, nil
+			}
+		}
+		remain := deadline.Sub(now)
+		if remain <= 0 {
+			return Event{}, false, nil
+		}
+		time.Sleep(min(remain, l.cfg.PollInterval))
+	}
+}
+
+func (l *rpioLine) Close() error {
+	if l.cfg.Output {
+		l.pin.Input()
+	}
+	return nil
+}
+
+// rpioGroup samples all of its lines together, edges seen in one sample are
+// reported one per Wait in request order
+type rpioGroup struct {
+	cfg   Config
+	lines []*rpioLine
+}
+
+func (g *rpioGroup) Values() ([]bool, error) {
+	values := make([]bool, len(g.lines))
+	for i, l := range g.lines {
+		values[i], _ = l.Get()
+	}
+	return values, nil
+}
+
+func (g *rpioGroup) Wait(timeout time.Duration) (Event, int, bool, error) {
+	if g.cfg.Edge == EdgeNone {
+		return Event{}, 0, false, errors.New("line has no edge detection")
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		now := time.Now()
+		for i, l := range g.lines {
+			value, _ := l.Get()
+			if value == l.last {
+				continue
+			}
+			l.last = value
+			if g.cfg.Edge == EdgeBoth || value == (g.cfg.Edge == EdgeRising) {
+				return Event{Rising: value, Time: now}, i, true, nil
+			}
+		}
+		remain := deadline.Sub(now)
+		if remain <= 0 {
+			return Event{}, 0, false, nil
+		}
+		time.Sleep(min(remain, g.cfg.PollInterval))
+	}
+}
+
+func (g *rpioGroup) Close() error {
+	return nil
+}
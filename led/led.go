@@ -0,0 +1,200 @@
+// Package led blinks indicator LEDs wired to a GPIO or exposed by the
+// kernel under /sys/class/leds, like the on-board ACT LED.
+package led
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/atomic"
+	"picp/gpio"
+	"strings"
+	"time"
+)
+
+const (
+	PatternOff       = "off"
+	PatternSolid     = "solid"
+	PatternSlowBlink = "slow_blink"
+	PatternFastBlink = "fast_blink"
+	PatternHeartbeat = "heartbeat"
+	// PatternMorse is followed by the text to blink
+	PatternMorse = "morse:"
+)
+
+// MorseUnit is the length of a dot, a dash is three of them
+const MorseUnit = 150 * time.Millisecond
+
+// steady patterns still look at changes regularly
+const steadyStep = time.Second
+
+var morseCode = map[rune]string{
+	'A': ".-", 'B': "-...", 'C': "-.-.", 'D': "-..", 'E': ".", 'F': "..-.", 'G': "--.",
+	'H': "....", 'I': "..", 'J': ".---", 'K': "-.-", 'L': ".-..", 'M': "--", 'N': "-.",
+	'O': "---", 'P': ".--.", 'Q': "--.-", 'R': ".-.", 'S': "...", 'T': "-", 'U': "..-",
+	'V': "...-", 'W': ".--", 'X': "-..-", 'Y': "-.--", 'Z': "--..",
+	'0': "-----", '1': ".----", '2': "..---", '3': "...--", '4': "....-",
+	'5': ".....", '6': "-....", '7': "--...", '8': "---..", '9': "----.",
+}
+
+// Output is a LED that is either on or off.
+type Output interface {
+	Set(on bool) error
+	Close() error
+}
+
+// Step keeps the LED on or off for Duration, a pattern repeats its steps.
+type Step struct {
+	On       bool
+	Duration time.Duration
+}
+
+// Steps returns the steps of pattern.
+func Steps(pattern string) ([]Step, error) {
+	switch pattern {
+	case PatternOff:
+		return []Step{{false, steadyStep}}, nil
+	case PatternSolid:
+		return []Step{{true, steadyStep}}, nil
+	case PatternSlowBlink:
+		return []Step{{true, time.Second}, {false, time.Second}}, nil
+	case PatternFastBlink:
+		return []Step{{true, 100 * time.Millisecond}, {false, 100 * time.Millisecond}}, nil
+	case PatternHeartbeat:
+		return []Step{{true, 100 * time.Millisecond}, {false, 100 * time.Millisecond},
+			{true, 100 * time.Millisecond}, {false, 700 * time.Millisecond}}, nil
+	}
+	if text, ok := strings.CutPrefix(pattern, PatternMorse); ok {
+		return morseSteps(text)
+	}
+	return nil, fmt.Errorf("unknown led pattern %q", pattern)
+}
+
+// morseSteps uses the standard timing: one unit between the symbols of a
+// letter, three between letters and seven between words and repetitions
+func morseSteps(text string) ([]Step, error) {
+	var steps []Step
+	gap := func(units int) {
+		duration := time.Duration(units) * MorseUnit
+		if len(steps) > 0 && !steps[len(steps)-1].On {
+			steps[len(steps)-1].Duration = max(steps[len(steps)-1].Duration, duration)
+			return
+		}
+		steps = append(steps, Step{false, duration})
+	}
+	for _, word := range strings.Fields(strings.ToUpper(text)) {
+		if len(steps) > 0 {
+			gap(7)
+		}
+		for i, letter := range word {
+			code, ok := morseCode[letter]
+			if !ok {
+				return nil, fmt.Errorf("no morse code for %q", letter)
+			}
+			if i > 0 {
+				gap(3)
+			}
+			for j, symbol := range code {
+				if j > 0 {
+					gap(1)
+				}
+				units := 1
+				if symbol == '-' {
+					units = 3
+				}
+				steps = append(steps, Step{true, time.Duration(units) * MorseUnit})
+			}
+		}
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("empty morse text")
+	}
+	gap(7)
+	return steps, nil
+}
+
+// Check reports whether pattern is valid.
+func Check(pattern string) error {
+	_, err := Steps(pattern)
+	return err
+}
+
+// Blinker plays a pattern on an Output until its context is done.
+type Blinker struct {
+	out     Output
+	pattern atomic.String
+	wake    chan struct{}
+}
+
+func NewBlinker(out Output) *Blinker {
+	b := &Blinker{out: out, wake: make(chan struct{}, 1)}
+	b.pattern.Store(PatternOff)
+	return b
+}
+
+func (b *Blinker) Pattern() string {
+	return b.pattern.Load()
+}
+
+// SetPattern switches to pattern, starting it over unless it is playing
+// already. pattern must be valid.
+func (b *Blinker) SetPattern(pattern string) {
+	if b.pattern.Swap(pattern) == pattern {
+		return
+	}
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run plays the pattern and turns the LED off when ctx is done.
+func (b *Blinker) Run(ctx context.Context) error {
+	defer func() {
+		_ = b.out.Set(false)
+	}()
+	timer := time.NewTimer(steadyStep)
+	defer timer.Stop()
+	for {
+		steps, err := Steps(b.pattern.Load())
+		if err != nil {
+			return err
+		}
+		for i := 0; ; i = (i + 1) % len(steps) {
+			if err = b.out.Set(steps[i].On); err != nil {
+				return err
+			}
+			timer.Reset(steps[i].Duration)
+			select {
+			case <-timer.C:
+				continue
+			case <-b.wake:
+				timer.Stop()
+			case <-ctx.Done():
+				return nil
+			}
+			break
+		}
+	}
+}
+
+type gpioOutput struct {
+	line gpio.Line
+}
+
+// NewGpio drives a LED on a GPIO, activeLow for a LED wired to 3.3V.
+func NewGpio(pin int, activeLow bool) (Output, error) {
+	line, err := gpio.Request(pin, gpio.Config{Output: true, ActiveLow: activeLow})
+	if err != nil {
+		return nil, err
+	}
+	return &gpioOutput{line: line}, nil
+}
+
+func (o *gpioOutput) Set(on bool) error {
+	return o.line.Set(on)
+}
+
+func (o *gpioOutput) Close() error {
+	return errors.Join(o.line.Set(false), o.line.Close())
+}
@@ -0,0 +1,88 @@
+package led
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMorseSteps(t *testing.T) {
+	dot := Step{true, MorseUnit}
+	dash := Step{true, 3 * MorseUnit}
+	gap := func(units int) Step {
+		return Step{false, time.Duration(units) * MorseUnit}
+	}
+	tests := []struct {
+		text    string
+		want    []Step
+		wantErr bool
+	}{
+		{text: "e", want: []Step{dot, gap(7)}},
+		{text: "SOS", want: []Step{dot, gap(1), dot, gap(1), dot, gap(3), dash, gap(1), dash, gap(1), dash, gap(3), dot, gap(1), dot, gap(1), dot, gap(7)}},
+		{text: "E T", want: []Step{dot, gap(7), dash, gap(7)}},
+		{text: " ", wantErr: true},
+		{text: "E!", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := Steps(PatternMorse + tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Steps() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Steps() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSysfs(t *testing.T) {
+	root := ledsRoot
+	t.Cleanup(func() {
+		ledsRoot = root
+	})
+	ledsRoot = t.TempDir()
+	dir := filepath.Join(ledsRoot, "ACT")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"trigger":        "none timer [mmc0] heartbeat\n",
+		"max_brightness": "255\n",
+		"brightness":     "0\n",
+	}
+	for name, value := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(data))
+	}
+	out, err := NewSysfs("ACT")
+	if err != nil {
+		t.Fatal("NewSysfs", err)
+	}
+	if got := read("trigger"); got != "none" {
+		t.Errorf("trigger = %s, want none", got)
+	}
+	if err = out.Set(true); err != nil || read("brightness") != "255" {
+		t.Errorf("Set(true) error = %v, brightness = %s", err, read("brightness"))
+	}
+	if err = out.Close(); err != nil {
+		t.Fatal("Close", err)
+	}
+	if got := read("brightness"); got != "0" {
+		t.Errorf("brightness after close = %s, want 0", got)
+	}
+	if got := read("trigger"); got != "mmc0" {
+		t.Errorf("trigger after close = %s, want mmc0", got)
+	}
+}
@@ -0,0 +1,70 @@
+package led
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ledsRoot = "/sys/class/leds"
+
+type sysfsOutput struct {
+	dir string
+	// trigger active before the LED was taken over, restored on Close
+	trigger string
+	max     string
+}
+
+// NewSysfs takes /sys/class/leds/<name> over from its kernel trigger.
+func NewSysfs(name string) (Output, error) {
+	o := &sysfsOutput{dir: filepath.Join(ledsRoot, name)}
+	triggers, err := os.ReadFile(filepath.Join(o.dir, "trigger"))
+	if err != nil {
+		return nil, fmt.Errorf("led %s: %w", name, err)
+	}
+	o.trigger = activeTrigger(string(triggers))
+	maxBrightness, err := os.ReadFile(filepath.Join(o.dir, "max_brightness"))
+	if err != nil {
+		return nil, fmt.Errorf("led %s: %w", name, err)
+	}
+	o.max = strings.TrimSpace(string(maxBrightness))
+	if err = o.write("trigger", "none"); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// activeTrigger picks the bracketed entry of the trigger list
+func activeTrigger(triggers string) string {
+	for _, trigger := range strings.Fields(triggers) {
+		if strings.HasPrefix(trigger, "[") && strings.HasSuffix(trigger, "]") {
+			return strings.Trim(trigger, "[]")
+		}
+	}
+	return ""
+}
+
+func (o *sysfsOutput) write(name, value string) error {
+	err := os.WriteFile(filepath.Join(o.dir, name), []byte(value), 0644)
+	if err != nil {
+		return fmt.Errorf("write led %s: %w", name, err)
+	}
+	return nil
+}
+
+func (o *sysfsOutput) Set(on bool) error {
+	if on {
+		return o.write("brightness", o.max)
+	}
+	return o.write("brightness", "0")
+}
+
+func (o *sysfsOutput) Close() error {
+	err := o.Set(false)
+	if o.trigger != "" && o.trigger != "none" {
+		err = errors.Join(err, o.write("trigger", o.trigger))
+	}
+	return err
+}
@@ -15,6 +15,7 @@ import (
 	"picp/config"
 	"picp/driver"
 	"picp/logger"
+	"strings"
 	"syscall"
 )
 
@@ -39,6 +40,7 @@ func main() {
 	if err != nil {
 		logger.Fatal("server listen error", zap.Error(err), zap.String("bind_addr", config.Common.BindAddr))
 	}
+	driver.Version = strings.TrimSpace(version)
 	driver.Init(ctx)
 	gp.Go(func() error {
 		select {
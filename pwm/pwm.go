@@ -0,0 +1,216 @@
+// Package pwm drives a fan through one of several PWM backends:
+//
+//	rpio     hardware PWM through /dev/gpiomem, GPIO 12 13 18 19 40 41 45
+//	sysfs    the kernel /sys/class/pwm/pwmchipN interface, needed on the Pi 5
+//	software a goroutine toggling any GPIO line, for low frequency fans
+package pwm
+
+import (
+	"fmt"
+	"github.com/stianeikeland/go-rpio/v4"
+	"go.uber.org/atomic"
+	"picp/gpio"
+	"time"
+)
+
+const (
+	BackendRpio     = "rpio"
+	BackendSysfs    = "sysfs"
+	BackendSoftware = "software"
+)
+
+// MaxDuty is the full scale of SetDuty, duties are percentages
+const MaxDuty = 100
+
+// MaxSoftwareFrequency keeps the toggling goroutine from eating a core
+const MaxSoftwareFrequency = 1000
+
+// MaxSoftwareTone allows the short tones of a buzzer to go higher, they are
+// rough but audible
+const MaxSoftwareTone = 5000
+
+// rpio needs a PWM clock of at least this many Hz
+const minRpioClock = 4688
+
+// MinRpioFrequency is the lowest output frequency rpio reaches with MaxDuty steps
+const MinRpioFrequency = minRpioClock/MaxDuty + 1
+
+// HardwarePins can be muxed to a hardware PWM channel by rpio
+var HardwarePins = []int{12, 13, 18, 19, 40, 41, 45}
+
+// Output is a PWM signal with a duty between 0 and MaxDuty.
+type Output interface {
+	SetDuty(duty uint32) error
+	Close() error
+}
+
+// Tuner is an Output that can change its frequency while running, all the
+// backends here are.
+type Tuner interface {
+	Output
+	SetFrequency(frequency int) error
+}
+
+// HardwareChannel returns the PWM channel rpio muxes pin to, -1 for other
+// pins. Pins on one channel always carry the same signal.
+func HardwareChannel(pin int) int {
+	switch pin {
+	case 12, 18, 40:
+		return 0
+	case 13, 19, 41, 45:
+		return 1
+	}
+	return -1
+}
+
+func IsHardwarePin(pin int) bool {
+	for _, p := range HardwarePins {
+		if p == pin {
+			return true
+		}
+	}
+	return false
+}
+
+type rpioOutput struct {
+	pin rpio.Pin
+}
+
+// NewRpio sets up hardware PWM, clock is the PWM clock in Hz and the
+// output runs at clock / MaxDuty.
+func NewRpio(pin int, clock int) (Output, error) {
+	if !IsHardwarePin(pin) {
+		return nil, fmt.Errorf("gpio %d has no hardware pwm", pin)
+	}
+	if !gpio.RpioMapped() {
+		return nil, fmt.Errorf("rpio pwm: %w", gpio.ErrUnavailable)
+	}
+	o := &rpioOutput{pin: rpio.Pin(pin)}
+	o.pin.Pwm()
+	o.pin.Freq(clock)
+	o.pin.DutyCycle(0, MaxDuty)
+	return o, nil
+}
+
+func (o *rpioOutput) SetDuty(duty uint32) error {
+	o.pin.DutyCycle(duty, MaxDuty)
+	return nil
+}
+
+// CheckRpioFrequency reports a frequency the rpio clock divider cannot reach
+func CheckRpioFrequency(frequency int) error {
+	if frequency < MinRpioFrequency {
+		return fmt.Errorf("rpio pwm frequency %d below %d", frequency, MinRpioFrequency)
+	}
+	return nil
+}
+
+// SetFrequency changes the PWM clock, which the two hardware channels share
+func (o *rpioOutput) SetFrequency(frequency int) error {
+	if err := CheckRpioFrequency(frequency); err != nil {
+		return err
+	}
+	o.pin.Freq(frequency * MaxDuty)
+	return nil
+}
+
+func (o *rpioOutput) Close() error {
+	o.pin.DutyCycle(0, MaxDuty)
+	return nil
+}
+
+type softwareOutput struct {
+	line   gpio.Line
+	period atomic.Duration
+	duty   atomic.Uint32
+	// wakes a parked goroutine when the duty changes
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewSoftware toggles pin from a goroutine at frequency Hz. Timing jitter
+// makes it only suitable for fans that accept a slow PWM signal.
+func NewSoftware(pin int, frequency int) (Output, error) {
+	if frequency <= 0 || frequency > MaxSoftwareFrequency {
+		return nil, fmt.Errorf("software pwm frequency %d out of range 1-%d", frequency, MaxSoftwareFrequency)
+	}
+	line, err := gpio.Request(pin, gpio.Config{Output: true})
+	if err != nil {
+		return nil, err
+	}
+	o := &softwareOutput{
+		line: line,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	o.period.Store(time.Second / time.Duration(frequency))
+	go o.run()
+	return o, nil
+}
+
+func (o *softwareOutput) run() {
+	defer close(o.done)
+	defer o.line.Set(false)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		period := o.period.Load()
+		on := period * time.Duration(o.duty.Load()) / MaxDuty
+		// a steady level needs no toggling, park until the duty changes
+		if on <= 0 || on >= period {
+			_ = o.line.Set(on > 0)
+			select {
+			case <-o.wake:
+				continue
+			case <-o.stop:
+				return
+			}
+		}
+		_ = o.line.Set(true)
+		if !o.wait(timer, on) {
+			return
+		}
+		_ = o.line.Set(false)
+		if !o.wait(timer, period-on) {
+			return
+		}
+	}
+}
+
+func (o *softwareOutput) wait(timer *time.Timer, d time.Duration) bool {
+	timer.Reset(d)
+	select {
+	case <-timer.C:
+		return true
+	case <-o.stop:
+		return false
+	}
+}
+
+func (o *softwareOutput) SetDuty(duty uint32) error {
+	if duty > MaxDuty {
+		duty = MaxDuty
+	}
+	o.duty.Store(duty)
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (o *softwareOutput) SetFrequency(frequency int) error {
+	if frequency <= 0 || frequency > MaxSoftwareTone {
+		return fmt.Errorf("software pwm frequency %d out of range 1-%d", frequency, MaxSoftwareTone)
+	}
+	o.period.Store(time.Second / time.Duration(frequency))
+	return nil
+}
+
+func (o *softwareOutput) Close() error {
+	close(o.stop)
+	<-o.done
+	return o.line.Close()
+}
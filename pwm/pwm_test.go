@@ -0,0 +1,89 @@
+package pwm
+
+import (
+	"picp/gpio"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLine counts the writes of a software output
+type fakeLine struct {
+	lock  sync.Mutex
+	value bool
+	sets  int
+}
+
+func (l *fakeLine) Get() (bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.value, nil
+}
+
+func (l *fakeLine) Set(value bool) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.value = value
+	l.sets++
+	return nil
+}
+
+func (l *fakeLine) Wait(time.Duration) (gpio.Event, bool, error) {
+	return gpio.Event{}, false, nil
+}
+
+func (l *fakeLine) Close() error {
+	return nil
+}
+
+func (l *fakeLine) state() (bool, int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.value, l.sets
+}
+
+func TestSoftwareParks(t *testing.T) {
+	line := &fakeLine{}
+	o := &softwareOutput{
+		line: line,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	o.period.Store(time.Millisecond)
+	go o.run()
+	defer o.Close()
+	tests := []struct {
+		name   string
+		duty   uint32
+		value  bool
+		toggle bool
+	}{
+		{name: "off", duty: 0, value: false},
+		{name: "half", duty: 50, toggle: true},
+		{name: "full", duty: MaxDuty, value: true},
+		{name: "off again", duty: 0, value: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_ = o.SetDuty(tt.duty)
+			// let the goroutine finish the period it is in
+			time.Sleep(10 * time.Millisecond)
+			value, before := line.state()
+			time.Sleep(50 * time.Millisecond)
+			_, after := line.state()
+			if tt.toggle {
+				if after-before < 10 {
+					t.Errorf("line set %d times in 50 periods, want toggling", after-before)
+				}
+				return
+			}
+			if after != before {
+				t.Errorf("parked line set %d times", after-before)
+			}
+			if value != tt.value {
+				t.Errorf("line = %v, want %v", value, tt.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package pwm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var sysfsRoot = "/sys/class/pwm"
+
+// udev may need a moment to fix the permissions of a freshly exported channel
+const (
+	exportTimeout  = time.Second
+	exportInterval = 50 * time.Millisecond
+)
+
+type sysfsOutput struct {
+	chip    string
+	channel int
+	dir     string
+	period  uint64
+	duty    uint32
+}
+
+// NewSysfs exports channel of /sys/class/pwm/pwmchip<chip> and starts it
+// at frequency Hz with a zero duty.
+func NewSysfs(chip, channel int, frequency int) (Output, error) {
+	if frequency <= 0 {
+		return nil, fmt.Errorf("invalid pwm frequency %d", frequency)
+	}
+	o := &sysfsOutput{
+		chip:    filepath.Join(sysfsRoot, "pwmchip"+strconv.Itoa(chip)),
+		channel: channel,
+		period:  uint64(time.Second) / uint64(frequency),
+	}
+	o.dir = filepath.Join(o.chip, "pwm"+strconv.Itoa(channel))
+	if err := o.export(); err != nil {
+		return nil, err
+	}
+	// the duty may not exceed the period, so clear it before changing the period
+	err := o.write("duty_cycle", 0)
+	if err == nil {
+		err = o.write("period", o.period)
+	}
+	if err == nil {
+		err = o.write("enable", 1)
+	}
+	if err != nil {
+		_ = o.unexport()
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *sysfsOutput) export() error {
+	if _, err := os.Stat(o.dir); err == nil {
+		return nil
+	}
+	err := os.WriteFile(filepath.Join(o.chip, "export"), []byte(strconv.Itoa(o.channel)), 0644)
+	if err != nil {
+		return fmt.Errorf("export pwm channel %d: %w", o.channel, err)
+	}
+	deadline := time.Now().Add(exportTimeout)
+	for {
+		f, err := os.OpenFile(filepath.Join(o.dir, "enable"), os.O_WRONLY, 0)
+		if err == nil {
+			return f.Close()
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("wait pwm channel %d: %w", o.channel, err)
+		}
+		time.Sleep(exportInterval)
+	}
+}
+
+func (o *sysfsOutput) unexport() error {
+	err := os.WriteFile(filepath.Join(o.chip, "unexport"), []byte(strconv.Itoa(o.channel)), 0644)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unexport pwm channel %d: %w", o.channel, err)
+	}
+	return nil
+}
+
+func (o *sysfsOutput) write(name string, value uint64) error {
+	err := os.WriteFile(filepath.Join(o.dir, name), []byte(strconv.FormatUint(value, 10)), 0644)
+	if err != nil {
+		return fmt.Errorf("write pwm %s: %w", name, err)
+	}
+	return nil
+}
+
+func (o *sysfsOutput) SetDuty(duty uint32) error {
+	if duty > MaxDuty {
+		duty = MaxDuty
+	}
+	o.duty = duty
+	return o.write("duty_cycle", o.period*uint64(duty)/MaxDuty)
+}
+
+// SetFrequency changes the period and keeps the duty
+func (o *sysfsOutput) SetFrequency(frequency int) error {
+	if frequency <= 0 {
+		return fmt.Errorf("invalid pwm frequency %d", frequency)
+	}
+	period := uint64(time.Second) / uint64(frequency)
+	if period == o.period {
+		return nil
+	}
+	err := o.write("duty_cycle", 0)
+	if err == nil {
+		err = o.write("period", period)
+	}
+	if err != nil {
+		return err
+	}
+	o.period = period
+	return o.SetDuty(o.duty)
+}
+
+func (o *sysfsOutput) Close() error {
+	err := o.write("duty_cycle", 0)
+	if err == nil {
+		err = o.write("enable", 0)
+	}
+	return errors.Join(err, o.unexport())
+}
@@ -0,0 +1,81 @@
+package pwm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readAttr(t *testing.T, dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func TestSysfs(t *testing.T) {
+	root := sysfsRoot
+	t.Cleanup(func() {
+		sysfsRoot = root
+	})
+	sysfsRoot = t.TempDir()
+	chip := filepath.Join(sysfsRoot, "pwmchip0")
+	// the kernel creates pwm1 on export, the fake tree has it already
+	dir := filepath.Join(chip, "pwm1")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"enable", "period", "duty_cycle"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("0\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, err := NewSysfs(0, 1, 25000)
+	if err != nil {
+		t.Fatal("NewSysfs", err)
+	}
+	if got := readAttr(t, dir, "period"); got != "40000" {
+		t.Errorf("period = %s, want 40000", got)
+	}
+	if got := readAttr(t, dir, "enable"); got != "1" {
+		t.Errorf("enable = %s, want 1", got)
+	}
+	tests := []struct {
+		duty uint32
+		want string
+	}{
+		{duty: 0, want: "0"},
+		{duty: 30, want: "12000"},
+		{duty: 100, want: "40000"},
+		{duty: 150, want: "40000"},
+	}
+	for _, tt := range tests {
+		if err = out.SetDuty(tt.duty); err != nil {
+			t.Fatal("SetDuty", err)
+		}
+		if got := readAttr(t, dir, "duty_cycle"); got != tt.want {
+			t.Errorf("SetDuty(%d) duty_cycle = %s, want %s", tt.duty, got, tt.want)
+		}
+	}
+	// a new frequency keeps the duty
+	if err = out.SetDuty(30); err != nil {
+		t.Fatal("SetDuty", err)
+	}
+	if err = out.(Tuner).SetFrequency(1000); err != nil {
+		t.Fatal("SetFrequency", err)
+	}
+	if got := readAttr(t, dir, "period"); got != "1000000" {
+		t.Errorf("period = %s, want 1000000", got)
+	}
+	if got := readAttr(t, dir, "duty_cycle"); got != "300000" {
+		t.Errorf("duty_cycle = %s, want 300000", got)
+	}
+	if err = out.Close(); err != nil {
+		t.Fatal("Close", err)
+	}
+	if got := readAttr(t, chip, "unexport"); got != "1" {
+		t.Errorf("unexport = %s, want 1", got)
+	}
+}
@@ -0,0 +1,99 @@
+package rtc
+
+import (
+	"fmt"
+	"time"
+)
+
+// DS3231 registers
+const (
+	ds3231SECONDS = 0x00
+	ds3231STATUS  = 0x0F
+	ds3231TEMPMSB = 0x11
+
+	ds3231StatusOSF = 0x80
+	ds3231Hour12    = 0x40
+	ds3231HourPM    = 0x20
+	ds3231Century   = 0x80
+)
+
+// DS3231 is a temperature compensated RTC.
+type DS3231 struct {
+	bus Bus
+}
+
+// NewDS3231 creates a DS3231 clock. The I2C wire must already be configured.
+func NewDS3231(bus Bus) (*DS3231, error) {
+	if _, err := bus.ReadRegU8(ds3231STATUS); err != nil {
+		return nil, fmt.Errorf("read DS3231 status: %w", err)
+	}
+	return &DS3231{bus: bus}, nil
+}
+
+func (d *DS3231) ReadTime() (time.Time, error) {
+	status, err := d.bus.ReadRegU8(ds3231STATUS)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("read DS3231 status: %w", err)
+	}
+	if status&ds3231StatusOSF != 0 {
+		return time.Time{}, ErrTimeInvalid
+	}
+	buf, _, err := d.bus.ReadRegBytes(ds3231SECONDS, 7)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("read DS3231 time: %w", err)
+	}
+	var hour int
+	if buf[2]&ds3231Hour12 != 0 {
+		hour = bcdToBin(buf[2]&0x1F) % 12
+		if buf[2]&ds3231HourPM != 0 {
+			hour += 12
+		}
+	} else {
+		hour = bcdToBin(buf[2] & 0x3F)
+	}
+	year := 2000 + bcdToBin(buf[6])
+	if buf[5]&ds3231Century != 0 {
+		year += 100
+	}
+	return time.Date(year, time.Month(bcdToBin(buf[5]&0x1F)), bcdToBin(buf[4]&0x3F),
+		hour, bcdToBin(buf[1]&0x7F), bcdToBin(buf[0]&0x7F), 0, time.UTC), nil
+}
+
+func (d *DS3231) SetTime(t time.Time) error {
+	t = t.UTC()
+	month := binToBcd(int(t.Month()))
+	if t.Year() >= 2100 {
+		month |= ds3231Century
+	}
+	_, err := d.bus.WriteBytes([]byte{
+		ds3231SECONDS,
+		binToBcd(t.Second()),
+		binToBcd(t.Minute()),
+		binToBcd(t.Hour()),
+		byte(t.Weekday()) + 1,
+		binToBcd(t.Day()),
+		month,
+		binToBcd(t.Year() % 100),
+	})
+	if err != nil {
+		return fmt.Errorf("write DS3231 time: %w", err)
+	}
+	status, err := d.bus.ReadRegU8(ds3231STATUS)
+	if err != nil {
+		return fmt.Errorf("read DS3231 status: %w", err)
+	}
+	return d.bus.WriteRegU8(ds3231STATUS, status&^ds3231StatusOSF)
+}
+
+func (d *DS3231) Temperature() (float32, error) {
+	buf, _, err := d.bus.ReadRegBytes(ds3231TEMPMSB, 2)
+	if err != nil {
+		return 0, fmt.Errorf("read DS3231 temperature: %w", err)
+	}
+	// integer part in the MSB, quarter degrees in the upper two bits of the LSB
+	return float32(int8(buf[0])) + float32(buf[1]>>6)*0.25, nil
+}
+
+func (d *DS3231) Close() error {
+	return d.bus.Close()
+}
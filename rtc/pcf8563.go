@@ -0,0 +1,71 @@
+package rtc
+
+import (
+	"fmt"
+	"time"
+)
+
+// PCF8563 registers
+const (
+	pcf8563CONTROL1 = 0x00
+	pcf8563SECONDS  = 0x02
+
+	pcf8563VoltageLow = 0x80
+	pcf8563Century    = 0x80
+)
+
+// PCF8563 is a low power RTC.
+type PCF8563 struct {
+	bus Bus
+}
+
+// NewPCF8563 creates a PCF8563 clock. The I2C wire must already be configured.
+func NewPCF8563(bus Bus) (*PCF8563, error) {
+	if _, err := bus.ReadRegU8(pcf8563CONTROL1); err != nil {
+		return nil, fmt.Errorf("read PCF8563 control: %w", err)
+	}
+	return &PCF8563{bus: bus}, nil
+}
+
+func (p *PCF8563) ReadTime() (time.Time, error) {
+	buf, _, err := p.bus.ReadRegBytes(pcf8563SECONDS, 7)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("read PCF8563 time: %w", err)
+	}
+	if buf[0]&pcf8563VoltageLow != 0 {
+		return time.Time{}, ErrTimeInvalid
+	}
+	year := 2000 + bcdToBin(buf[6])
+	if buf[5]&pcf8563Century != 0 {
+		year += 100
+	}
+	return time.Date(year, time.Month(bcdToBin(buf[5]&0x1F)), bcdToBin(buf[3]&0x3F),
+		bcdToBin(buf[2]&0x3F), bcdToBin(buf[1]&0x7F), bcdToBin(buf[0]&0x7F), 0, time.UTC), nil
+}
+
+func (p *PCF8563) SetTime(t time.Time) error {
+	t = t.UTC()
+	month := binToBcd(int(t.Month()))
+	if t.Year() >= 2100 {
+		month |= pcf8563Century
+	}
+	// writing the seconds register also clears the voltage low flag
+	_, err := p.bus.WriteBytes([]byte{
+		pcf8563SECONDS,
+		binToBcd(t.Second()),
+		binToBcd(t.Minute()),
+		binToBcd(t.Hour()),
+		binToBcd(t.Day()),
+		byte(t.Weekday()),
+		month,
+		binToBcd(t.Year() % 100),
+	})
+	if err != nil {
+		return fmt.Errorf("write PCF8563 time: %w", err)
+	}
+	return nil
+}
+
+func (p *PCF8563) Close() error {
+	return p.bus.Close()
+}
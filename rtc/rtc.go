@@ -0,0 +1,41 @@
+// Package rtc reads and writes the battery backed real time clocks that are
+// commonly attached to a Raspberry Pi over I2C.
+package rtc
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTimeInvalid is returned when the clock reports that its oscillator stopped
+// or its backup voltage dropped, so the stored time can not be trusted.
+var ErrTimeInvalid = errors.New("rtc time is invalid")
+
+// Clock is implemented by every supported RTC chip. Times are kept in UTC.
+type Clock interface {
+	ReadTime() (time.Time, error)
+	SetTime(t time.Time) error
+	Close() error
+}
+
+// Bus is the I2C wire of a clock, *i2c.I2C in the field.
+type Bus interface {
+	ReadRegU8(reg byte) (byte, error)
+	WriteRegU8(reg byte, value byte) error
+	ReadRegBytes(reg byte, n int) ([]byte, int, error)
+	WriteBytes(buf []byte) (int, error)
+	Close() error
+}
+
+// Thermometer is implemented by clocks with a built-in temperature sensor.
+type Thermometer interface {
+	Temperature() (float32, error)
+}
+
+func bcdToBin(v byte) int {
+	return int(v>>4)*10 + int(v&0x0F)
+}
+
+func binToBcd(v int) byte {
+	return byte(v/10)<<4 | byte(v%10)
+}
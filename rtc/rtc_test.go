@@ -0,0 +1,164 @@
+package rtc
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBcd(t *testing.T) {
+	tests := []struct {
+		name string
+		bin  int
+		bcd  byte
+	}{
+		{name: "0", bin: 0, bcd: 0x00},
+		{name: "9", bin: 9, bcd: 0x09},
+		{name: "10", bin: 10, bcd: 0x10},
+		{name: "59", bin: 59, bcd: 0x59},
+		{name: "99", bin: 99, bcd: 0x99},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := binToBcd(tt.bin); got != tt.bcd {
+				t.Errorf("binToBcd() = %#x, want %#x", got, tt.bcd)
+			}
+			if got := bcdToBin(tt.bcd); got != tt.bin {
+				t.Errorf("bcdToBin() = %v, want %v", got, tt.bin)
+			}
+		})
+	}
+}
+
+// fakeBus is a register file, a write or read walks the registers from the
+// one addressed
+type fakeBus struct {
+	regs [256]byte
+}
+
+func (b *fakeBus) ReadRegU8(reg byte) (byte, error) {
+	return b.regs[reg], nil
+}
+
+func (b *fakeBus) WriteRegU8(reg byte, value byte) error {
+	b.regs[reg] = value
+	return nil
+}
+
+func (b *fakeBus) ReadRegBytes(reg byte, n int) ([]byte, int, error) {
+	buf := make([]byte, n)
+	copy(buf, b.regs[reg:])
+	return buf, n, nil
+}
+
+func (b *fakeBus) WriteBytes(buf []byte) (int, error) {
+	copy(b.regs[buf[0]:], buf[1:])
+	return len(buf), nil
+}
+
+func (b *fakeBus) Close() error {
+	return nil
+}
+
+func TestDS3231(t *testing.T) {
+	tests := []struct {
+		name string
+		time time.Time
+		regs []byte
+	}{
+		{name: "leap day", time: time.Date(2024, 2, 29, 13, 45, 7, 0, time.UTC), regs: []byte{0x07, 0x45, 0x13, 0x05, 0x29, 0x02, 0x24}},
+		{name: "new year", time: time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC), regs: []byte{0x59, 0x59, 0x23, 0x05, 0x31, 0x12, 0x99}},
+		{name: "next century", time: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC), regs: []byte{0x00, 0x00, 0x00, 0x06, 0x01, 0x81, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := &fakeBus{}
+			bus.regs[ds3231STATUS] = ds3231StatusOSF
+			clock, err := NewDS3231(bus)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = clock.ReadTime(); !errors.Is(err, ErrTimeInvalid) {
+				t.Fatalf("ReadTime() with OSF error = %v, want %v", err, ErrTimeInvalid)
+			}
+			if err = clock.SetTime(tt.time.In(time.FixedZone("CEST", 2*60*60))); err != nil {
+				t.Fatal(err)
+			}
+			if got := bus.regs[ds3231SECONDS : ds3231SECONDS+7]; !bytes.Equal(got, tt.regs) {
+				t.Errorf("time registers = % x, want % x", got, tt.regs)
+			}
+			if bus.regs[ds3231STATUS]&ds3231StatusOSF != 0 {
+				t.Error("SetTime() left OSF set")
+			}
+			if got, err := clock.ReadTime(); err != nil || !got.Equal(tt.time) {
+				t.Errorf("ReadTime() = %v, %v, want %v", got, err, tt.time)
+			}
+		})
+	}
+}
+
+func TestDS3231Registers(t *testing.T) {
+	bus := &fakeBus{}
+	clock, err := NewDS3231(bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 12 hour mode, 1 PM
+	copy(bus.regs[ds3231SECONDS:], []byte{0x30, 0x15, ds3231Hour12 | ds3231HourPM | 0x01, 0x02, 0x10, 0x06, 0x25})
+	want := time.Date(2025, 6, 10, 13, 15, 30, 0, time.UTC)
+	if got, err := clock.ReadTime(); err != nil || !got.Equal(want) {
+		t.Errorf("ReadTime() 12 hour = %v, %v, want %v", got, err, want)
+	}
+	tests := []struct {
+		name string
+		msb  byte
+		lsb  byte
+		want float32
+	}{
+		{name: "warm", msb: 0x19, lsb: 0x40, want: 25.25},
+		{name: "below zero", msb: 0xF6, lsb: 0x80, want: -9.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus.regs[ds3231TEMPMSB], bus.regs[ds3231TEMPMSB+1] = tt.msb, tt.lsb
+			if got, err := clock.Temperature(); err != nil || got != tt.want {
+				t.Errorf("Temperature() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPCF8563(t *testing.T) {
+	tests := []struct {
+		name string
+		time time.Time
+		regs []byte
+	}{
+		{name: "leap day", time: time.Date(2024, 2, 29, 13, 45, 7, 0, time.UTC), regs: []byte{0x07, 0x45, 0x13, 0x29, 0x04, 0x02, 0x24}},
+		{name: "sunday", time: time.Date(2023, 10, 1, 8, 0, 0, 0, time.UTC), regs: []byte{0x00, 0x00, 0x08, 0x01, 0x00, 0x10, 0x23}},
+		{name: "next century", time: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC), regs: []byte{0x00, 0x00, 0x00, 0x01, 0x05, 0x81, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := &fakeBus{}
+			bus.regs[pcf8563SECONDS] = pcf8563VoltageLow
+			clock, err := NewPCF8563(bus)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = clock.ReadTime(); !errors.Is(err, ErrTimeInvalid) {
+				t.Fatalf("ReadTime() with low voltage error = %v, want %v", err, ErrTimeInvalid)
+			}
+			if err = clock.SetTime(tt.time); err != nil {
+				t.Fatal(err)
+			}
+			if got := bus.regs[pcf8563SECONDS : pcf8563SECONDS+7]; !bytes.Equal(got, tt.regs) {
+				t.Errorf("time registers = % x, want % x", got, tt.regs)
+			}
+			if got, err := clock.ReadTime(); err != nil || !got.Equal(tt.time) {
+				t.Errorf("ReadTime() = %v, %v, want %v", got, err, tt.time)
+			}
+		})
+	}
+}
@@ -47,26 +47,50 @@ const (
 	SwitchCAPVCC VccMode = 0x2
 )
 
+type packet struct {
+	isData bool
+	data   []byte
+}
+
 type DataBuilder struct {
-	data [][]byte
+	data []packet
 }
 
 func (b *DataBuilder) WriteCmd(cmd ...byte) *DataBuilder {
 	for _, c := range cmd {
-		b.data = append(b.data, []byte{0x00, c})
+		b.data = append(b.data, packet{data: []byte{c}})
 	}
 	return b
 }
 
 func (b *DataBuilder) WriteData(data []byte) *DataBuilder {
-	data = append([]byte{0x40}, data...)
-	b.data = append(b.data, data)
+	b.data = append(b.data, packet{isData: true, data: data})
 	return b
 }
 
-// Device wraps an SPI connection.
+// Transport sends commands and display data to the panel.
+type Transport interface {
+	WriteCmd(cmd []byte) error
+	WriteData(data []byte) error
+	Close() error
+}
+
+// hardResetter is implemented by transports wired to the panel reset line.
+type hardResetter interface {
+	HardReset() error
+}
+
+// Controller selects the panel controller, they differ in the column offset.
+type Controller uint8
+
+const (
+	SH1106  Controller = 0x0
+	SSD1306 Controller = 0x1
+)
+
+// Device wraps an I2C or SPI connection.
 type Device struct {
-	bus          *i2c.I2C
+	bus          Transport
 	buffer       []byte
 	width        int16
 	height       int16
@@ -75,20 +99,42 @@ type Device struct {
 	lock         sync.Mutex
 	updatedPages int64
 	invert       bool
+	columnOffset uint8
+	contrast     uint8
 }
 
 // Config is the configuration for the display
 type Config struct {
-	Width    int16
-	Height   int16
-	VccState VccMode
-	Invert   bool
+	Width      int16
+	Height     int16
+	VccState   VccMode
+	Invert     bool
+	Controller Controller
+	// Contrast 0 keeps the default of the panel size
+	Contrast uint8
 }
 
 type VccMode uint8
 
 // NewI2C creates a new SSD1306 connection. The I2C wire must already be configured.
 func NewI2C(bus *i2c.I2C, cfg Config) (d *Device, err error) {
+	d = OpenI2C(bus, cfg)
+	err = d.Reset()
+	if err != nil {
+		return nil, fmt.Errorf("reset SH1106 occur error: %w", err)
+	}
+	return d, nil
+}
+
+// OpenI2C creates a new SSD1306 connection without touching the panel,
+// Reset must succeed before anything is shown.
+func OpenI2C(bus *i2c.I2C, cfg Config) (d *Device) {
+	return Open(&i2cTransport{bus: bus}, cfg)
+}
+
+// Open creates a device on top of any transport without touching the panel,
+// Reset must succeed before anything is shown.
+func Open(bus Transport, cfg Config) (d *Device) {
 	d = new(Device)
 	if cfg.Width != 0 {
 		d.width = cfg.Width
@@ -102,6 +148,11 @@ func NewI2C(bus *i2c.I2C, cfg Config) (d *Device, err error) {
 	}
 	d.bus = bus
 	d.invert = cfg.Invert
+	d.contrast = cfg.Contrast
+	if cfg.Controller == SH1106 {
+		// SH1106 has 132 columns of RAM, the visible 128 start at column 2
+		d.columnOffset = 2
+	}
 	if cfg.VccState != 0 {
 		d.vccState = cfg.VccState
 	} else {
@@ -109,12 +160,7 @@ func NewI2C(bus *i2c.I2C, cfg Config) (d *Device, err error) {
 	}
 	d.bufferSize = d.width * d.height / 8
 	d.buffer = make([]byte, d.bufferSize)
-
-	err = d.Reset()
-	if err != nil {
-		return nil, fmt.Errorf("reset SH1106 occur error: %w", err)
-	}
-	return d, nil
+	return d
 }
 
 func (d *Device) checkAndInvertPos(x, y *int16) {
@@ -125,6 +171,11 @@ func (d *Device) checkAndInvertPos(x, y *int16) {
 }
 
 func (d *Device) Reset() error {
+	if r, ok := d.bus.(hardResetter); ok {
+		if err := r.HardReset(); err != nil {
+			return err
+		}
+	}
 	err := d.tx(func(builder *DataBuilder) error {
 		builder.WriteCmd(DISPLAYOFF)
 		builder.WriteCmd(SETDISPLAYCLOCKDIV)
@@ -148,30 +199,18 @@ func (d *Device) Reset() error {
 		if (d.width == 128 && d.height == 64) || (d.width == 64 && d.height == 48) { // 128x64 or 64x48
 			builder.WriteCmd(SETCOMPINS)
 			builder.WriteCmd(0x12)
-			builder.WriteCmd(SETCONTRAST)
-			if d.vccState == ExternalVCC {
-				builder.WriteCmd(0x9F)
-			} else {
-				builder.WriteCmd(0xCF)
-			}
 		} else if d.width == 128 && d.height == 32 { // 128x32
 			builder.WriteCmd(SETCOMPINS)
 			builder.WriteCmd(0x02)
-			builder.WriteCmd(SETCONTRAST)
-			builder.WriteCmd(0x8F)
 		} else if d.width == 96 && d.height == 16 { // 96x16
 			builder.WriteCmd(SETCOMPINS)
 			builder.WriteCmd(0x2)
-			builder.WriteCmd(SETCONTRAST)
-			if d.vccState == ExternalVCC {
-				builder.WriteCmd(0x10)
-			} else {
-				builder.WriteCmd(0xAF)
-			}
 		} else {
 			// fail silently, it might work
 			return errors.New("there's no configuration for this display's size")
 		}
+		builder.WriteCmd(SETCONTRAST)
+		builder.WriteCmd(d.currentContrast())
 
 		builder.WriteCmd(SETPRECHARGE)
 		if d.vccState == ExternalVCC {
@@ -194,6 +233,46 @@ func (d *Device) Reset() error {
 	return err
 }
 
+// currentContrast is the configured contrast or the default for the panel size
+func (d *Device) currentContrast() uint8 {
+	d.lock.Lock()
+	contrast := d.contrast
+	d.lock.Unlock()
+	if contrast != 0 {
+		return contrast
+	}
+	switch {
+	case d.width == 128 && d.height == 32:
+		return 0x8F
+	case d.width == 96 && d.height == 16 && d.vccState == ExternalVCC:
+		return 0x10
+	case d.width == 96 && d.height == 16:
+		return 0xAF
+	case d.vccState == ExternalVCC:
+		return 0x9F
+	default:
+		return 0xCF
+	}
+}
+
+// Contrast returns the contrast sent to the panel
+func (d *Device) Contrast() uint8 {
+	return d.currentContrast()
+}
+
+// SetContrast changes the contrast right away, 0 restores the default
+func (d *Device) SetContrast(contrast uint8) error {
+	// Reset reads it from the display probe
+	d.lock.Lock()
+	d.contrast = contrast
+	d.lock.Unlock()
+	return d.tx(func(builder *DataBuilder) error {
+		builder.WriteCmd(SETCONTRAST)
+		builder.WriteCmd(d.currentContrast())
+		return nil
+	})
+}
+
 // ClearBuffer clears the image buffer
 func (d *Device) ClearBuffer() {
 	for i := int16(0); i < d.bufferSize; i++ {
@@ -225,8 +304,8 @@ func (d *Device) Display(full bool) (err error) {
 				continue
 			}
 			builder.WriteCmd(0xB0 | (pg & 0x07)) // SET_PAGE_ADDR
-			builder.WriteCmd(SETLOWCOLUMN | 2)
-			builder.WriteCmd(SETHIGHCOLUMN | 0)
+			builder.WriteCmd(SETLOWCOLUMN | (d.columnOffset & 0x0F))
+			builder.WriteCmd(SETHIGHCOLUMN | (d.columnOffset >> 4))
 			builder.WriteData(d.buffer[uint16(pg)*0x80 : uint16(pg+1)*0x80])
 		}
 		d.updatedPages = 0
@@ -301,8 +380,12 @@ func (d *Device) tx(call func(builder *DataBuilder) error) (err error) {
 	if err == nil {
 		d.lock.Lock()
 		defer d.lock.Unlock()
-		for _, data := range builder.data {
-			_, err = d.bus.WriteBytes(data)
+		for _, p := range builder.data {
+			if p.isData {
+				err = d.bus.WriteData(p.data)
+			} else {
+				err = d.bus.WriteCmd(p.data)
+			}
 			if err != nil {
 				return err
 			}
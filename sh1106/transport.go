@@ -0,0 +1,92 @@
+package sh1106
+
+import (
+	"errors"
+	"fmt"
+	"picp/go-i2c"
+	"picp/go-spi"
+	"picp/gpio"
+	"time"
+)
+
+// i2cTransport prefixes every message with the control byte selecting
+// between command and data.
+type i2cTransport struct {
+	bus *i2c.I2C
+}
+
+func (t *i2cTransport) WriteCmd(cmd []byte) error {
+	_, err := t.bus.WriteBytes(append([]byte{0x00}, cmd...))
+	return err
+}
+
+func (t *i2cTransport) WriteData(data []byte) error {
+	_, err := t.bus.WriteBytes(append([]byte{0x40}, data...))
+	return err
+}
+
+func (t *i2cTransport) Close() error {
+	return t.bus.Close()
+}
+
+// spiTransport selects between command and data with the DC line
+// and drives the optional RST line.
+type spiTransport struct {
+	conn *spi.SPI
+	dc   gpio.Line
+	rst  gpio.Line
+}
+
+// OpenSPI creates a new connection over a 4-wire SPI bus without touching the
+// panel. rstPin may be negative when the reset line is not wired.
+func OpenSPI(conn *spi.SPI, dcPin, rstPin int, cfg Config) (*Device, error) {
+	t := &spiTransport{conn: conn}
+	var err error
+	t.dc, err = gpio.Request(dcPin, gpio.Config{Output: true})
+	if err != nil {
+		return nil, fmt.Errorf("dc pin: %w", err)
+	}
+	if rstPin >= 0 {
+		t.rst, err = gpio.Request(rstPin, gpio.Config{Output: true, Value: true})
+		if err != nil {
+			_ = t.dc.Close()
+			return nil, fmt.Errorf("rst pin: %w", err)
+		}
+	}
+	return Open(t, cfg), nil
+}
+
+func (t *spiTransport) WriteCmd(cmd []byte) error {
+	if err := t.dc.Set(false); err != nil {
+		return err
+	}
+	return t.conn.Write(cmd)
+}
+
+func (t *spiTransport) WriteData(data []byte) error {
+	if err := t.dc.Set(true); err != nil {
+		return err
+	}
+	return t.conn.Write(data)
+}
+
+func (t *spiTransport) HardReset() error {
+	if t.rst == nil {
+		return nil
+	}
+	if err := t.rst.Set(false); err != nil {
+		return err
+	}
+	time.Sleep(10 * time.Millisecond)
+	err := t.rst.Set(true)
+	time.Sleep(10 * time.Millisecond)
+	return err
+}
+
+func (t *spiTransport) Close() error {
+	err := t.dc.Close()
+	if t.rst != nil {
+		err = errors.Join(err, t.rst.Close())
+	}
+	return errors.Join(err, t.conn.Close())
+}
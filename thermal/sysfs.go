@@ -0,0 +1,186 @@
+package thermal
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var sysClass = "/sys/class"
+
+var hwmonInputPattern = regexp.MustCompile(`^temp\d+$`)
+
+// Info describes a source found by List.
+type Info struct {
+	Spec string `json:"spec"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Zone reads a thermal zone matched by its directory name or type.
+type Zone struct {
+	name string
+}
+
+func (z *Zone) Temperature() (float32, error) {
+	zones, _ := filepath.Glob(filepath.Join(sysClass, "thermal", "thermal_zone*"))
+	for _, zone := range zones {
+		if filepath.Base(zone) == z.name || readString(filepath.Join(zone, "type")) == z.name {
+			return readMilli(filepath.Join(zone, "temp"))
+		}
+	}
+	return 0, fmt.Errorf("thermal zone %s not found", z.name)
+}
+
+func (z *Zone) String() string {
+	return "zone:" + z.name
+}
+
+// Hwmon reads a temperature input of a hwmon chip matched by name.
+type Hwmon struct {
+	chip  string
+	input string
+}
+
+func (h *Hwmon) Temperature() (float32, error) {
+	for _, dir := range hwmonDirs() {
+		if readString(filepath.Join(dir, "name")) != h.chip {
+			continue
+		}
+		input, err := hwmonInput(dir, h.input)
+		if err != nil {
+			return 0, err
+		}
+		return readMilli(filepath.Join(dir, input+"_input"))
+	}
+	return 0, fmt.Errorf("hwmon chip %s not found", h.chip)
+}
+
+func (h *Hwmon) String() string {
+	if h.input == "" {
+		return "hwmon:" + h.chip
+	}
+	return "hwmon:" + h.chip + "/" + h.input
+}
+
+// NVMe reads the composite temperature of a drive, the first one found if
+// no controller is given.
+type NVMe struct {
+	controller string
+}
+
+func (n *NVMe) Temperature() (float32, error) {
+	if n.controller == "" {
+		for _, dir := range hwmonDirs() {
+			if readString(filepath.Join(dir, "name")) == "nvme" {
+				return readMilli(filepath.Join(dir, "temp1_input"))
+			}
+		}
+		return 0, fmt.Errorf("no nvme drive found")
+	}
+	// newer kernels register the hwmon device under the controller, older
+	// ones under its pci device
+	controller := filepath.Join(sysClass, "nvme", n.controller)
+	for _, pattern := range []string{"hwmon*", "device/hwmon/hwmon*"} {
+		matches, _ := filepath.Glob(filepath.Join(controller, pattern))
+		if len(matches) > 0 {
+			return readMilli(filepath.Join(matches[0], "temp1_input"))
+		}
+	}
+	return 0, fmt.Errorf("nvme %s not found", n.controller)
+}
+
+func (n *NVMe) String() string {
+	if n.controller == "" {
+		return "nvme"
+	}
+	return "nvme:" + n.controller
+}
+
+// List returns the thermal zones, hwmon inputs and NVMe drives present.
+func List() []Info {
+	var ret []Info
+	zones, _ := filepath.Glob(filepath.Join(sysClass, "thermal", "thermal_zone*"))
+	sort.Strings(zones)
+	for _, zone := range zones {
+		source := &Zone{name: filepath.Base(zone)}
+		ret = append(ret, Info{Spec: source.String(), Name: readString(filepath.Join(zone, "type")), Type: "thermal_zone"})
+	}
+	for _, dir := range hwmonDirs() {
+		chip := readString(filepath.Join(dir, "name"))
+		// nvme drives are listed by controller below
+		if chip == "" || chip == "nvme" {
+			continue
+		}
+		inputs, _ := filepath.Glob(filepath.Join(dir, "temp*_input"))
+		sort.Strings(inputs)
+		for _, input := range inputs {
+			name := strings.TrimSuffix(filepath.Base(input), "_input")
+			source := &Hwmon{chip: chip, input: name}
+			if label := readString(filepath.Join(dir, name+"_label")); label != "" {
+				name = label
+			}
+			ret = append(ret, Info{Spec: source.String(), Name: chip + " " + name, Type: "hwmon"})
+		}
+	}
+	controllers, _ := filepath.Glob(filepath.Join(sysClass, "nvme", "nvme*"))
+	sort.Strings(controllers)
+	for _, controller := range controllers {
+		source := &NVMe{controller: filepath.Base(controller)}
+		name := readString(filepath.Join(controller, "model"))
+		if name == "" {
+			name = source.controller
+		}
+		ret = append(ret, Info{Spec: source.String(), Name: name, Type: "nvme"})
+	}
+	return ret
+}
+
+func hwmonDirs() []string {
+	dirs, _ := filepath.Glob(filepath.Join(sysClass, "hwmon", "hwmon*"))
+	sort.Strings(dirs)
+	return dirs
+}
+
+// hwmonInput resolves an input given as tempN or by its label
+func hwmonInput(dir, input string) (string, error) {
+	if input == "" {
+		return "temp1", nil
+	}
+	if hwmonInputPattern.MatchString(input) {
+		return input, nil
+	}
+	labels, _ := filepath.Glob(filepath.Join(dir, "temp*_label"))
+	for _, label := range labels {
+		if readString(label) == input {
+			return strings.TrimSuffix(filepath.Base(label), "_label"), nil
+		}
+	}
+	return "", fmt.Errorf("hwmon input %s not found in %s", input, readString(filepath.Join(dir, "name")))
+}
+
+func readString(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return string(bytes.TrimSpace(data))
+}
+
+// readMilli reads a value in millidegrees Celsius
+func readMilli(path string) (float32, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("read temperature: %w", err)
+	}
+	value, err := strconv.Atoi(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return 0, fmt.Errorf("convert temperature %s: %w", path, err)
+	}
+	return float32(value) / 1000, nil
+}
@@ -0,0 +1,238 @@
+// Package thermal reads temperatures from the kernel thermal and hwmon
+// interfaces or from external commands, and combines them.
+//
+// A source is described by a spec string:
+//
+//	cpu                    thermal_zone0, the SoC sensor of a Raspberry Pi
+//	zone:<name or type>    a thermal zone, e.g. zone:thermal_zone1 or zone:cpu-thermal
+//	hwmon:<chip>[/<input>] a hwmon chip by name, input is tempN or its label (default temp1)
+//	nvme[:<controller>]    composite temperature of an NVMe drive, e.g. nvme:nvme0
+//	cmd:<command>          first number printed by a shell command, in degrees Celsius
+//	max(<spec>,<spec>...)  hottest of the sources that could be read
+//	avg(<spec>,<spec>...)  average of the sources that could be read
+package thermal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AggregateMax = "max"
+	AggregateAvg = "avg"
+)
+
+// commandTimeout bounds how long a cmd: source may run
+const commandTimeout = 5 * time.Second
+
+var ErrNoSource = errors.New("no temperature source could be read")
+
+// commandCache keeps the result of each cmd: source for ttl, the sources are
+// read on every fan tick and status refresh
+var commandCache = struct {
+	sync.Mutex
+	ttl     time.Duration
+	results map[string]commandResult
+}{ttl: 5 * time.Second, results: map[string]commandResult{}}
+
+type commandResult struct {
+	time        time.Time
+	temperature float32
+	err         error
+}
+
+// SetCommandCache sets how long the result of a cmd: source is reused, 0
+// runs the command on every read.
+func SetCommandCache(ttl time.Duration) {
+	commandCache.Lock()
+	defer commandCache.Unlock()
+	commandCache.ttl = ttl
+	clear(commandCache.results)
+}
+
+// Source is a temperature reading in degrees Celsius.
+type Source interface {
+	Temperature() (float32, error)
+	String() string
+}
+
+// Resolver builds sources for kinds not handled by this package, like w1.
+type Resolver func(kind, arg string) (Source, error)
+
+// Parse builds a source from its spec, ext may be nil.
+func Parse(spec string, ext Resolver) (Source, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "cpu" {
+		return &Zone{name: "thermal_zone0"}, nil
+	}
+	if spec == "nvme" {
+		return &NVMe{}, nil
+	}
+	for _, mode := range []string{AggregateMax, AggregateAvg} {
+		if args, ok := strings.CutPrefix(spec, mode+"("); ok {
+			if !strings.HasSuffix(args, ")") {
+				return nil, fmt.Errorf("missing ) in temperature source %q", spec)
+			}
+			return parseAggregate(mode, args[:len(args)-1], ext)
+		}
+	}
+	kind, arg, ok := strings.Cut(spec, ":")
+	if !ok || arg == "" {
+		return nil, fmt.Errorf("invalid temperature source %q", spec)
+	}
+	switch kind {
+	case "zone":
+		return &Zone{name: arg}, nil
+	case "hwmon":
+		chip, input, _ := strings.Cut(arg, "/")
+		return &Hwmon{chip: chip, input: input}, nil
+	case "nvme":
+		return &NVMe{controller: arg}, nil
+	case "cmd":
+		return &Command{command: arg}, nil
+	}
+	if ext != nil {
+		return ext(kind, arg)
+	}
+	return nil, fmt.Errorf("unknown temperature source %q", spec)
+}
+
+// Check validates the syntax of a spec, kinds lists the extra kinds
+// accepted in place of a Resolver.
+func Check(spec string, kinds ...string) error {
+	_, err := Parse(spec, func(kind, arg string) (Source, error) {
+		for _, k := range kinds {
+			if k == kind {
+				return &Command{}, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown temperature source %s:%s", kind, arg)
+	})
+	return err
+}
+
+func parseAggregate(mode, args string, ext Resolver) (Source, error) {
+	aggregate := &Aggregate{mode: mode}
+	for _, item := range splitArgs(args) {
+		source, err := Parse(item, ext)
+		if err != nil {
+			return nil, err
+		}
+		aggregate.sources = append(aggregate.sources, source)
+	}
+	if len(aggregate.sources) == 0 {
+		return nil, fmt.Errorf("%s() needs at least one temperature source", mode)
+	}
+	return aggregate, nil
+}
+
+// splitArgs splits on commas outside of parentheses
+func splitArgs(value string) []string {
+	var ret []string
+	depth, start := 0, 0
+	for i, c := range value {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				ret = append(ret, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if strings.TrimSpace(value[start:]) != "" {
+		ret = append(ret, value[start:])
+	}
+	return ret
+}
+
+// Aggregate combines several sources, failing ones are skipped so a missing
+// drive does not stop the others from being used.
+type Aggregate struct {
+	mode    string
+	sources []Source
+}
+
+func (a *Aggregate) Temperature() (float32, error) {
+	var sum, hottest float32
+	var count int
+	var errs []error
+	for _, source := range a.sources {
+		temperature, err := source.Temperature()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if count == 0 || temperature > hottest {
+			hottest = temperature
+		}
+		sum += temperature
+		count++
+	}
+	if count == 0 {
+		return 0, errors.Join(append([]error{ErrNoSource}, errs...)...)
+	}
+	if a.mode == AggregateAvg {
+		return sum / float32(count), nil
+	}
+	return hottest, nil
+}
+
+func (a *Aggregate) String() string {
+	items := make([]string, 0, len(a.sources))
+	for _, source := range a.sources {
+		items = append(items, source.String())
+	}
+	return a.mode + "(" + strings.Join(items, ",") + ")"
+}
+
+// Command runs a shell command and parses the first field of its output.
+type Command struct {
+	command string
+}
+
+// Temperature returns the cached result while it is fresh, concurrent reads
+// of a stale result wait for one run of the command
+func (c *Command) Temperature() (float32, error) {
+	commandCache.Lock()
+	defer commandCache.Unlock()
+	if result, ok := commandCache.results[c.command]; ok && time.Since(result.time) < commandCache.ttl {
+		return result.temperature, result.err
+	}
+	temperature, err := c.run()
+	if commandCache.ttl > 0 {
+		commandCache.results[c.command] = commandResult{time: time.Now(), temperature: temperature, err: err}
+	}
+	return temperature, err
+}
+
+func (c *Command) run() (float32, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "/bin/sh", "-c", c.command).Output()
+	if err != nil {
+		return 0, fmt.Errorf("run %q: %w", c.command, err)
+	}
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("command %q printed nothing", c.command)
+	}
+	value, err := strconv.ParseFloat(strings.TrimSuffix(fields[0], "°C"), 32)
+	if err != nil {
+		return 0, fmt.Errorf("convert %q output: %w", c.command, err)
+	}
+	return float32(value), nil
+}
+
+func (c *Command) String() string {
+	return "cmd:" + c.command
+}
@@ -0,0 +1,138 @@
+package thermal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSources(t *testing.T) {
+	root := sysClass
+	t.Cleanup(func() {
+		sysClass = root
+	})
+	sysClass = t.TempDir()
+	writeFile(t, filepath.Join(sysClass, "thermal/thermal_zone0/type"), "cpu-thermal\n")
+	writeFile(t, filepath.Join(sysClass, "thermal/thermal_zone0/temp"), "48312\n")
+	writeFile(t, filepath.Join(sysClass, "hwmon/hwmon0/name"), "rp1_adc\n")
+	writeFile(t, filepath.Join(sysClass, "hwmon/hwmon0/temp1_input"), "40000\n")
+	writeFile(t, filepath.Join(sysClass, "hwmon/hwmon0/temp2_input"), "41500\n")
+	writeFile(t, filepath.Join(sysClass, "hwmon/hwmon0/temp2_label"), "board\n")
+	writeFile(t, filepath.Join(sysClass, "hwmon/hwmon1/name"), "nvme\n")
+	writeFile(t, filepath.Join(sysClass, "hwmon/hwmon1/temp1_input"), "55850\n")
+	writeFile(t, filepath.Join(sysClass, "nvme/nvme0/hwmon1/temp1_input"), "55850\n")
+	tests := []struct {
+		spec     string
+		wantSpec string
+		want     float32
+		wantErr  bool
+	}{
+		{spec: "cpu", wantSpec: "zone:thermal_zone0", want: 48.312},
+		{spec: "zone:cpu-thermal", want: 48.312},
+		{spec: "zone:thermal_zone0", want: 48.312},
+		{spec: "zone:gpu", wantErr: true},
+		{spec: "hwmon:rp1_adc", want: 40},
+		{spec: "hwmon:rp1_adc/board", want: 41.5},
+		{spec: "hwmon:rp1_adc/temp9", wantErr: true},
+		{spec: "nvme", want: 55.85},
+		{spec: "nvme:nvme0", want: 55.85},
+		{spec: "nvme:nvme1", wantErr: true},
+		{spec: "cmd:echo 42.5", want: 42.5},
+		{spec: "max(zone:cpu-thermal,nvme,zone:gpu)", want: 55.85},
+		{spec: "avg(hwmon:rp1_adc,max(zone:cpu-thermal,hwmon:rp1_adc/board))", want: 44.156},
+		{spec: "max(zone:gpu)", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			source, err := Parse(tt.spec, nil)
+			if err != nil {
+				t.Fatal("Parse", err)
+			}
+			wantSpec := tt.wantSpec
+			if wantSpec == "" {
+				wantSpec = tt.spec
+			}
+			if source.String() != wantSpec {
+				t.Errorf("String() = %s, want %s", source.String(), wantSpec)
+			}
+			got, err := source.Temperature()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Temperature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Temperature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{spec: ""},
+		{spec: "w1:intake"},
+		{spec: "max(cpu,w1:intake)"},
+		{spec: "max(cpu", wantErr: true},
+		{spec: "avg()", wantErr: true},
+		{spec: "gpu", wantErr: true},
+		{spec: "foo:bar", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			if err := Check(tt.spec, "w1"); (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCommandCache(t *testing.T) {
+	t.Cleanup(func() {
+		SetCommandCache(5 * time.Second)
+	})
+	runs := filepath.Join(t.TempDir(), "runs")
+	source, err := Parse("cmd:echo run >> "+runs+"; echo 40", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		want int
+	}{
+		{name: "first read", ttl: time.Minute, want: 1},
+		{name: "cached", ttl: -1, want: 1},
+		{name: "no cache", ttl: 0, want: 2},
+		{name: "no cache again", ttl: -1, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.ttl >= 0 {
+				SetCommandCache(tt.ttl)
+			}
+			if got, err := source.Temperature(); got != 40 || err != nil {
+				t.Fatalf("Temperature() = %v, %v", got, err)
+			}
+			data, err := os.ReadFile(runs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Count(string(data), "run"); got != tt.want {
+				t.Errorf("command ran %d times, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package ups
+
+import (
+	"fmt"
+	"picp/go-i2c"
+)
+
+// INA219 registers
+const (
+	ina219CONFIG       = 0x00
+	ina219SHUNTVOLTAGE = 0x01
+	ina219BUSVOLTAGE   = 0x02
+
+	// 32V bus range, 320mV shunt range, 12-bit, continuous conversion
+	ina219DefaultConfig = 0x399F
+)
+
+// INA219Config describes the battery pack behind an INA219 power monitor.
+type INA219Config struct {
+	ShuntOhms     float32
+	MinVoltage    float32
+	MaxVoltage    float32
+	InvertCurrent bool
+}
+
+// INA219 is a current/voltage monitor. The state of charge is estimated
+// linearly between MinVoltage and MaxVoltage.
+type INA219 struct {
+	bus *i2c.I2C
+	cfg INA219Config
+}
+
+// NewINA219 creates an INA219 power monitor. The I2C wire must already be configured.
+func NewINA219(bus *i2c.I2C, cfg INA219Config) (*INA219, error) {
+	if cfg.ShuntOhms <= 0 {
+		return nil, fmt.Errorf("invalid INA219 shunt resistance %f", cfg.ShuntOhms)
+	}
+	if cfg.MaxVoltage <= cfg.MinVoltage {
+		return nil, fmt.Errorf("invalid INA219 voltage range %f-%f", cfg.MinVoltage, cfg.MaxVoltage)
+	}
+	if err := bus.WriteRegU16BE(ina219CONFIG, ina219DefaultConfig); err != nil {
+		return nil, fmt.Errorf("write INA219 config: %w", err)
+	}
+	return &INA219{bus: bus, cfg: cfg}, nil
+}
+
+func (n *INA219) Read() (*Status, error) {
+	rawBus, err := n.bus.ReadRegU16BE(ina219BUSVOLTAGE)
+	if err != nil {
+		return nil, fmt.Errorf("read INA219 bus voltage: %w", err)
+	}
+	rawShunt, err := n.bus.ReadRegS16BE(ina219SHUNTVOLTAGE)
+	if err != nil {
+		return nil, fmt.Errorf("read INA219 shunt voltage: %w", err)
+	}
+	// bus voltage: 4mV per LSB starting at bit 3, shunt voltage: 10µV per LSB
+	voltage := float32(rawBus>>3) * 4 / 1000
+	current := float32(rawShunt) * 10 / 1000000 / n.cfg.ShuntOhms
+	if n.cfg.InvertCurrent {
+		current = -current
+	}
+	return &Status{
+		Percent:  clampPercent((voltage - n.cfg.MinVoltage) / (n.cfg.MaxVoltage - n.cfg.MinVoltage) * 100),
+		Voltage:  voltage,
+		Current:  current,
+		Charging: current > 0,
+	}, nil
+}
+
+func (n *INA219) Close() error {
+	return closeBus(n.bus)
+}
@@ -0,0 +1,103 @@
+package ups
+
+import (
+	"fmt"
+	"picp/go-i2c"
+)
+
+// MAX1704x registers
+const (
+	max1704xVCELL   = 0x02
+	max1704xSOC     = 0x04
+	max1704xVERSION = 0x08
+	max17048CRATE   = 0x16
+)
+
+// the MAX17040 has no charge rate register, it counts as charging while the
+// newer half of the last voltageWindow samples averages chargeRise volts above
+// the older half, single samples differ by a few LSB of noise
+const (
+	voltageWindow = 8
+	chargeRise    = 0.02
+)
+
+// voltageTrend tells a charging cell from the voltage samples
+type voltageTrend struct {
+	samples []float32
+}
+
+func (t *voltageTrend) add(voltage float32) bool {
+	t.samples = append(t.samples, voltage)
+	if len(t.samples) > voltageWindow {
+		t.samples = t.samples[1:]
+	}
+	if len(t.samples) < voltageWindow {
+		return false
+	}
+	half := voltageWindow / 2
+	var older, newer float32
+	for i, sample := range t.samples {
+		if i < half {
+			older += sample
+		} else {
+			newer += sample
+		}
+	}
+	return (newer-older)/float32(half) >= chargeRise
+}
+
+// MAX1704x is a MAX17040/MAX17048 fuel gauge.
+type MAX1704x struct {
+	bus     *i2c.I2C
+	is17048 bool
+	trend   voltageTrend
+}
+
+// NewMAX17040 creates a MAX17040 fuel gauge. The I2C wire must already be configured.
+func NewMAX17040(bus *i2c.I2C) (*MAX1704x, error) {
+	return newMAX1704x(bus, false)
+}
+
+// NewMAX17048 creates a MAX17048 fuel gauge. The I2C wire must already be configured.
+func NewMAX17048(bus *i2c.I2C) (*MAX1704x, error) {
+	return newMAX1704x(bus, true)
+}
+
+func newMAX1704x(bus *i2c.I2C, is17048 bool) (*MAX1704x, error) {
+	if _, err := bus.ReadRegU16BE(max1704xVERSION); err != nil {
+		return nil, fmt.Errorf("read MAX1704x version: %w", err)
+	}
+	return &MAX1704x{bus: bus, is17048: is17048}, nil
+}
+
+func (m *MAX1704x) Read() (*Status, error) {
+	rawVoltage, err := m.bus.ReadRegU16BE(max1704xVCELL)
+	if err != nil {
+		return nil, fmt.Errorf("read MAX1704x voltage: %w", err)
+	}
+	rawSoc, err := m.bus.ReadRegU16BE(max1704xSOC)
+	if err != nil {
+		return nil, fmt.Errorf("read MAX1704x soc: %w", err)
+	}
+	status := &Status{
+		Percent: clampPercent(float32(rawSoc) / 256),
+	}
+	if m.is17048 {
+		// 78.125µV per LSB
+		status.Voltage = float32(rawVoltage) * 78.125 / 1000000
+		crate, err := m.bus.ReadRegS16BE(max17048CRATE)
+		if err != nil {
+			return nil, fmt.Errorf("read MAX17048 charge rate: %w", err)
+		}
+		status.Charging = crate > 0
+	} else {
+		// upper 12 bits, 1.25mV per LSB
+		status.Voltage = float32(rawVoltage>>4) * 1.25 / 1000
+		status.Charging = m.trend.add(status.Voltage)
+	}
+	return status, nil
+}
+
+func (m *MAX1704x) Close() error {
+	return closeBus(m.bus)
+}
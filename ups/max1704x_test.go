@@ -0,0 +1,31 @@
+package ups
+
+import "testing"
+
+func TestVoltageTrend(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []float32
+		want    bool
+	}{
+		{name: "too few", samples: []float32{3.70, 3.75, 3.80, 3.85}},
+		{name: "steady", samples: []float32{3.70, 3.70, 3.70, 3.70, 3.70, 3.70, 3.70, 3.70}},
+		{name: "one lsb noise", samples: []float32{3.70, 3.70, 3.70, 3.70, 3.70, 3.70, 3.70, 3.70125}},
+		{name: "noise", samples: []float32{3.70, 3.69875, 3.70125, 3.70, 3.70125, 3.70, 3.70125, 3.70}},
+		{name: "discharging", samples: []float32{3.72, 3.715, 3.71, 3.705, 3.70, 3.695, 3.69, 3.685}},
+		{name: "charger plugged in", samples: []float32{3.70, 3.70, 3.70, 3.70, 3.76, 3.76, 3.77, 3.77}, want: true},
+		{name: "window slides", samples: []float32{3.50, 3.50, 3.50, 3.50, 3.70, 3.70, 3.70, 3.70, 3.70, 3.70, 3.70, 3.70}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var trend voltageTrend
+			var got bool
+			for _, sample := range tt.samples {
+				got = trend.add(sample)
+			}
+			if got != tt.want {
+				t.Errorf("charging = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+// Package ups reads battery state from the fuel gauge and power monitor
+// chips found on common Raspberry Pi UPS HATs.
+package ups
+
+import "picp/go-i2c"
+
+// Status is a single battery reading.
+type Status struct {
+	Percent  float32 `json:"percent"`
+	Voltage  float32 `json:"voltage"`
+	Current  float32 `json:"current"`
+	Charging bool    `json:"charging"`
+}
+
+// Gauge is implemented by every supported battery chip.
+type Gauge interface {
+	Read() (*Status, error)
+	Close() error
+}
+
+func clampPercent(percent float32) float32 {
+	if percent < 0 {
+		return 0
+	}
+	if percent > 100 {
+		return 100
+	}
+	return percent
+}
+
+func closeBus(bus *i2c.I2C) error {
+	if bus == nil {
+		return nil
+	}
+	return bus.Close()
+}
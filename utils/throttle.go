@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// exposed by the raspberrypi firmware driver on recent kernels
+const throttledSysfs = "/sys/devices/platform/soc/soc:firmware/get_throttled"
+
+// get_throttled bits, the same flags shifted by throttleSinceBootShift
+// report whether they occurred since boot
+const (
+	throttleUnderVoltage = 1 << iota
+	throttleFreqCapped
+	throttleThrottled
+	throttleSoftTempLimit
+	throttleSinceBootShift = 16
+)
+
+type ThrottleFlags struct {
+	UnderVoltage  bool `json:"under_voltage"`
+	FreqCapped    bool `json:"freq_capped"`
+	Throttled     bool `json:"throttled"`
+	SoftTempLimit bool `json:"soft_temp_limit"`
+}
+
+func (f ThrottleFlags) Any() bool {
+	return f.UnderVoltage || f.FreqCapped || f.Throttled || f.SoftTempLimit
+}
+
+type ThrottleStatus struct {
+	Raw       uint32        `json:"raw"`
+	Current   ThrottleFlags `json:"current"`
+	SinceBoot ThrottleFlags `json:"since_boot"`
+}
+
+func decodeThrottleFlags(bits uint32) ThrottleFlags {
+	return ThrottleFlags{
+		UnderVoltage:  bits&throttleUnderVoltage != 0,
+		FreqCapped:    bits&throttleFreqCapped != 0,
+		Throttled:     bits&throttleThrottled != 0,
+		SoftTempLimit: bits&throttleSoftTempLimit != 0,
+	}
+}
+
+func DecodeThrottled(raw uint32) ThrottleStatus {
+	return ThrottleStatus{
+		Raw:       raw,
+		Current:   decodeThrottleFlags(raw),
+		SinceBoot: decodeThrottleFlags(raw >> throttleSinceBootShift),
+	}
+}
+
+// parseThrottled accepts the sysfs hex value "50005" and the vcgencmd
+// output "throttled=0x50005"
+func parseThrottled(value string) (uint32, error) {
+	value = strings.TrimSpace(value)
+	value = strings.TrimPrefix(value, "throttled=")
+	value = strings.TrimPrefix(strings.ToLower(value), "0x")
+	raw, err := strconv.ParseUint(value, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("convert throttled value: %w", err)
+	}
+	return uint32(raw), nil
+}
+
+// GetThrottled reads the firmware throttled flags from sysfs, falling back
+// to vcgencmd on kernels without the attribute
+func GetThrottled() (*ThrottleStatus, error) {
+	data, err := os.ReadFile(throttledSysfs)
+	var output string
+	if err == nil {
+		output = string(data)
+	} else if errors.Is(err, os.ErrNotExist) {
+		output, err = runCmd("vcgencmd", "get_throttled")
+		if err != nil {
+			return nil, fmt.Errorf("vcgencmd get_throttled: %w", err)
+		}
+	} else {
+		return nil, fmt.Errorf("read throttled: %w", err)
+	}
+	raw, err := parseThrottled(output)
+	if err != nil {
+		return nil, err
+	}
+	status := DecodeThrottled(raw)
+	return &status, nil
+}
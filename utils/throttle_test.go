@@ -0,0 +1,54 @@
+package utils
+
+import "testing"
+
+func TestDecodeThrottled(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    ThrottleStatus
+		wantErr bool
+	}{
+		{
+			name:   "vcgencmd ok",
+			output: "throttled=0x0\n",
+			want:   ThrottleStatus{},
+		},
+		{
+			name:   "vcgencmd under voltage now and before",
+			output: "throttled=0x50005\n",
+			want: ThrottleStatus{
+				Raw:       0x50005,
+				Current:   ThrottleFlags{UnderVoltage: true, Throttled: true},
+				SinceBoot: ThrottleFlags{UnderVoltage: true, Throttled: true},
+			},
+		},
+		{
+			name:   "sysfs since boot only",
+			output: "a0000\n",
+			want: ThrottleStatus{
+				Raw:       0xa0000,
+				SinceBoot: ThrottleFlags{FreqCapped: true, SoftTempLimit: true},
+			},
+		},
+		{
+			name:    "garbage",
+			output:  "error=1 error_msg=\"Command not registered\"",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := parseThrottled(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseThrottled() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := DecodeThrottled(raw); got != tt.want {
+				t.Errorf("DecodeThrottled() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,15 +5,18 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/shirou/gopsutil/net"
 	"go.uber.org/zap"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"picp/logger"
 	"strconv"
 	"sync"
 	"syscall"
+	"time"
 )
 
 func GetHostIP() string {
@@ -29,16 +32,27 @@ func trimNumber(value []byte) string {
 	return string(bytes.Trim(value, " \t\n\r\v\f "))
 }
 
-func GetCpuTemperature() (float32, error) {
-	file, err := os.ReadFile("/sys/class/thermal/thermal_zone0/temp")
+// adjtimex status bit set by the kernel while the clock is not disciplined by NTP
+const staUnsync = 0x0040
+
+// adjtimex return value TIME_ERROR, the clock is not synchronized
+const timeError = 5
+
+func IsNtpSynchronized() (bool, error) {
+	var tx syscall.Timex
+	state, err := syscall.Adjtimex(&tx)
 	if err != nil {
-		return 0, fmt.Errorf("read cpu temp file: %w", err)
+		return false, fmt.Errorf("adjtimex: %w", err)
 	}
-	temp, err := strconv.Atoi(trimNumber(file))
-	if err != nil {
-		return 0, fmt.Errorf("convert cpu temp value: %w", err)
+	return state != timeError && tx.Status&staUnsync == 0, nil
+}
+
+func SetSystemTime(t time.Time) error {
+	tv := syscall.NsecToTimeval(t.UnixNano())
+	if err := syscall.Settimeofday(&tv); err != nil {
+		return fmt.Errorf("settimeofday: %w", err)
 	}
-	return float32(temp) / 1000, nil
+	return nil
 }
 
 func GetRootDiskInfo() (total, used int64, err error) {
@@ -129,6 +143,13 @@ func (tr *Runner) Stop(ctx context.Context) error {
 	return nil
 }
 
+// IsRunning reports whether the callback has been started and not returned yet
+func (tr *Runner) IsRunning() bool {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	return tr.done != nil
+}
+
 func NewRunner(ctx context.Context, callback func(ctx context.Context)) *Runner {
 	tr := &Runner{
 		rootCtx:  ctx,
@@ -137,6 +158,75 @@ func NewRunner(ctx context.Context, callback func(ctx context.Context)) *Runner
 	return tr
 }
 
+// Reboot and PowerOff go through systemd so services are stopped in order
+func Reboot() error {
+	_, err := runCmd("systemctl", "reboot")
+	return err
+}
+
+func PowerOff() error {
+	_, err := runCmd("systemctl", "poweroff")
+	return err
+}
+
+// RunScript runs script with the shell and returns its combined output
+func RunScript(script string) (string, error) {
+	return runCmd("/bin/sh", "-c", script)
+}
+
+func SystemctlStop(unit string) error {
+	_, err := runCmd("systemctl", "stop", unit)
+	return err
+}
+
+func SystemctlStart(unit string) error {
+	_, err := runCmd("systemctl", "start", unit)
+	return err
+}
+
+const cpufreqRoot = "/sys/devices/system/cpu/cpufreq"
+
+// CapCpuFreq lowers scaling_max_freq of every cpufreq policy to khz and
+// returns the previous limits for RestoreCpuFreq
+func CapCpuFreq(khz int) (map[string]int, error) {
+	policies, err := filepath.Glob(filepath.Join(cpufreqRoot, "policy*", "scaling_max_freq"))
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		return nil, errors.New("no cpufreq policy found")
+	}
+	limits := make(map[string]int, len(policies))
+	for _, policy := range policies {
+		data, err := os.ReadFile(policy)
+		if err != nil {
+			return limits, fmt.Errorf("read cpufreq limit: %w", err)
+		}
+		limit, err := strconv.Atoi(trimNumber(data))
+		if err != nil {
+			return limits, fmt.Errorf("convert cpufreq limit: %w", err)
+		}
+		if limit <= khz {
+			continue
+		}
+		if err = os.WriteFile(policy, []byte(strconv.Itoa(khz)), 0644); err != nil {
+			return limits, fmt.Errorf("write cpufreq limit: %w", err)
+		}
+		limits[policy] = limit
+	}
+	return limits, nil
+}
+
+func RestoreCpuFreq(limits map[string]int) error {
+	var errs []error
+	for policy, limit := range limits {
+		if err := os.WriteFile(policy, []byte(strconv.Itoa(limit)), 0644); err != nil {
+			errs = append(errs, fmt.Errorf("restore cpufreq limit: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func Sha1Sum(data string) string {
 	sum := sha1.Sum([]byte(data))
 	return hex.EncodeToString(sum[:])
@@ -0,0 +1,91 @@
+// Package w1 reads DS18B20 temperature probes through the kernel 1-Wire
+// sysfs interface.
+package w1
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+const DefaultRoot = "/sys/bus/w1/devices"
+
+// DS18B20 family code prefix of the sysfs device directory
+const ds18b20Prefix = "28-"
+
+var ErrCrcMismatch = errors.New("w1 crc check failed")
+
+// Bus is a view over the 1-Wire sysfs device tree.
+type Bus struct {
+	root string
+}
+
+func NewBus(root string) *Bus {
+	if root == "" {
+		root = DefaultRoot
+	}
+	return &Bus{root: root}
+}
+
+// List returns the ids of all DS18B20 probes currently present.
+func (b *Bus) List() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(b.root, ds18b20Prefix+"*"))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(matches))
+	for _, match := range matches {
+		ids = append(ids, filepath.Base(match))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// ReadTemperature reads a probe in degrees Celsius. The plain temperature
+// attribute of newer kernels is preferred over parsing w1_slave.
+func (b *Bus) ReadTemperature(id string) (float32, error) {
+	dir := filepath.Join(b.root, id)
+	data, err := os.ReadFile(filepath.Join(dir, "temperature"))
+	if err == nil {
+		return parseTemperature(data)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("read %s temperature: %w", id, err)
+	}
+	data, err = os.ReadFile(filepath.Join(dir, "w1_slave"))
+	if err != nil {
+		return 0, fmt.Errorf("read %s w1_slave: %w", id, err)
+	}
+	return parseW1Slave(data)
+}
+
+func parseTemperature(data []byte) (float32, error) {
+	value, err := strconv.Atoi(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return 0, fmt.Errorf("convert w1 temperature: %w", err)
+	}
+	return float32(value) / 1000, nil
+}
+
+// parseW1Slave parses the two line w1_slave format:
+//
+//	72 01 4b 46 7f ff 0e 10 57 : crc=57 YES
+//	72 01 4b 46 7f ff 0e 10 57 t=23125
+func parseW1Slave(data []byte) (float32, error) {
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	if len(lines) < 2 {
+		return 0, fmt.Errorf("invalid w1_slave content %q", data)
+	}
+	if !bytes.HasSuffix(bytes.TrimSpace(lines[0]), []byte("YES")) {
+		return 0, ErrCrcMismatch
+	}
+	index := bytes.LastIndex(lines[1], []byte("t="))
+	if index < 0 {
+		return 0, fmt.Errorf("invalid w1_slave content %q", data)
+	}
+	return parseTemperature(lines[1][index+2:])
+}
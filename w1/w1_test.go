@@ -0,0 +1,54 @@
+package w1
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeProbe(t *testing.T, root, id, name, content string) {
+	dir := filepath.Join(root, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBus(t *testing.T) {
+	root := t.TempDir()
+	writeProbe(t, root, "28-00000a000001", "w1_slave", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=23125\n")
+	writeProbe(t, root, "28-00000a000002", "temperature", "-1250\n")
+	writeProbe(t, root, "28-00000a000003", "w1_slave", "72 01 4b 46 7f ff 0e 10 57 : crc=00 NO\n72 01 4b 46 7f ff 0e 10 57 t=23125\n")
+	writeProbe(t, root, "w1_bus_master1", "w1_master_slave_count", "3\n")
+	bus := NewBus(root)
+	ids, err := bus.List()
+	if err != nil {
+		t.Fatal("List", err)
+	}
+	if len(ids) != 3 {
+		t.Fatalf("List() = %v, want 3 probes", ids)
+	}
+	tests := []struct {
+		id      string
+		want    float32
+		wantErr bool
+	}{
+		{id: "28-00000a000001", want: 23.125},
+		{id: "28-00000a000002", want: -1.25},
+		{id: "28-00000a000003", wantErr: true},
+		{id: "28-00000a000004", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			got, err := bus.ReadTemperature(tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadTemperature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ReadTemperature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package watchdog
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSystemdTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		usec    string
+		pid     string
+		timeout time.Duration
+		ok      bool
+	}{
+		{"unset", "", "", 0, false},
+		{"invalid", "abc", "", 0, false},
+		{"zero", "0", "", 0, false},
+		{"no pid", "30000000", "", 30 * time.Second, true},
+		{"own pid", "2500000", strconv.Itoa(os.Getpid()), 2500 * time.Millisecond, true},
+		{"other pid", "30000000", "1", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+			timeout, ok := SystemdTimeout()
+			if timeout != tt.timeout || ok != tt.ok {
+				t.Errorf("SystemdTimeout() = %v, %v, want %v, %v", timeout, ok, tt.timeout, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if sent, err := Notify(NotifyReady); sent || err != nil {
+		t.Fatalf("Notify() without socket = %v, %v", sent, err)
+	}
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+	if sent, err := Notify(NotifyWatchdog); !sent || err != nil {
+		t.Fatalf("Notify() = %v, %v", sent, err)
+	}
+	buf := make([]byte, 64)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != NotifyWatchdog {
+		t.Errorf("received %q, want %q", got, NotifyWatchdog)
+	}
+}
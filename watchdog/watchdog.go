@@ -0,0 +1,73 @@
+// Package watchdog pets the Linux hardware watchdog and the systemd service
+// watchdog. The board or the service is restarted once the petting stops.
+package watchdog
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// linux/watchdog.h
+const (
+	wdiocKeepalive  = 0x80045705
+	wdiocSetTimeout = 0xc0045706
+	wdiocGetTimeout = 0x80045707
+)
+
+// writing this right before closing the device disarms it, unless the
+// kernel was built with nowayout
+const magicClose = 'V'
+
+func ioctl(fd uintptr, request uintptr, buf []byte) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(unsafe.Pointer(&buf[0])))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Device is an open watchdog, it is armed from Open until Close
+type Device struct {
+	file    *os.File
+	timeout time.Duration
+}
+
+// Open arms the watchdog at path with timeout rounded to seconds. The driver
+// may pick another timeout, Timeout returns the one in use.
+func Open(path string, timeout time.Duration) (*Device, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	d := &Device{file: file}
+	buf := make([]byte, 4)
+	binary.NativeEndian.PutUint32(buf, uint32(timeout.Round(time.Second)/time.Second))
+	if err = ioctl(file.Fd(), wdiocSetTimeout, buf); err != nil {
+		// not every driver can change it, keep its own
+		err = ioctl(file.Fd(), wdiocGetTimeout, buf)
+	}
+	if err != nil {
+		return nil, errors.Join(err, d.Close())
+	}
+	d.timeout = time.Duration(binary.NativeEndian.Uint32(buf)) * time.Second
+	return d, nil
+}
+
+func (d *Device) Timeout() time.Duration {
+	return d.timeout
+}
+
+// Keepalive restarts the countdown
+func (d *Device) Keepalive() error {
+	return ioctl(d.file.Fd(), wdiocKeepalive, make([]byte, 4))
+}
+
+// Close disarms the watchdog and closes the device
+func (d *Device) Close() error {
+	_, err := d.file.Write([]byte{magicClose})
+	return errors.Join(err, d.file.Close())
+}
@@ -0,0 +1,175 @@
+// Package ws2812 drives WS2812 (NeoPixel) LED strips from the MOSI pin of a
+// SPI bus. Every data bit of the strip becomes three SPI bits at SpeedHz,
+// 110 for a one and 100 for a zero, which gives the 1.25µs bit period the
+// LEDs expect without any timing done by the CPU.
+package ws2812
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// SpeedHz is the SPI clock the bitstream is made for
+const SpeedHz = 2400000
+
+const (
+	// bytes of the bitstream per colour channel and per pixel
+	channelBytes = 3
+	pixelBytes   = 3 * channelBytes
+	// MOSI may idle high between transfers, a zero byte pulls it low first
+	leadBytes = 1
+	// zeros latching the colours, 300µs covers the newer parts
+	resetBytes = 90
+)
+
+// MaxPixels keeps a frame within one spidev transfer of 4096 bytes, a gap
+// between two transfers would latch half a frame
+const MaxPixels = 450
+
+// Transport sends the bitstream, *spi.SPI is one
+type Transport interface {
+	Write(data []byte) error
+	Close() error
+}
+
+type Color struct {
+	R, G, B uint8
+}
+
+// Lerp mixes c and other, t 0 is c and 1 is other
+func (c Color) Lerp(other Color, t float64) Color {
+	t = math.Max(0, math.Min(1, t))
+	mix := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + (float64(b)-float64(a))*t))
+	}
+	return Color{R: mix(c.R, other.R), G: mix(c.G, other.G), B: mix(c.B, other.B)}
+}
+
+// Gradient picks the colour at t between 0 and 1 of evenly spaced stops
+func Gradient(stops []Color, t float64) Color {
+	if len(stops) == 0 {
+		return Color{}
+	}
+	if len(stops) == 1 || t <= 0 {
+		return stops[0]
+	}
+	if t >= 1 {
+		return stops[len(stops)-1]
+	}
+	pos := t * float64(len(stops)-1)
+	i := int(pos)
+	return stops[i].Lerp(stops[i+1], pos-float64(i))
+}
+
+// Order is the position of red, green and blue on the wire
+type Order [3]int
+
+// ParseOrder reads a colour order like "grb", the order of most WS2812B
+func ParseOrder(value string) (Order, error) {
+	var order Order
+	if len(value) != 3 {
+		return order, fmt.Errorf("invalid colour order %q", value)
+	}
+	seen := map[byte]bool{}
+	for i := 0; i < 3; i++ {
+		c := value[i]
+		if seen[c] {
+			return order, fmt.Errorf("invalid colour order %q", value)
+		}
+		seen[c] = true
+		switch c {
+		case 'r':
+			order[i] = 0
+		case 'g':
+			order[i] = 1
+		case 'b':
+			order[i] = 2
+		default:
+			return order, fmt.Errorf("invalid colour order %q", value)
+		}
+	}
+	return order, nil
+}
+
+// expand holds the bitstream of every channel value, most significant bit first
+var expand [256][channelBytes]byte
+
+func init() {
+	for v := 0; v < 256; v++ {
+		var bits uint32
+		for i := 7; i >= 0; i-- {
+			if v&(1<<i) != 0 {
+				bits = bits<<3 | 0b110
+			} else {
+				bits = bits<<3 | 0b100
+			}
+		}
+		expand[v] = [channelBytes]byte{byte(bits >> 16), byte(bits >> 8), byte(bits)}
+	}
+}
+
+// Encode appends the bitstream of pixels to dst, brightness 255 keeps the
+// colours as they are
+func Encode(dst []byte, pixels []Color, order Order, brightness uint8) []byte {
+	dst = append(dst, make([]byte, leadBytes)...)
+	for _, pixel := range pixels {
+		channels := [3]uint8{pixel.R, pixel.G, pixel.B}
+		for _, channel := range order {
+			value := uint8(uint16(channels[channel]) * (uint16(brightness) + 1) >> 8)
+			dst = append(dst, expand[value][:]...)
+		}
+	}
+	return append(dst, make([]byte, resetBytes)...)
+}
+
+// Strip keeps the colours of every pixel until Show sends them.
+type Strip struct {
+	transport  Transport
+	order      Order
+	brightness uint8
+	pixels     []Color
+	buf        []byte
+}
+
+func NewStrip(transport Transport, count int, order Order, brightness uint8) (*Strip, error) {
+	if count <= 0 || count > MaxPixels {
+		return nil, fmt.Errorf("pixel count %d out of range 1-%d", count, MaxPixels)
+	}
+	return &Strip{
+		transport:  transport,
+		order:      order,
+		brightness: brightness,
+		pixels:     make([]Color, count),
+		buf:        make([]byte, 0, leadBytes+count*pixelBytes+resetBytes),
+	}, nil
+}
+
+func (s *Strip) Len() int {
+	return len(s.pixels)
+}
+
+// Set changes pixel i, out of range pixels are ignored
+func (s *Strip) Set(i int, c Color) {
+	if i >= 0 && i < len(s.pixels) {
+		s.pixels[i] = c
+	}
+}
+
+func (s *Strip) Fill(c Color) {
+	for i := range s.pixels {
+		s.pixels[i] = c
+	}
+}
+
+// Show sends the colours to the strip
+func (s *Strip) Show() error {
+	s.buf = Encode(s.buf[:0], s.pixels, s.order, s.brightness)
+	return s.transport.Write(s.buf)
+}
+
+// Close turns every pixel off and closes the transport
+func (s *Strip) Close() error {
+	s.Fill(Color{})
+	return errors.Join(s.Show(), s.transport.Close())
+}
@@ -0,0 +1,106 @@
+package ws2812
+
+import (
+	"bytes"
+	"testing"
+)
+
+type fakeTransport struct {
+	frames [][]byte
+	closed bool
+}
+
+func (f *fakeTransport) Write(data []byte) error {
+	f.frames = append(f.frames, append([]byte(nil), data...))
+	return nil
+}
+
+func (f *fakeTransport) Close() error {
+	f.closed = true
+	return nil
+}
+
+// decode turns a frame back into the channel bytes, failing on anything
+// that is not a 100 or 110 bit pattern
+func decode(t *testing.T, frame []byte) []byte {
+	t.Helper()
+	if len(frame) < leadBytes+resetBytes {
+		t.Fatalf("frame of %d bytes too short", len(frame))
+	}
+	if !bytes.Equal(frame[:leadBytes], make([]byte, leadBytes)) || !bytes.Equal(frame[len(frame)-resetBytes:], make([]byte, resetBytes)) {
+		t.Fatal("frame not framed by zeros")
+	}
+	data := frame[leadBytes : len(frame)-resetBytes]
+	var out []byte
+	for i := 0; i+channelBytes <= len(data); i += channelBytes {
+		bits := uint32(data[i])<<16 | uint32(data[i+1])<<8 | uint32(data[i+2])
+		var value byte
+		for shift := 21; shift >= 0; shift -= 3 {
+			switch bits >> shift & 0b111 {
+			case 0b110:
+				value = value<<1 | 1
+			case 0b100:
+				value <<= 1
+			default:
+				t.Fatalf("invalid bit pattern %03b", bits>>shift&0b111)
+			}
+		}
+		out = append(out, value)
+	}
+	return out
+}
+
+func TestStrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		order      string
+		brightness uint8
+		pixels     []Color
+		want       []byte
+	}{
+		{name: "grb", order: "grb", brightness: 255, pixels: []Color{{R: 0xff, G: 0x80, B: 0x01}}, want: []byte{0x80, 0xff, 0x01}},
+		{name: "rgb", order: "rgb", brightness: 255, pixels: []Color{{R: 0xff, G: 0x80, B: 0x01}}, want: []byte{0xff, 0x80, 0x01}},
+		{name: "bgr two pixels", order: "bgr", brightness: 255, pixels: []Color{{R: 1, G: 2, B: 3}, {R: 4, G: 5, B: 6}}, want: []byte{3, 2, 1, 6, 5, 4}},
+		{name: "half brightness", order: "rgb", brightness: 127, pixels: []Color{{R: 0xff, G: 0x80, B: 0x02}}, want: []byte{0x7f, 0x40, 0x01}},
+		{name: "off", order: "rgb", brightness: 0, pixels: []Color{{R: 0xff, G: 0xff, B: 0xff}}, want: []byte{0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := ParseOrder(tt.order)
+			if err != nil {
+				t.Fatal(err)
+			}
+			transport := &fakeTransport{}
+			strip, err := NewStrip(transport, len(tt.pixels), order, tt.brightness)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, c := range tt.pixels {
+				strip.Set(i, c)
+			}
+			if err = strip.Show(); err != nil {
+				t.Fatal("Show", err)
+			}
+			if got := decode(t, transport.frames[0]); !bytes.Equal(got, tt.want) {
+				t.Errorf("channels = %x, want %x", got, tt.want)
+			}
+			if err = strip.Close(); err != nil {
+				t.Fatal("Close", err)
+			}
+			if got := decode(t, transport.frames[1]); !bytes.Equal(got, make([]byte, len(tt.want))) || !transport.closed {
+				t.Errorf("Close left channels %x, closed %v", got, transport.closed)
+			}
+		})
+	}
+	for _, order := range []string{"rgbw", "rrb", "xyz", ""} {
+		if _, err := ParseOrder(order); err == nil {
+			t.Errorf("ParseOrder(%q) accepted", order)
+		}
+	}
+	if _, err := NewStrip(&fakeTransport{}, MaxPixels+1, Order{}, 255); err == nil {
+		t.Error("NewStrip accepted too many pixels")
+	}
+	if got := Gradient([]Color{{R: 0}, {R: 100}, {R: 200}}, 0.75); got.R != 150 {
+		t.Errorf("Gradient(0.75) = %v, want R 150", got)
+	}
+}